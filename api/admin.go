@@ -0,0 +1,79 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"expvar"
+	"net"
+	"strings"
+
+	t "github.com/axuman/go-server/biz"
+	"github.com/axuman/go-server/config"
+	G "github.com/axuman/go-server/globals"
+	"github.com/gofiber/fiber/v2"
+)
+
+// adminOnly 配置了 admin.token 时要求 Authorization: Bearer <token>，否则只允许本机访问
+func adminOnly(c *fiber.Ctx) error {
+	if token := G.Config.Get().Admin.Token; token != "" {
+		got, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1 {
+			return c.Next()
+		}
+	} else if ip := net.ParseIP(c.IP()); ip != nil && ip.IsLoopback() {
+		return c.Next()
+	}
+	return t.NewError(fiber.StatusForbidden, "forbidden", "Admin access denied")
+}
+
+// getMQStats 返回各消费组的积压情况
+func getMQStats(c *fiber.Ctx) error {
+	if G.MQ == nil {
+		return t.NotFound("Message queue is not enabled")
+	}
+	stats, err := G.MQ.Stats(c.UserContext())
+	if err != nil {
+		return t.Wrap(err, "Could not read queue stats")
+	}
+	return c.JSON(stats)
+}
+
+// getSidecars 返回子进程的运行状态
+func getSidecars(c *fiber.Ctx) error {
+	return c.JSON(G.Sidecars.Status())
+}
+
+// getPurge 返回最近一次清理软删除记录的结果
+func getPurge(c *fiber.Ctx) error {
+	return c.JSON(G.Purger.Stats())
+}
+
+// runPurge 立即清理一次，不等下一个周期
+func runPurge(c *fiber.Ctx) error {
+	stats, err := G.Purger.Run(c.UserContext())
+	if err != nil {
+		return t.Wrap(err, "Could not purge deleted records")
+	}
+	return c.JSON(stats)
+}
+
+// getMetrics 输出 expvar 指标，不包括 cmdline，命令行参数中可能有密钥
+func getMetrics(c *fiber.Ctx) error {
+	vars := map[string]json.RawMessage{}
+	expvar.Do(func(kv expvar.KeyValue) {
+		if kv.Key != "cmdline" {
+			vars[kv.Key] = json.RawMessage(kv.Value.String())
+		}
+	})
+	return c.JSON(vars)
+}
+
+// getConfig 返回当前生效的配置，密钥已隐藏
+func getConfig(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"path":       G.Config.Path(),
+		"loaded_at":  G.Config.LoadedAt(),
+		"reloadable": config.Reloadable(),
+		"config":     G.Config.Get().Redacted(),
+	})
+}
@@ -1,18 +1,138 @@
 package api
 
 import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
 	user "github.com/axuman/go-server/api/dmail"
 	mall "github.com/axuman/go-server/api/dmail/mall"
+	G "github.com/axuman/go-server/globals"
+	"github.com/axuman/go-server/middleware/ratelimit"
+	"github.com/axuman/go-server/resilience"
+	svr "github.com/axuman/go-server/svr"
 	"github.com/gofiber/fiber/v2"
 )
 
+// Policies 本地路由组的超时和熔断策略，key 同时是 /admin/metrics 中的指标名
+var Policies = map[string]resilience.Policy{
+	"dmail.user": {Timeout: 5 * time.Second, Breaker: resilience.BreakerConfig{FailureThreshold: 20, OpenFor: 10 * time.Second}},
+	"dmail.mall": {Timeout: 5 * time.Second, Breaker: resilience.BreakerConfig{FailureThreshold: 20, OpenFor: 10 * time.Second}},
+	"lowcode":    {Timeout: 5 * time.Second, Breaker: resilience.BreakerConfig{FailureThreshold: 20, OpenFor: 10 * time.Second}},
+}
+
+// LoadPolicies 用配置 resilience.routes 覆盖 Policies，每条为 "<路由组> key=value ..."
+func LoadPolicies(specs []string) error {
+	for _, spec := range specs {
+		fields := strings.Fields(spec)
+		if len(fields) == 0 {
+			continue
+		}
+		p, ok := Policies[fields[0]]
+		if !ok {
+			return fmt.Errorf("resilience.routes: unknown route group %q", fields[0])
+		}
+		p, err := p.Override(fields[1:]...)
+		if err != nil {
+			return fmt.Errorf("resilience.routes: %s: %w", fields[0], err)
+		}
+		Policies[fields[0]] = p
+	}
+	return nil
+}
+
+// handshakeLimit 每个 IP 的握手频率，正常客户端一个会话用 1 小时
+var handshakeLimit = ratelimit.Config{Enabled: true, RPS: 0.2, Burst: 10}
+
 func BuildRoutes(router fiber.Router) {
+	// 5秒盾、签名和接口加密按路由组启用，签名针对密文校验，所以在解密之前
+	var protected []fiber.Handler
+	if G.Shield != nil {
+		router.Post(G.Shield.VerifyPath(), G.Shield.Verify)
+	}
+	if G.Signer != nil {
+		protected = append(protected, G.Signer.Handler())
+	}
+	if G.Crypt != nil {
+		// 握手不需要认证且每次都会占用一个会话，放在 5秒盾之后并单独按 IP 限流
+		limiter := ratelimit.New(handshakeLimit)
+		svr.OnShutdown("handshake ratelimit", func(ctx context.Context) error {
+			limiter.Close()
+			return nil
+		})
+		handshake := []fiber.Handler{limiter.Handler(), G.Crypt.Handshake}
+		if G.Shield != nil {
+			handshake = append([]fiber.Handler{G.Shield.Handler()}, handshake...)
+		}
+		router.Post("/crypt/handshake", handshake...)
+		protected = append(protected, G.Crypt.Handler())
+	}
+
 	dmail_router := router.Group("/dmail")
-	user.BuildRoutes(dmail_router)
-	mall.BuildRoutes(dmail_router)
+	user.BuildRoutes(dmail_router, withPolicy(protected, "dmail.user")...)
+	mall.BuildRoutes(dmail_router, withPolicy(protected, "dmail.mall")...)
+	if G.LowCode != nil {
+		G.LowCode.Mount(router, withPolicy(protected, "lowcode")...)
+	}
 
 	router.Get("/health", func(c *fiber.Ctx) error {
+		if !svr.Ready() {
+			return c.Status(fiber.StatusServiceUnavailable).SendString("SHUTTING DOWN")
+		}
 		c.SendString("OK")
 		return nil
 	})
+
+	if G.Config != nil {
+		admin := router.Group("/admin", adminOnly)
+		admin.Get("/config", getConfig)
+		admin.Get("/metrics", getMetrics)
+		admin.Get("/mq", getMQStats)
+		if G.IPC != nil {
+			admin.Get("/ipc", G.IPC.Status)
+		}
+		if G.Sidecars != nil {
+			admin.Get("/sidecars", getSidecars)
+		}
+		if G.LowCode != nil {
+			G.LowCode.Admin(admin.Group("/entities"))
+		}
+		if G.Purger != nil {
+			admin.Get("/purge", getPurge)
+			admin.Post("/purge", runPurge)
+		}
+		if G.Gateway != nil {
+			admin.Get("/upstreams", G.Gateway.Status)
+		}
+	}
+
+	if G.Gateway != nil {
+		router.Get("/health/upstreams", G.Gateway.Health)
+		G.Gateway.Mount(router)
+	}
+
+	if G.IPC != nil {
+		G.IPC.Mount(router)
+	}
+}
+
+func withPolicy(middlewares []fiber.Handler, name string) []fiber.Handler {
+	if shielded(name) {
+		middlewares = append([]fiber.Handler{G.Shield.Handler()}, middlewares...)
+	}
+	return append(slices.Clip(middlewares), resilience.Handler(name, Policies[name]))
+}
+
+// shielded 路由组是否启用 5秒盾，shield.routes 为空时全部启用
+func shielded(name string) bool {
+	if G.Shield == nil {
+		return false
+	}
+	if G.Config == nil {
+		return true
+	}
+	routes := G.Config.Get().Shield.Routes
+	return len(routes) == 0 || slices.Contains(routes, name)
 }
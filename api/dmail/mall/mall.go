@@ -0,0 +1,168 @@
+package mall
+
+import (
+	"errors"
+	"net/url"
+
+	t "github.com/axuman/go-server/biz"
+	G "github.com/axuman/go-server/globals"
+	m "github.com/axuman/go-server/models"
+	"github.com/axuman/go-server/purge"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TopicCreated 新建商场后经 outbox 发布到队列的 topic，消息体为创建后的记录
+const TopicCreated = "mall." + t.EventCreated
+
+func malls() *t.Repository[m.Mall] {
+	r := t.NewRepository[m.Mall](G.DmailDB)
+	r.Events = true
+	return r
+}
+
+func BuildRoutes(router fiber.Router, middlewares ...fiber.Handler) {
+	table := t.SchemaOf[m.Mall]().Table
+	purge.Register(table)
+	mallGroup := router.Group("/mall", middlewares...)
+	mallGroup.Get("/q", G.Cache.Route(table, 0), qMall)
+	mallGroup.Post("/c", G.Cache.Invalidate(table), cMall)
+	mallGroup.Put("/u", G.Cache.Invalidate(table), uMall)
+	mallGroup.Post("/bc", G.Cache.Invalidate(table), bcMall)
+	mallGroup.Delete("/bd", G.Cache.Invalidate(table), bdMall)
+	mallGroup.Post("/restore", G.Cache.Invalidate(table), restoreMall)
+}
+
+func qMall(c *fiber.Ctx) error {
+	payload := new(t.PaginatorWith[m.Mall])
+	if err := c.QueryParser(payload); err != nil {
+		return t.BadRequest("Cannot parse query parameters").WithDetails(err.Error())
+	}
+	payload.SetDefaults()
+
+	values, err := url.ParseQuery(string(c.Request().URI().QueryString()))
+	if err == nil {
+		err = payload.ParseQuery(values)
+	}
+	if err != nil {
+		return t.AsAppError(err)
+	}
+
+	page, err := malls().List(c.UserContext(), payload)
+	if err != nil {
+		return t.Wrap(err, "Could not query malls")
+	}
+
+	return c.JSON(page)
+}
+
+func cMall(c *fiber.Ctx) error {
+	payload := new(m.Mall)
+	if err := c.BodyParser(payload); err != nil {
+		return t.BadRequest("Cannot parse JSON").WithDetails(err.Error())
+	}
+
+	if err := t.Validate(payload, c.Get(fiber.HeaderAcceptLanguage)); err != nil {
+		return err
+	}
+
+	mall, err := malls().Create(c.UserContext(), payload)
+	if err != nil {
+		return t.Wrap(err, "Could not create mall")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(mall)
+}
+
+func uMall(c *fiber.Ctx) error {
+	payload := new(t.Table[m.Mall]) // Expecting ID and Data for update
+	if err := c.BodyParser(payload); err != nil {
+		return t.BadRequest("Cannot parse JSON").WithDetails(err.Error())
+	}
+
+	if payload.ID == nil {
+		return t.BadRequest("Mall ID is required for update")
+	}
+
+	if err := t.Validate(&payload.D, c.Get(fiber.HeaderAcceptLanguage)); err != nil {
+		return err
+	}
+
+	mall, err := malls().Update(c.UserContext(), *payload.ID, &payload.D)
+	if err != nil {
+		if errors.Is(err, t.ErrNotFound) {
+			return t.NotFound("Mall not found or already deleted")
+		}
+		return t.Wrap(err, "Could not update mall")
+	}
+
+	return c.JSON(mall)
+}
+
+func bcMall(c *fiber.Ctx) error {
+	var payloads []m.Mall
+	if err := c.BodyParser(&payloads); err != nil {
+		return t.BadRequest("Cannot parse JSON array").WithDetails(err.Error())
+	}
+
+	if len(payloads) == 0 {
+		return t.BadRequest("No malls provided for batch creation")
+	}
+
+	if err := t.ValidateEach(payloads, c.Get(fiber.HeaderAcceptLanguage)); err != nil {
+		return err
+	}
+
+	createdMalls, err := malls().BatchCreate(c.UserContext(), payloads)
+	if err != nil {
+		return t.Wrap(err, "Could not batch create malls")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(createdMalls)
+}
+
+func bdMall(c *fiber.Ctx) error {
+	var payload struct {
+		IDs []int64 `json:"ids"`
+	}
+
+	if err := c.BodyParser(&payload); err != nil {
+		return t.BadRequest("Cannot parse JSON").WithDetails(err.Error())
+	}
+
+	if len(payload.IDs) == 0 {
+		return t.BadRequest("No IDs provided for deletion")
+	}
+
+	affected, err := malls().SoftDelete(c.UserContext(), payload.IDs)
+	if err != nil {
+		return t.Wrap(err, "Could not delete malls")
+	}
+
+	return c.JSON(fiber.Map{
+		"deleted": affected,
+	})
+}
+
+func restoreMall(c *fiber.Ctx) error {
+	var payload struct {
+		IDs []int64 `json:"ids"`
+	}
+
+	if err := c.BodyParser(&payload); err != nil {
+		return t.BadRequest("Cannot parse JSON").WithDetails(err.Error())
+	}
+
+	if len(payload.IDs) == 0 {
+		return t.BadRequest("No IDs provided for restore")
+	}
+
+	affected, err := malls().Restore(c.UserContext(), payload.IDs)
+	if err != nil {
+		return t.Wrap(err, "Could not restore malls")
+	}
+
+	return c.JSON(fiber.Map{
+		"restored": affected,
+	})
+}
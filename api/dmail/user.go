@@ -1,37 +1,53 @@
 package user
 
 import (
-	"log"
-	"strings"
-	"time"
+	"encoding/json"
+	"errors"
+	"net/url"
 
 	t "github.com/axuman/go-server/biz"     // Adjust import path
 	G "github.com/axuman/go-server/globals" // Adjust import path
 	m "github.com/axuman/go-server/models"
+	"github.com/axuman/go-server/purge"
 
-	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 )
 
-var validate = validator.New()
-
+func users() *t.Repository[m.User] {
+	r := t.NewRepository[m.User](G.DmailDB)
+	r.Events = true
+	return r
+}
 
-func BuildRoutes(router fiber.Router) {
-	userGroup := router.Group("/user")
-	userGroup.Get("/q", q)
-	userGroup.Post("/c", c)
-   	userGroup.Delete("/bd", bd)
+func BuildRoutes(router fiber.Router, middlewares ...fiber.Handler) {
+	table := t.SchemaOf[m.User]().Table
+	purge.Register(table)
+	userGroup := router.Group("/user", middlewares...)
+	userGroup.Get("/q", G.Cache.Route(table, 0), q)
+	userGroup.Get("/:id<int>", G.Cache.Route(table, 0), get)
+	userGroup.Post("/c", G.Cache.Invalidate(table), c)
+	userGroup.Put("/u", G.Cache.Invalidate(table), u)
+	userGroup.Patch("/:id<int>", G.Cache.Invalidate(table), patch)
+	userGroup.Post("/bc", G.Cache.Invalidate(table), bc)
+	userGroup.Delete("/bd", G.Cache.Invalidate(table), bd)
+	userGroup.Post("/restore", G.Cache.Invalidate(table), restore)
 }
 
 func q(c *fiber.Ctx) error {
 	payload := new(t.PaginatorWith[m.User])
 	if err := c.QueryParser(payload); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Cannot parse query parameters: " + err.Error(),
-		})
+		return t.BadRequest("Cannot parse query parameters").WithDetails(err.Error())
 	}
 	payload.SetDefaults() // Apply default pagination values
 
+	values, err := url.ParseQuery(string(c.Request().URI().QueryString()))
+	if err == nil {
+		err = payload.ParseQuery(values)
+	}
+	if err != nil {
+		return t.AsAppError(err)
+	}
+
 	// Business logic: if age is 100, return error
 	// if payload.Age != nil && *payload.Age == 100 {
 	// 	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -39,94 +55,123 @@ func q(c *fiber.Ctx) error {
 	// 	})
 	// }
 
-	var queryBuilder strings.Builder
-	var args []interface{}
+	page, err := users().List(c.UserContext(), payload)
+	if err != nil {
+		return t.Wrap(err, "Could not query users")
+	}
 
-	queryBuilder.WriteString("SELECT id, name, age, created_at FROM users WHERE deleted_at IS NULL")
-	if payload.D.Age != nil {
-		queryBuilder.WriteString(" AND age = ?")
-		args = append(args, &payload.D.Age)
+	return c.JSON(page)
+}
+
+func c(c *fiber.Ctx) error {
+	payload := new(m.User)
+	if err := c.BodyParser(payload); err != nil {
+		return t.BadRequest("Cannot parse JSON").WithDetails(err.Error())
 	}
-	if payload.D.Name != nil {
-		queryBuilder.WriteString(" AND name = ?")
-		args = append(args, &payload.D.Name)
+
+	if err := t.Validate(payload, c.Get(fiber.HeaderAcceptLanguage)); err != nil {
+		return err
 	}
-	if payload.ID != nil {
-		queryBuilder.WriteString(" AND id > ? LIMIT ?")
-		args = append(args, *payload.ID)
-		args = append(args, payload.PS)
-	} else {
-		queryBuilder.WriteString(" LIMIT ? OFFSET ?")
-		args = append(args, payload.PS)
-		args = append(args, payload.PN*payload.PS)
+
+	user, err := users().Create(c.UserContext(), payload)
+	if err != nil {
+		return t.Wrap(err, "Could not create user")
 	}
 
-	finalQuery := queryBuilder.String()
+	return c.Status(fiber.StatusCreated).JSON(user)
+}
 
-	rows, err := G.DmailDB.QueryContext(c.Context(), finalQuery, args...)
+func get(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Could not query users: " + err.Error(),
-		})
+		return t.BadRequest("Invalid user ID")
 	}
-	defer rows.Close()
-
-	users := []t.Table[m.User]{}
-	for rows.Next() {
-		var user t.Table[m.User]
-		var createdAt time.Time // 直接使用 time.Time 接收 DATETIME
 
-		if err := rows.Scan(&user.ID, &user.D.Name, &user.D.Age, &createdAt); err != nil {
-			log.Printf("Error scanning user row: %v", err)
-			continue
+	user, err := users().Get(c.UserContext(), int64(id))
+	if err != nil {
+		if errors.Is(err, t.ErrNotFound) {
+			return t.NotFound("User not found")
 		}
-		user.CreatedAt = createdAt // 直接赋值，无需手动解析
-		users = append(users, user)
+		return t.Wrap(err, "Could not get user")
+	}
+
+	return c.JSON(user)
+}
+
+func u(c *fiber.Ctx) error {
+	payload := new(t.Table[m.User]) // Expecting ID and Data for update
+	if err := c.BodyParser(payload); err != nil {
+		return t.BadRequest("Cannot parse JSON").WithDetails(err.Error())
 	}
 
+	if payload.ID == nil {
+		return t.BadRequest("User ID is required for update")
+	}
+
+	if err := t.Validate(&payload.D, c.Get(fiber.HeaderAcceptLanguage)); err != nil {
+		return err
+	}
 
-	if err = rows.Err(); err != nil {
-		log.Printf("Error after iterating user rows: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Error processing user query results: " + err.Error(),
-		})
+	user, err := users().Update(c.UserContext(), *payload.ID, &payload.D)
+	if err != nil {
+		if errors.Is(err, t.ErrNotFound) {
+			return t.NotFound("User not found or already deleted")
+		}
+		return t.Wrap(err, "Could not update user")
 	}
 
-	return c.JSON(users)
+	return c.JSON(user)
 }
 
-func c(c *fiber.Ctx) error {
+// patch 按 JSON merge patch 只更新请求体中出现的字段，null 和缺省的字段保持不变
+func patch(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return t.BadRequest("Invalid user ID")
+	}
+
+	// 同时接受 application/json 和 application/merge-patch+json，BodyParser 不认后者
 	payload := new(m.User)
-	if err := c.BodyParser(payload); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Cannot parse JSON: " + err.Error(),
-		})
+	if err := json.Unmarshal(c.Body(), payload); err != nil {
+		return t.BadRequest("Cannot parse JSON").WithDetails(err.Error())
 	}
 
-	// if err := validate.Struct(payload); err != nil {
-	// 	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-	// 		"error": "Validation failed: " + err.Error(),
-	// 	})
-	// }
+	if err := t.ValidatePatch(payload, c.Get(fiber.HeaderAcceptLanguage)); err != nil {
+		return err
+	}
 
-	query := `INSERT INTO users (name, age) VALUES (?, ?) RETURNING id, name, age, created_at;`
-	var user t.Table[m.User]
-	err := G.DmailDB.QueryRowContext(c.Context(), query, payload.Name, payload.Age).Scan(
-		&user.ID,
-		&user.D.Name,
-		&user.D.Age,
-		&user.CreatedAt,
-	)
+	user, err := users().Patch(c.UserContext(), int64(id), payload)
 	if err != nil {
-		log.Printf("Error creating user: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Could not create user: " + err.Error(),
-		})
+		if errors.Is(err, t.ErrNotFound) {
+			return t.NotFound("User not found or already deleted")
+		}
+		return t.Wrap(err, "Could not patch user")
 	}
 
-	return c.Status(fiber.StatusCreated).JSON(user)
+	return c.JSON(user)
 }
 
+func bc(c *fiber.Ctx) error {
+	var payloads []m.User
+	if err := c.BodyParser(&payloads); err != nil {
+		return t.BadRequest("Cannot parse JSON array").WithDetails(err.Error())
+	}
+
+	if len(payloads) == 0 {
+		return t.BadRequest("No users provided for batch creation")
+	}
+
+	if err := t.ValidateEach(payloads, c.Get(fiber.HeaderAcceptLanguage)); err != nil {
+		return err
+	}
+
+	createdUsers, err := users().BatchCreate(c.UserContext(), payloads)
+	if err != nil {
+		return t.Wrap(err, "Could not batch create users")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(createdUsers)
+}
 
 func bd(c *fiber.Ctx) error {
 	var payload struct {
@@ -134,45 +179,42 @@ func bd(c *fiber.Ctx) error {
 	}
 
 	if err := c.BodyParser(&payload); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Cannot parse JSON: " + err.Error(),
-		})
+		return t.BadRequest("Cannot parse JSON").WithDetails(err.Error())
 	}
 
 	if len(payload.IDs) == 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "No IDs provided for deletion",
-		})
+		return t.BadRequest("No IDs provided for deletion")
+	}
+
+	affected, err := users().SoftDelete(c.UserContext(), payload.IDs)
+	if err != nil {
+		return t.Wrap(err, "Could not delete users")
 	}
 
-	// Build query with placeholders for each ID
-	placeholders := strings.Repeat("?,", len(payload.IDs))
-	placeholders = placeholders[:len(placeholders)-1] // Remove trailing comma
+	return c.JSON(fiber.Map{
+		"deleted": affected,
+	})
+}
 
-	query := "UPDATE users SET deleted_at = CURRENT_TIMESTAMP WHERE id IN (" + placeholders + ")"
+func restore(c *fiber.Ctx) error {
+	var payload struct {
+		IDs []int64 `json:"ids"`
+	}
 
-	// Convert IDs to interface slice for query args
-	args := make([]interface{}, len(payload.IDs))
-	for i, id := range payload.IDs {
-		args[i] = id
+	if err := c.BodyParser(&payload); err != nil {
+		return t.BadRequest("Cannot parse JSON").WithDetails(err.Error())
 	}
 
-	// Execute the query
-	result, err := G.DmailDB.ExecContext(c.Context(), query, args...)
-	if err != nil {
-		log.Printf("Error batch deleting users: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Could not delete users: " + err.Error(),
-		})
+	if len(payload.IDs) == 0 {
+		return t.BadRequest("No IDs provided for restore")
 	}
 
-	// Get number of affected rows
-	affected, err := result.RowsAffected()
+	affected, err := users().Restore(c.UserContext(), payload.IDs)
 	if err != nil {
-		log.Printf("Error getting affected rows: %v", err)
+		return t.Wrap(err, "Could not restore users")
 	}
 
 	return c.JSON(fiber.Map{
-		"deleted": affected,
+		"restored": affected,
 	})
 }
@@ -0,0 +1,204 @@
+package user
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/axuman/go-server/biz"
+	G "github.com/axuman/go-server/globals"
+	svr "github.com/axuman/go-server/svr"
+	"github.com/gofiber/fiber/v2"
+)
+
+func newApp(t *testing.T) *fiber.App {
+	t.Helper()
+	db, err := svr.InitDB(svr.DBConfig{Path: filepath.Join(t.TempDir(), "test.db"), MaxOpenConns: 4, MaxIdleConns: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := G.DmailDB
+	G.DmailDB = db
+	t.Cleanup(func() {
+		G.DmailDB = old
+		db.Close()
+	})
+	app := fiber.New(fiber.Config{ErrorHandler: func(c *fiber.Ctx, err error) error {
+		ae := biz.AsAppError(err)
+		return c.Status(ae.Status).JSON(fiber.Map{"error": ae})
+	}})
+	BuildRoutes(app)
+	return app
+}
+
+// do 发送请求，把响应体解码到 out（不为 nil 时）
+func do(t *testing.T, app *fiber.App, method, path, contentType, body string, out any) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set(fiber.HeaderContentType, contentType)
+	}
+	res, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(res.Body)
+	if out != nil {
+		if err := json.Unmarshal(b, out); err != nil {
+			t.Fatalf("%s %s: %v: %s", method, path, err, b)
+		}
+	}
+	return res.StatusCode
+}
+
+// row 对应 biz.Table[models.User] 的响应，字段在 D 下
+type row struct {
+	ID int64 `json:"id"`
+	D  struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+}
+
+func userRow(id int64, name string, age int) row {
+	r := row{ID: id}
+	r.D.Name, r.D.Age = name, age
+	return r
+}
+
+type errorBody struct {
+	Error struct {
+		Code    string           `json:"code"`
+		Details []biz.FieldError `json:"details"`
+	} `json:"error"`
+}
+
+func create(t *testing.T, app *fiber.App, body string) row {
+	t.Helper()
+	var r row
+	if status := do(t, app, "POST", "/user/c", fiber.MIMEApplicationJSON, body, &r); status != http.StatusCreated {
+		t.Fatalf("create: %d", status)
+	}
+	return r
+}
+
+func TestPatchMergeSemantics(t *testing.T) {
+	app := newApp(t)
+	id := create(t, app, `{"name": "alice", "age": 30}`).ID
+	path := "/user/" + strconv.FormatInt(id, 10)
+
+	steps := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		want        row
+	}{
+		{"absent name", fiber.MIMEApplicationJSON, `{"age": 31}`, http.StatusOK, userRow(id, "alice", 31)},
+		// name 是必填字段，null 不会清空它，和缺省一样保持不变
+		{"null name", "application/merge-patch+json", `{"name": null, "age": 32}`, http.StatusOK, userRow(id, "alice", 32)},
+		{"empty patch", fiber.MIMEApplicationJSON, `{}`, http.StatusOK, userRow(id, "alice", 32)},
+		{"set name", "application/merge-patch+json", `{"name": "bob"}`, http.StatusOK, userRow(id, "bob", 32)},
+		{"invalid present field", fiber.MIMEApplicationJSON, `{"age": 151}`, http.StatusBadRequest, row{}},
+		{"bad json", fiber.MIMEApplicationJSON, `{"age":`, http.StatusBadRequest, row{}},
+	}
+	for _, s := range steps {
+		var got row
+		status := do(t, app, "PATCH", path, s.contentType, s.body, &got)
+		if status != s.status || s.status == http.StatusOK && got != s.want {
+			t.Fatalf("%s: %d %+v, want %d %+v", s.name, status, got, s.status, s.want)
+		}
+	}
+	var got row
+	if status := do(t, app, "GET", path, "", "", &got); status != http.StatusOK || got != userRow(id, "bob", 32) {
+		t.Fatalf("get after patch: %d %+v", status, got)
+	}
+}
+
+func TestSoftDeletedIsNotFound(t *testing.T) {
+	app := newApp(t)
+	id := create(t, app, `{"name": "alice", "age": 30}`).ID
+	path := "/user/" + strconv.FormatInt(id, 10)
+
+	var got row
+	if status := do(t, app, "PUT", "/user/u", fiber.MIMEApplicationJSON, `{"id": `+strconv.FormatInt(id, 10)+`, "D": {"name": "bob", "age": 40}}`, &got); status != http.StatusOK || got != userRow(id, "bob", 40) {
+		t.Fatalf("update: %d %+v", status, got)
+	}
+	var deleted struct{ Deleted int64 }
+	if status := do(t, app, "DELETE", "/user/bd", fiber.MIMEApplicationJSON, `{"ids": [`+strconv.FormatInt(id, 10)+`]}`, &deleted); status != http.StatusOK || deleted.Deleted != 1 {
+		t.Fatalf("delete: %d %+v", status, deleted)
+	}
+
+	tests := []struct {
+		method, path, body string
+	}{
+		{"GET", path, ""},
+		{"GET", "/user/999", ""},
+		{"PATCH", path, `{"age": 1}`},
+		{"PUT", "/user/u", `{"id": ` + strconv.FormatInt(id, 10) + `, "D": {"name": "carol", "age": 1}}`},
+	}
+	for _, tt := range tests {
+		var e errorBody
+		if status := do(t, app, tt.method, tt.path, fiber.MIMEApplicationJSON, tt.body, &e); status != http.StatusNotFound || e.Error.Code != biz.CodeNotFound {
+			t.Errorf("%s %s: %d %+v", tt.method, tt.path, status, e)
+		}
+	}
+
+	var restored struct{ Restored int64 }
+	if status := do(t, app, "POST", "/user/restore", fiber.MIMEApplicationJSON, `{"ids": [`+strconv.FormatInt(id, 10)+`]}`, &restored); status != http.StatusOK || restored.Restored != 1 {
+		t.Fatalf("restore: %d %+v", status, restored)
+	}
+	if status := do(t, app, "GET", path, "", "", &got); status != http.StatusOK || got.D.Name != "bob" {
+		t.Fatalf("get restored: %d %+v", status, got)
+	}
+}
+
+func TestUpdateRequiresIDAndValidFields(t *testing.T) {
+	app := newApp(t)
+	id := create(t, app, `{"name": "alice", "age": 30}`).ID
+	var e errorBody
+	if status := do(t, app, "PUT", "/user/u", fiber.MIMEApplicationJSON, `{"D": {"name": "bob", "age": 1}}`, &e); status != http.StatusBadRequest {
+		t.Fatalf("without id: %d %+v", status, e)
+	}
+	e = errorBody{}
+	status := do(t, app, "PUT", "/user/u", fiber.MIMEApplicationJSON, `{"id": `+strconv.FormatInt(id, 10)+`, "D": {"name": "bob"}}`, &e)
+	if status != http.StatusBadRequest || len(e.Error.Details) != 1 || e.Error.Details[0].Field != "age" {
+		t.Fatalf("missing age: %d %+v", status, e)
+	}
+}
+
+func TestBatchCreateValidation(t *testing.T) {
+	app := newApp(t)
+	var e errorBody
+	status := do(t, app, "POST", "/user/bc", fiber.MIMEApplicationJSON,
+		`[{"name": "a", "age": 1}, {"age": 2}, {"name": "c", "age": 200}]`, &e)
+	if status != http.StatusBadRequest || e.Error.Code != biz.CodeValidation {
+		t.Fatalf("bc: %d %+v", status, e)
+	}
+	var fields []string
+	for _, f := range e.Error.Details {
+		fields = append(fields, f.Field)
+	}
+	if strings.Join(fields, ",") != "[1].name,[2].age" {
+		t.Fatalf("fields = %v", fields)
+	}
+
+	// 有一项不合法时整批都不写入
+	var page struct{ Items []row }
+	if status := do(t, app, "GET", "/user/q", "", "", &page); status != http.StatusOK || len(page.Items) != 0 {
+		t.Fatalf("q: %d %+v", status, page)
+	}
+
+	var created []row
+	if status := do(t, app, "POST", "/user/bc", fiber.MIMEApplicationJSON, `[{"name": "a", "age": 1}, {"name": "b", "age": 2}]`, &created); status != http.StatusCreated || len(created) != 2 {
+		t.Fatalf("bc: %d %+v", status, created)
+	}
+	if status := do(t, app, "POST", "/user/bc", fiber.MIMEApplicationJSON, `[]`, &e); status != http.StatusBadRequest {
+		t.Fatalf("empty bc: %d", status)
+	}
+}
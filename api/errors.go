@@ -0,0 +1,57 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+
+	t "github.com/axuman/go-server/biz"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// ErrorHandler 将 handler 返回的错误统一渲染为 AppError 格式，内部原因只写日志
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	var ae *t.AppError
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		ae = t.NewError(fe.Code, statusCode(fe.Code), fe.Message)
+	} else {
+		ae = t.AsAppError(err)
+	}
+
+	resp := *ae
+	if id, ok := c.Locals("requestid").(string); ok {
+		resp.RequestID = id
+	}
+	level := slog.LevelDebug
+	if resp.Status >= fiber.StatusInternalServerError {
+		level = slog.LevelError
+	} else if resp.Err != nil {
+		level = slog.LevelWarn
+	}
+	slog.Log(c.UserContext(), level, "request failed",
+		"request_id", resp.RequestID, "method", c.Method(), "path", c.Path(),
+		"status", resp.Status, "code", resp.Code, "err", err)
+
+	return c.Status(resp.Status).JSON(fiber.Map{
+		"error": resp,
+	})
+}
+
+// statusCode 由 HTTP 状态码生成错误码，例如 405 -> method_not_allowed
+func statusCode(status int) string {
+	switch status {
+	case fiber.StatusBadRequest:
+		return t.CodeBadRequest
+	case fiber.StatusNotFound:
+		return t.CodeNotFound
+	case fiber.StatusInternalServerError:
+		return t.CodeInternal
+	}
+	msg := utils.StatusMessage(status)
+	if msg == "" {
+		return t.CodeInternal
+	}
+	return strings.ToLower(strings.NewReplacer(" ", "_", "-", "_", "'", "").Replace(msg))
+}
@@ -0,0 +1,112 @@
+package biz
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// 机器可读的错误码，客户端应根据 code 而不是 message 做判断
+const (
+	CodeBadRequest   = "bad_request"
+	CodeInvalidQuery = "invalid_query"
+	CodeValidation   = "validation_failed"
+	CodeNotFound     = "not_found"
+	CodeConflict     = "conflict"
+	CodeTimeout      = "timeout"
+	CodeUnavailable  = "service_unavailable"
+	CodeInternal     = "internal_error"
+)
+
+// AppError 所有接口统一的错误类型，由 Fiber 的 ErrorHandler 渲染为
+// {"error": {"code": ..., "message": ..., "details": ..., "request_id": ...}}
+//
+// Err 是内部原因，只写日志，不会返回给客户端。
+type AppError struct {
+	Code      string `json:"code"`
+	Status    int    `json:"-"`
+	Message   string `json:"message"`
+	Details   any    `json:"details,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	Err       error  `json:"-"`
+}
+
+func NewError(status int, code, message string) *AppError {
+	return &AppError{Status: status, Code: code, Message: message}
+}
+
+func (e *AppError) Error() string {
+	if e.Err != nil {
+		return e.Code + ": " + e.Message + ": " + e.Err.Error()
+	}
+	return e.Code + ": " + e.Message
+}
+
+func (e *AppError) Unwrap() error {
+	return e.Err
+}
+
+// WithDetails 返回附带 details 的副本
+func (e *AppError) WithDetails(details any) *AppError {
+	c := *e
+	c.Details = details
+	return &c
+}
+
+func BadRequest(message string) *AppError {
+	return NewError(http.StatusBadRequest, CodeBadRequest, message)
+}
+
+func NotFound(message string) *AppError {
+	return NewError(http.StatusNotFound, CodeNotFound, message)
+}
+
+// ValidationFailed 请求体校验失败，details 为具体的字段错误
+func ValidationFailed(details any) *AppError {
+	return &AppError{Status: http.StatusBadRequest, Code: CodeValidation, Message: "Validation failed", Details: details}
+}
+
+// Wrap 将任意错误转换为 AppError，message 用于替换未识别错误（500）的提示语，
+// err 本身是 AppError 时修改的是副本，不会影响共享的错误值
+func Wrap(err error, message string) *AppError {
+	ae := AsAppError(err)
+	if ae.Code == CodeInternal && ae.Err != nil {
+		c := *ae
+		c.Message = message
+		return &c
+	}
+	return ae
+}
+
+// AsAppError 将已知错误映射为对应的状态码和错误码，未知错误统一为 500
+func AsAppError(err error) *AppError {
+	var ae *AppError
+	if errors.As(err, &ae) {
+		return ae
+	}
+
+	var qe *QueryError
+	if errors.As(err, &qe) {
+		return &AppError{Status: http.StatusBadRequest, Code: CodeInvalidQuery, Message: qe.Error(), Details: map[string]string{"param": qe.Param}}
+	}
+	if errors.Is(err, ErrNotFound) {
+		return &AppError{Status: http.StatusNotFound, Code: CodeNotFound, Message: "Record not found", Err: err}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &AppError{Status: http.StatusGatewayTimeout, Code: CodeTimeout, Message: "Request timed out", Err: err}
+	}
+
+	var se sqlite3.Error
+	if errors.As(err, &se) {
+		switch se.Code {
+		case sqlite3.ErrConstraint:
+			return &AppError{Status: http.StatusConflict, Code: CodeConflict, Message: "Conflicts with existing data", Err: err}
+		case sqlite3.ErrBusy, sqlite3.ErrLocked:
+			return &AppError{Status: http.StatusServiceUnavailable, Code: CodeUnavailable, Message: "Database is busy, please retry", Err: err}
+		}
+	}
+
+	return &AppError{Status: http.StatusInternalServerError, Code: CodeInternal, Message: "Internal server error", Err: err}
+}
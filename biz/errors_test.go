@@ -0,0 +1,52 @@
+package biz
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestWrapDoesNotMutateAppError(t *testing.T) {
+	shared := &AppError{Status: http.StatusInternalServerError, Code: CodeInternal, Message: "Internal server error", Err: errors.New("boom")}
+
+	got := Wrap(shared, "Could not query users")
+	if got.Message != "Could not query users" {
+		t.Fatalf("message = %q", got.Message)
+	}
+	if shared.Message != "Internal server error" {
+		t.Fatalf("shared error was mutated: %q", shared.Message)
+	}
+	if got == shared {
+		t.Fatal("Wrap returned the shared pointer")
+	}
+}
+
+func TestAsAppError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"app error", NotFound("x"), http.StatusNotFound, CodeNotFound},
+		{"not found", fmt.Errorf("get: %w", ErrNotFound), http.StatusNotFound, CodeNotFound},
+		{"query error", &QueryError{Param: "sort", Msg: "bad"}, http.StatusBadRequest, CodeInvalidQuery},
+		{"unknown", errors.New("boom"), http.StatusInternalServerError, CodeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ae := AsAppError(tt.err)
+			if ae.Status != tt.status || ae.Code != tt.code {
+				t.Fatalf("got %d %s, want %d %s", ae.Status, ae.Code, tt.status, tt.code)
+			}
+		})
+	}
+}
+
+func TestWrapKeepsKnownErrors(t *testing.T) {
+	ae := Wrap(ErrNotFound, "Could not update")
+	if ae.Code != CodeNotFound || ae.Message != "Record not found" {
+		t.Fatalf("got %s %q", ae.Code, ae.Message)
+	}
+}
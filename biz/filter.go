@@ -0,0 +1,217 @@
+package biz
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Op 过滤操作符，查询参数写法为 field[op]=value，省略 [op] 等价于 eq
+//
+// 任意操作符前加 not. 表示取反，例如 name[not.like]=ali%。
+type Op string
+
+const (
+	OpEq     Op = "eq"
+	OpNe     Op = "ne"
+	OpGt     Op = "gt"
+	OpGte    Op = "gte"
+	OpLt     Op = "lt"
+	OpLte    Op = "lte"
+	OpIn     Op = "in"     // 逗号分隔或重复参数
+	OpNin    Op = "nin"    // not in
+	OpLike   Op = "like"   // 原样作为 LIKE 模式，% 和 _ 为通配符
+	OpPrefix Op = "prefix" // 前缀匹配，值中的 % 和 _ 会被转义
+	OpNull   Op = "null"   // true: IS NULL, false: IS NOT NULL
+)
+
+// sqliteTime 与 CURRENT_TIMESTAMP 写入的格式一致，时间比较按字符串进行
+const sqliteTime = "2006-01-02 15:04:05"
+
+const maxFilterValues = 100
+
+var opSQL = map[Op]string{
+	OpEq: "=", OpNe: "!=", OpGt: ">", OpGte: ">=", OpLt: "<", OpLte: "<=",
+	OpIn: "IN", OpNin: "NOT IN", OpLike: "LIKE", OpPrefix: "LIKE",
+}
+
+// reservedParams 分页等参数，不作为过滤条件
+var reservedParams = map[string]bool{"id": true, "pn": true, "ps": true, "sort": true, "cursor": true, "count": true, "deleted": true}
+
+// Filter 一个已校验的过滤条件
+type Filter struct {
+	Column string
+	Op     Op
+	Not    bool
+	Args   []any
+}
+
+// QueryError 过滤、排序或游标参数不合法，应返回 400
+type QueryError struct {
+	Param string
+	Msg   string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("invalid query parameter %q: %s", e.Param, e.Msg)
+}
+
+// ParseFilters 按白名单解析查询参数，只有 `filter` 标签中声明过的字段和操作符才允许使用
+func (s *Schema) ParseFilters(values url.Values) ([]Filter, error) {
+	var filters []Filter
+	for _, param := range slices.Sorted(maps.Keys(values)) {
+		vals := values[param]
+		if reservedParams[param] || strings.HasPrefix(param, "D.") {
+			continue
+		}
+
+		key, opStr := param, string(OpEq)
+		if i := strings.IndexByte(param, '['); i >= 0 {
+			if !strings.HasSuffix(param, "]") {
+				return nil, &QueryError{param, "malformed operator"}
+			}
+			key, opStr = param[:i], param[i+1:len(param)-1]
+		}
+		not := false
+		if rest, ok := strings.CutPrefix(opStr, "not."); ok {
+			not, opStr = true, rest
+		}
+		op := Op(opStr)
+
+		col, ok := s.filterColumn(key)
+		if !ok {
+			return nil, &QueryError{param, "unknown field"}
+		}
+		if !col.allows(op) {
+			return nil, &QueryError{param, "operator not allowed"}
+		}
+
+		f := Filter{Column: col.Name, Op: op, Not: not}
+		switch op {
+		case OpNull:
+			if len(vals) != 1 {
+				return nil, &QueryError{param, "expects a single value"}
+			}
+			isNull, err := strconv.ParseBool(vals[0])
+			if err != nil {
+				return nil, &QueryError{param, "expects true or false"}
+			}
+			f.Not = f.Not != !isNull
+		case OpIn, OpNin:
+			for _, v := range vals {
+				for _, item := range strings.Split(v, ",") {
+					arg, err := col.parse(item)
+					if err != nil {
+						return nil, &QueryError{param, err.Error()}
+					}
+					f.Args = append(f.Args, arg)
+				}
+			}
+			if len(f.Args) == 0 || len(f.Args) > maxFilterValues {
+				return nil, &QueryError{param, fmt.Sprintf("expects 1 to %d values", maxFilterValues)}
+			}
+		default:
+			if len(vals) != 1 {
+				return nil, &QueryError{param, "expects a single value"}
+			}
+			v := vals[0]
+			if op == OpPrefix {
+				v = likeEscaper.Replace(v) + "%"
+			}
+			arg, err := col.parse(v)
+			if err != nil {
+				return nil, &QueryError{param, err.Error()}
+			}
+			f.Args = []any{arg}
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// sql 生成参数化的条件表达式
+func (f Filter) sql() string {
+	var expr string
+	switch f.Op {
+	case OpNull:
+		expr = f.Column + " IS NULL"
+	case OpIn, OpNin:
+		expr = f.Column + " " + opSQL[f.Op] + " (" + placeholders(len(f.Args)) + ")"
+	case OpPrefix:
+		expr = f.Column + ` LIKE ? ESCAPE '\'`
+	default:
+		expr = f.Column + " " + opSQL[f.Op] + " ?"
+	}
+	if f.Not {
+		return "NOT (" + expr + ")"
+	}
+	return expr
+}
+
+// Valid 是否为支持的操作符
+func (op Op) Valid() bool {
+	_, ok := opSQL[op]
+	return ok || op == OpNull
+}
+
+func (c Column) allows(op Op) bool {
+	for _, o := range c.Ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// parse 将查询参数转换为列类型对应的值
+func (c Column) parse(v string) (any, error) {
+	switch c.Kind {
+	case KindInt:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an integer", v)
+		}
+		return n, nil
+	case KindFloat:
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", v)
+		}
+		return n, nil
+	case KindBool:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a boolean", v)
+		}
+		return b, nil
+	case KindTime:
+		for _, layout := range []string{time.RFC3339Nano, sqliteTime, time.DateOnly} {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t.UTC().Format(sqliteTime), nil
+			}
+		}
+		return nil, fmt.Errorf("%q is not a time", v)
+	default:
+		return v, nil
+	}
+}
+
+func parseOps(tag string) []Op {
+	if tag == "" || tag == "-" {
+		return nil
+	}
+	var ops []Op
+	for _, s := range strings.Split(tag, ",") {
+		op := Op(strings.TrimSpace(s))
+		if op.Valid() {
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
@@ -0,0 +1,95 @@
+package biz
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type widget struct {
+	Name  *string  `json:"name" filter:"eq,ne,in,nin,like,prefix" sort:"true"`
+	Age   *int     `json:"age" filter:"eq,gt,gte,lt,lte,in" sort:"true"`
+	Price *float64 `json:"price" db:"unit_price" filter:"gte,lte,null"`
+	Sold  *bool    `json:"sold" filter:"eq"`
+	Note  *string  `json:"note"`
+	Rank  *int     `json:"rank" sort:"true"`
+	Score *int     `json:"score" sort:"true"`
+}
+
+func TestParseFilters(t *testing.T) {
+	s := SchemaOf[widget]()
+	tests := []struct {
+		query string
+		sql   []string
+		args  [][]any
+		err   string // QueryError 的 Msg，为空表示合法
+	}{
+		{"name=bob", []string{"name = ?"}, [][]any{{"bob"}}, ""},
+		{"name[eq]=bob&age[gte]=18", []string{"age >= ?", "name = ?"}, [][]any{{int64(18)}, {"bob"}}, ""},
+		{"age[in]=1,2&age[in]=3", []string{"age IN (?, ?, ?)"}, [][]any{{int64(1), int64(2), int64(3)}}, ""},
+		{"name[nin]=a,b", []string{"name NOT IN (?, ?)"}, [][]any{{"a", "b"}}, ""},
+		{"name[like]=ali%25", []string{"name LIKE ?"}, [][]any{{"ali%"}}, ""},
+		{"name[prefix]=50%25_off", []string{`name LIKE ? ESCAPE '\'`}, [][]any{{`50\%\_off%`}}, ""},
+		{"name[not.like]=a%25", []string{"NOT (name LIKE ?)"}, [][]any{{"a%"}}, ""},
+		{"price[null]=true", []string{"unit_price IS NULL"}, [][]any{nil}, ""},
+		{"price[null]=false", []string{"NOT (unit_price IS NULL)"}, [][]any{nil}, ""},
+		{"price[not.null]=false", []string{"unit_price IS NULL"}, [][]any{nil}, ""},
+		{"unit_price[gte]=1.5", []string{"unit_price >= ?"}, [][]any{{1.5}}, ""},
+		{"sold=true", []string{"sold = ?"}, [][]any{{true}}, ""},
+		{"created_at[gte]=2024-01-02", []string{"created_at >= ?"}, [][]any{{"2024-01-02 00:00:00"}}, ""},
+		{"created_at[lt]=2024-01-02T08:00:00%2B08:00", []string{"created_at < ?"}, [][]any{{"2024-01-02 00:00:00"}}, ""},
+		// 分页参数和 D. 前缀的参数不是过滤条件
+		{"id=1&pn=2&ps=10&sort=name&cursor=x&count=true&deleted=true&D.name=x", nil, nil, ""},
+
+		{"nope=1", nil, nil, "unknown field"},
+		{"note=x", nil, nil, "operator not allowed"},
+		{"age[like]=1", nil, nil, "operator not allowed"},
+		{"age[between]=1", nil, nil, "operator not allowed"},
+		{"age[gte=1", nil, nil, "malformed operator"},
+		{"age=x", nil, nil, `"x" is not an integer`},
+		{"age[in]=1,x", nil, nil, `"x" is not an integer`},
+		{"age=1&age=2", nil, nil, "expects a single value"},
+		{"price[gte]=cheap", nil, nil, `"cheap" is not a number`},
+		{"price[null]=maybe", nil, nil, "expects true or false"},
+		{"sold=yes", nil, nil, `"yes" is not a boolean`},
+		{"created_at[gt]=yesterday", nil, nil, `"yesterday" is not a time`},
+		{"age[in]=" + strings.Repeat("1,", 100) + "1", nil, nil, "expects 1 to 100 values"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			filters, err := s.ParseFilters(values)
+			if tt.err != "" {
+				var qe *QueryError
+				if !errors.As(err, &qe) || qe.Msg != tt.err {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var sqls []string
+			var args [][]any
+			for _, f := range filters {
+				sqls = append(sqls, f.sql())
+				args = append(args, f.Args)
+			}
+			if !reflect.DeepEqual(sqls, tt.sql) || !reflect.DeepEqual(args, tt.args) {
+				t.Fatalf("got %q %v, want %q %v", sqls, args, tt.sql, tt.args)
+			}
+		})
+	}
+}
+
+func TestQueryErrorIsBadRequest(t *testing.T) {
+	_, err := SchemaOf[widget]().ParseFilters(url.Values{"nope": {"1"}})
+	if ae := AsAppError(err); ae.Status != 400 {
+		t.Fatalf("status = %d", ae.Status)
+	}
+}
@@ -2,15 +2,34 @@ package biz
 
 import (
 	"database/sql"
+	"net/url"
 	"time"
 )
 
+// deleted 查询参数的取值
+const (
+	DeletedOnly    = "only"
+	DeletedInclude = "include"
+)
+
 // Paginator 是通用的分页结构体，可以嵌入到其他查询结构体中
 type PaginatorWith[T any] struct {
 	ID *int64 `query:"id" json:"id"`
 	D  T
 	PN int `query:"pn"` // Page number (0-indexed)
 	PS int `query:"ps"` // Page size
+
+	Sort   string `query:"sort"`   // 例如 -created_at,name
+	Cursor string `query:"cursor"` // 上一页返回的游标，与 sort 一起使用
+	Count  bool   `query:"count"`  // 为 true 时返回总数
+
+	// Deleted 为 only 时只查询软删除的记录（回收站），include 时同时查询未删除和已删除的记录
+	Deleted string `query:"deleted"`
+
+	Filters []Filter  `query:"-" json:"-"` // 由 ParseQuery 解析的过滤条件
+	Keys    []SortKey `query:"-" json:"-"` // 由 ParseQuery 解析的排序列，总是以 id 结尾
+
+	after []any // 游标中的排序值
 }
 
 // SetDefaults 设置分页默认值
@@ -23,9 +42,53 @@ func (p *PaginatorWith[T]) SetDefaults() {
 	}
 }
 
+// ParseQuery 从原始查询参数中解析过滤、排序和游标，例如 ?age[gte]=18&name[like]=ali%&sort=-created_at
+func (p *PaginatorWith[T]) ParseQuery(values url.Values) error {
+	return p.ParseQueryWith(SchemaOf[T](), values)
+}
+
+// ParseQueryWith 与 ParseQuery 相同，但使用给定的 Schema，用于 Record 等没有结构体标签的类型
+func (p *PaginatorWith[T]) ParseQueryWith(schema *Schema, values url.Values) error {
+	filters, err := schema.ParseFilters(values)
+	if err != nil {
+		return err
+	}
+	keys, err := schema.ParseSort(values.Get("sort"))
+	if err != nil {
+		return err
+	}
+	p.Filters, p.Keys, p.after = filters, keys, nil
+
+	switch p.Deleted {
+	case "", DeletedOnly, DeletedInclude:
+	default:
+		return &QueryError{"deleted", "expects only or include"}
+	}
+
+	cursor := values.Get("cursor")
+	if cursor != "" {
+		if p.after, err = decodeCursor(cursor, keys); err != nil {
+			return err
+		}
+	} else if p.ID != nil && len(keys) > 1 {
+		// 旧的 id 游标只适用于按 id 排序
+		return &QueryError{"id", "id cursor cannot be combined with sort, use cursor"}
+	}
+	return nil
+}
+
+// Page 列表接口统一的返回结构
+type Page[T any] struct {
+	Items      []Table[T] `json:"items"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+	HasMore    bool       `json:"has_more"`
+	Total      *int64     `json:"total,omitempty"` // 仅在 count=true 时返回
+}
+
 type Table[T any] struct {
 	ID        *int64 `query:"id" json:"id"`
 	D         T
 	CreatedAt time.Time    `json:"created_at"`
 	UpdatedAt sql.NullTime `json:"updated_at"`
+	DeletedAt *time.Time   `json:"deleted_at,omitempty"` // 只有软删除的记录才有
 }
@@ -0,0 +1,46 @@
+package biz
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// 事件动作，完整的事件名为 <entity>.<action>，例如 mall.created
+const (
+	EventCreated  = "created"
+	EventUpdated  = "updated"
+	EventDeleted  = "deleted"
+	EventRestored = "restored"
+)
+
+// Event outbox 表中的一条领域事件，与数据变更在同一事务中写入
+type Event struct {
+	ID          int64           `json:"id"`
+	Type        string          `json:"type"`
+	Aggregate   string          `json:"aggregate"` // 表名
+	AggregateID int64           `json:"aggregate_id"`
+	Payload     json.RawMessage `json:"payload"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Attempts    int             `json:"-"`
+}
+
+// writeEvents 用一条多行 INSERT 写入事件
+func writeEvents(ctx context.Context, q Querier, events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	var qb strings.Builder
+	qb.WriteString("INSERT INTO outbox (event, aggregate, aggregate_id, payload) VALUES ")
+	args := make([]any, 0, len(events)*4)
+	for i, e := range events {
+		if i > 0 {
+			qb.WriteString(", ")
+		}
+		qb.WriteString("(?, ?, ?, ?)")
+		args = append(args, e.Type, e.Aggregate, e.AggregateID, string(e.Payload))
+	}
+	_, err := q.ExecContext(ctx, qb.String(), args...)
+	return err
+}
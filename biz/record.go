@@ -0,0 +1,80 @@
+package biz
+
+import (
+	"fmt"
+	"time"
+)
+
+// Record 运行时定义的实体的一行数据，key 为列的 JSON 字段名
+//
+// Repository[Record] 没有结构体标签可以推导，需要直接给出 Schema。读出的值按
+// Column.Kind 转换为 string、int64、float64、bool 或 time.Time，缺少的 key 写入 NULL。
+type Record map[string]any
+
+// recordOf T 为 Record 时返回 d 指向的 map，nil map 会被初始化
+func recordOf[T any](d *T) (Record, bool) {
+	rec, ok := any(d).(*Record)
+	if !ok {
+		return nil, false
+	}
+	if *rec == nil {
+		*rec = Record{}
+	}
+	return *rec, true
+}
+
+// arg 返回 rec 中列 c 的 SQL 参数，时间与 CURRENT_TIMESTAMP 的格式一致，便于按字符串比较
+func (rec Record) arg(c Column) any {
+	if t, ok := rec[c.Key].(time.Time); ok {
+		return t.UTC().Format(sqliteTime)
+	}
+	return rec[c.Key]
+}
+
+// recordField 把一列扫描进 Record
+type recordField struct {
+	rec Record
+	col Column
+}
+
+func (f recordField) Scan(src any) error {
+	f.rec[f.col.Key] = f.col.fromDB(src)
+	return nil
+}
+
+// fromDB 把驱动返回的值转换为列类型，SQLite 的类型亲和性不保证存的值一定符合列类型
+func (c Column) fromDB(src any) any {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		src = string(v)
+	}
+	switch c.Kind {
+	case KindFloat:
+		if n, ok := src.(int64); ok {
+			return float64(n)
+		}
+	case KindBool:
+		if n, ok := src.(int64); ok {
+			return n != 0
+		}
+	case KindTime:
+		if s, ok := src.(string); ok {
+			for _, layout := range []string{sqliteTime, time.RFC3339Nano} {
+				if t, err := time.Parse(layout, s); err == nil {
+					return t
+				}
+			}
+		}
+	case KindString:
+		switch v := src.(type) {
+		case string:
+		case time.Time:
+			return v.UTC().Format(sqliteTime)
+		default:
+			return fmt.Sprint(v)
+		}
+	}
+	return src
+}
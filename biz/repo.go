@@ -0,0 +1,450 @@
+package biz
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var ErrNotFound = errors.New("record not found")
+
+// Querier 是 *sql.DB、*sql.Tx 和 *sql.Conn 的公共方法集
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Beginner 可以开启事务的连接，*sql.DB 和 *sql.Conn 都满足
+type Beginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// Repository 基于模型结构体标签的通用增删改查，新实体只需要定义模型结构体
+//
+// 所有表都需要 id、created_at、updated_at、deleted_at 四个公共列。
+type Repository[T any] struct {
+	DB     Querier
+	Schema *Schema
+
+	// Events 为 true 时写操作在同一事务中向 outbox 表写入 <entity>.<action> 事件，
+	// 由 outbox 包异步转发。DB 本身是 *sql.Tx 时由调用方负责提交。
+	Events bool
+}
+
+func NewRepository[T any](db Querier) *Repository[T] {
+	return &Repository[T]{DB: db, Schema: SchemaOf[T]()}
+}
+
+// Find 按分页条件查询记录（默认只查未删除的，见 PaginatorWith.Deleted），D 中非空字段和 Filters 作为过滤条件
+//
+// 有游标时使用 keyset 分页，否则使用 pn/ps 偏移分页，默认按 id 升序。
+func (r *Repository[T]) Find(ctx context.Context, p *PaginatorWith[T]) ([]Table[T], error) {
+	return r.find(ctx, p, p.PS)
+}
+
+// List 查询一页数据并生成下一页游标，多查询一条用于判断 has_more，
+// count=true 时用相同的过滤条件统计总数
+func (r *Repository[T]) List(ctx context.Context, p *PaginatorWith[T]) (*Page[T], error) {
+	items, err := r.find(ctx, p, p.PS+1)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page[T]{Items: items}
+	if len(items) > p.PS {
+		page.Items = items[:p.PS]
+		page.HasMore = true
+		page.NextCursor = r.NextCursor(p, page.Items)
+	}
+	if p.Count {
+		total, err := r.Count(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		page.Total = &total
+	}
+	return page, nil
+}
+
+func (r *Repository[T]) find(ctx context.Context, p *PaginatorWith[T], limit int) ([]Table[T], error) {
+	where, args := r.where(p)
+
+	keys := p.Keys
+	if len(keys) == 0 {
+		keys, _ = r.Schema.ParseSort("")
+	}
+
+	var qb strings.Builder
+	qb.WriteString("SELECT " + r.Schema.columnList() + " FROM " + r.Schema.Table + where)
+	switch {
+	case p.after != nil:
+		cond, condArgs := keyset(keys, p.after)
+		qb.WriteString(" AND " + cond + orderBy(keys) + " LIMIT ?")
+		args = append(append(args, condArgs...), limit)
+	case p.ID != nil:
+		qb.WriteString(" AND id > ?" + orderBy(keys) + " LIMIT ?")
+		args = append(args, *p.ID, limit)
+	default:
+		qb.WriteString(orderBy(keys) + " LIMIT ? OFFSET ?")
+		args = append(args, limit, p.PN*p.PS)
+	}
+
+	rows, err := r.DB.QueryContext(ctx, qb.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	return r.scanAll(rows)
+}
+
+// NextCursor 根据本页最后一条记录生成下一页的游标，rows 为空时返回空字符串
+func (r *Repository[T]) NextCursor(p *PaginatorWith[T], rows []Table[T]) string {
+	if len(rows) == 0 {
+		return ""
+	}
+	keys := p.Keys
+	if len(keys) == 0 {
+		keys, _ = r.Schema.ParseSort("")
+	}
+
+	last := &rows[len(rows)-1]
+	rec, isRecord := recordOf(&last.D)
+	v := reflect.ValueOf(&last.D).Elem()
+	values := make([]any, len(keys))
+	for i, k := range keys {
+		switch {
+		case k.Column.index != nil:
+			if f := reflect.Indirect(v.FieldByIndex(k.Column.index)); f.IsValid() {
+				values[i] = f.Interface()
+			}
+		case isRecord && k.Column.Name != "id" && k.Column.Name != "created_at":
+			values[i] = rec[k.Column.Key]
+		case k.Column.Name == "created_at":
+			values[i] = last.CreatedAt
+		default:
+			values[i] = *last.ID
+		}
+	}
+	return encodeCursor(keys, values)
+}
+
+// Count 返回与 Find 相同过滤条件下的记录总数（忽略分页）
+func (r *Repository[T]) Count(ctx context.Context, p *PaginatorWith[T]) (int64, error) {
+	where, args := r.where(p)
+	var n int64
+	err := r.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+r.Schema.Table+where, args...).Scan(&n)
+	return n, err
+}
+
+// Get 按 id 查询一条未删除的记录
+func (r *Repository[T]) Get(ctx context.Context, id int64) (*Table[T], error) {
+	query := "SELECT " + r.Schema.columnList() + " FROM " + r.Schema.Table + " WHERE id = ? AND deleted_at IS NULL"
+	return r.scanOne(r.DB.QueryRowContext(ctx, query, id))
+}
+
+// Create 插入一条记录并返回数据库中的完整行
+func (r *Repository[T]) Create(ctx context.Context, d *T) (*Table[T], error) {
+	rows, err := r.BatchCreate(ctx, []T{*d})
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+	return &rows[0], nil
+}
+
+// BatchCreate 用一条多行 INSERT 插入所有记录
+func (r *Repository[T]) BatchCreate(ctx context.Context, ds []T) ([]Table[T], error) {
+	if len(ds) == 0 {
+		return []Table[T]{}, nil
+	}
+
+	cols := make([]string, len(r.Schema.Columns))
+	for i, c := range r.Schema.Columns {
+		cols[i] = c.Name
+	}
+	row := "(" + placeholders(len(cols)) + ")"
+
+	var qb strings.Builder
+	qb.WriteString("INSERT INTO " + r.Schema.Table + " (" + strings.Join(cols, ", ") + ") VALUES ")
+	args := make([]any, 0, len(ds)*len(cols))
+	for i := range ds {
+		if i > 0 {
+			qb.WriteString(", ")
+		}
+		qb.WriteString(row)
+		if rec, ok := recordOf(&ds[i]); ok {
+			for _, c := range r.Schema.Columns {
+				args = append(args, rec.arg(c))
+			}
+			continue
+		}
+		v := reflect.ValueOf(&ds[i]).Elem()
+		for _, c := range r.Schema.Columns {
+			args = append(args, v.FieldByIndex(c.index).Interface())
+		}
+	}
+	qb.WriteString(" RETURNING " + r.Schema.columnList())
+
+	var created []Table[T]
+	err := r.write(ctx, func(q Querier) error {
+		rows, err := q.QueryContext(ctx, qb.String(), args...)
+		if err != nil {
+			return err
+		}
+		if created, err = r.scanAll(rows); err != nil {
+			return err
+		}
+		return r.emitRows(ctx, q, EventCreated, created)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// Update 全量更新一条未删除的记录
+func (r *Repository[T]) Update(ctx context.Context, id int64, d *T) (*Table[T], error) {
+	return r.update(ctx, id, d, false)
+}
+
+// Patch 只更新 d 中非空（非 nil 指针、非零值）的字段，没有字段需要更新时直接返回当前记录
+//
+// T 为 Record 时更新出现的 key，值为 nil 表示置为 NULL。
+func (r *Repository[T]) Patch(ctx context.Context, id int64, d *T) (*Table[T], error) {
+	return r.update(ctx, id, d, true)
+}
+
+func (r *Repository[T]) update(ctx context.Context, id int64, d *T, partial bool) (*Table[T], error) {
+	var sets []string
+	var args []any
+	rec, isRecord := recordOf(d)
+	v := reflect.ValueOf(d).Elem()
+	for _, c := range r.Schema.Columns {
+		var arg any
+		if isRecord {
+			if _, set := rec[c.Key]; partial && !set {
+				continue
+			}
+			arg = rec.arg(c)
+		} else {
+			f := v.FieldByIndex(c.index)
+			if partial && f.IsZero() {
+				continue
+			}
+			arg = f.Interface()
+		}
+		sets = append(sets, c.Name+" = ?")
+		args = append(args, arg)
+	}
+	if len(sets) == 0 {
+		return r.Get(ctx, id)
+	}
+	sets = append(sets, "updated_at = CURRENT_TIMESTAMP")
+	args = append(args, id)
+
+	query := "UPDATE " + r.Schema.Table + " SET " + strings.Join(sets, ", ") +
+		" WHERE id = ? AND deleted_at IS NULL RETURNING " + r.Schema.columnList()
+	var updated *Table[T]
+	err := r.write(ctx, func(q Querier) error {
+		var err error
+		if updated, err = r.scanOne(q.QueryRowContext(ctx, query, args...)); err != nil {
+			return err
+		}
+		return r.emitRows(ctx, q, EventUpdated, []Table[T]{*updated})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// SoftDelete 设置 deleted_at，返回受影响的行数
+func (r *Repository[T]) SoftDelete(ctx context.Context, ids []int64) (int64, error) {
+	return r.execIDs(ctx, EventDeleted, "UPDATE "+r.Schema.Table+" SET deleted_at = CURRENT_TIMESTAMP WHERE deleted_at IS NULL AND id IN", ids)
+}
+
+// Restore 清除 deleted_at 恢复软删除的记录，返回受影响的行数
+func (r *Repository[T]) Restore(ctx context.Context, ids []int64) (int64, error) {
+	return r.execIDs(ctx, EventRestored, "UPDATE "+r.Schema.Table+" SET deleted_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE deleted_at IS NOT NULL AND id IN", ids)
+}
+
+// execIDs 对 ids 执行 prefix 语句，为实际受影响的每一行写入 action 事件
+func (r *Repository[T]) execIDs(ctx context.Context, action, prefix string, ids []int64) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	var affected []int64
+	err := r.write(ctx, func(q Querier) error {
+		rows, err := q.QueryContext(ctx, prefix+" ("+placeholders(len(ids))+") RETURNING id", args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			affected = append(affected, id)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+
+		events := make([]Event, len(affected))
+		for i, id := range affected {
+			events[i] = r.event(action, id, json.RawMessage(`{"id":`+strconv.FormatInt(id, 10)+`}`))
+		}
+		return r.emit(ctx, q, events)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(affected)), nil
+}
+
+// write 开启了 Events 时在事务中执行 fn，否则（或 DB 已经是事务时）直接执行
+func (r *Repository[T]) write(ctx context.Context, fn func(q Querier) error) error {
+	b, ok := r.DB.(Beginner)
+	if !r.Events || !ok {
+		return fn(r.DB)
+	}
+	tx, err := b.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *Repository[T]) event(action string, id int64, payload json.RawMessage) Event {
+	return Event{Type: r.Schema.Entity + "." + action, Aggregate: r.Schema.Table, AggregateID: id, Payload: payload}
+}
+
+// emitRows 以完整的行作为事件内容
+func (r *Repository[T]) emitRows(ctx context.Context, q Querier, action string, rows []Table[T]) error {
+	if !r.Events {
+		return nil
+	}
+	events := make([]Event, len(rows))
+	for i := range rows {
+		payload, err := json.Marshal(rows[i])
+		if err != nil {
+			return err
+		}
+		events[i] = r.event(action, *rows[i].ID, payload)
+	}
+	return r.emit(ctx, q, events)
+}
+
+func (r *Repository[T]) emit(ctx context.Context, q Querier, events []Event) error {
+	if !r.Events {
+		return nil
+	}
+	return writeEvents(ctx, q, events)
+}
+
+// where 生成 " WHERE ..." 子句，默认只查未删除的记录，D 中非 nil 指针字段（Record 中非 nil 的值）
+// 作为等值条件，再追加 Filters
+func (r *Repository[T]) where(p *PaginatorWith[T]) (string, []any) {
+	var args []any
+	var qb strings.Builder
+	switch p.Deleted {
+	case DeletedOnly:
+		qb.WriteString(" WHERE deleted_at IS NOT NULL")
+	case DeletedInclude:
+		qb.WriteString(" WHERE 1 = 1")
+	default:
+		qb.WriteString(" WHERE deleted_at IS NULL")
+	}
+
+	if rec, ok := recordOf(&p.D); ok {
+		for _, c := range r.Schema.Columns {
+			if rec[c.Key] != nil {
+				qb.WriteString(" AND " + c.Name + " = ?")
+				args = append(args, rec.arg(c))
+			}
+		}
+	} else {
+		v := reflect.ValueOf(&p.D).Elem()
+		for _, c := range r.Schema.Columns {
+			f := v.FieldByIndex(c.index)
+			if f.Kind() != reflect.Pointer || f.IsNil() {
+				continue
+			}
+			qb.WriteString(" AND " + c.Name + " = ?")
+			args = append(args, f.Interface())
+		}
+	}
+	for _, f := range p.Filters {
+		qb.WriteString(" AND " + f.sql())
+		args = append(args, f.Args...)
+	}
+	return qb.String(), args
+}
+
+func (r *Repository[T]) scanTargets(row *Table[T], createdAt *sql.NullTime) []any {
+	targets := make([]any, 0, len(r.Schema.Columns)+4)
+	targets = append(targets, &row.ID)
+	if rec, ok := recordOf(&row.D); ok {
+		for _, c := range r.Schema.Columns {
+			targets = append(targets, recordField{rec, c})
+		}
+		return append(targets, createdAt, &row.UpdatedAt, &row.DeletedAt)
+	}
+	v := reflect.ValueOf(&row.D).Elem()
+	for _, c := range r.Schema.Columns {
+		targets = append(targets, v.FieldByIndex(c.index).Addr().Interface())
+	}
+	return append(targets, createdAt, &row.UpdatedAt, &row.DeletedAt)
+}
+
+func (r *Repository[T]) scanOne(row *sql.Row) (*Table[T], error) {
+	var t Table[T]
+	var createdAt sql.NullTime
+	if err := row.Scan(r.scanTargets(&t, &createdAt)...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	t.CreatedAt = createdAt.Time
+	return &t, nil
+}
+
+func (r *Repository[T]) scanAll(rows *sql.Rows) ([]Table[T], error) {
+	defer rows.Close()
+
+	list := []Table[T]{}
+	for rows.Next() {
+		var t Table[T]
+		var createdAt sql.NullTime
+		if err := rows.Scan(r.scanTargets(&t, &createdAt)...); err != nil {
+			return nil, err
+		}
+		t.CreatedAt = createdAt.Time
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
+
+func placeholders(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strings.Repeat("?, ", n-1) + "?"
+}
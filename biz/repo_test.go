@@ -0,0 +1,236 @@
+package biz
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	svr "github.com/axuman/go-server/svr"
+)
+
+// person 对应迁移创建的 users 表
+type person struct {
+	Name *string `json:"name" db:"name"`
+	Age  *int    `json:"age" db:"age"`
+}
+
+func (person) TableName() string { return "users" }
+
+var personRecord = &Schema{Table: "users", Entity: "person", Columns: []Column{
+	{Name: "name", Key: "name", Kind: KindString},
+	{Name: "age", Key: "age", Kind: KindInt},
+}}
+
+func ptr[V any](v V) *V { return &v }
+
+func migratedDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := svr.InitDB(svr.DBConfig{Path: filepath.Join(t.TempDir(), "test.db"), MaxOpenConns: 4, MaxIdleConns: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// events 返回 outbox 中 aggregate_id 对应的事件名
+func events(t *testing.T, db *sql.DB, id int64) []string {
+	t.Helper()
+	rows, err := db.Query("SELECT event FROM outbox WHERE aggregate = 'users' AND aggregate_id = ? ORDER BY id", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var list []string
+	for rows.Next() {
+		var e string
+		rows.Scan(&e)
+		list = append(list, e)
+	}
+	return list
+}
+
+func TestRepositoryCRUD(t *testing.T) {
+	db := migratedDB(t)
+	ctx := context.Background()
+	r := NewRepository[person](db)
+	r.Events = true
+
+	created, err := r.Create(ctx, &person{Name: ptr("alice"), Age: ptr(30)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := *created.ID
+	if *created.D.Name != "alice" || created.CreatedAt.IsZero() || created.DeletedAt != nil {
+		t.Fatalf("created = %+v", created)
+	}
+	got, err := r.Get(ctx, id)
+	if err != nil || *got.D.Name != "alice" || *got.D.Age != 30 {
+		t.Fatalf("Get = %+v, %v", got, err)
+	}
+	if _, err := r.Get(ctx, id+100); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get missing = %v", err)
+	}
+
+	// Patch 只更新非 nil 字段，Update 全量更新
+	patched, err := r.Patch(ctx, id, &person{Age: ptr(31)})
+	if err != nil || *patched.D.Name != "alice" || *patched.D.Age != 31 || !patched.UpdatedAt.Valid {
+		t.Fatalf("Patch = %+v, %v", patched, err)
+	}
+	if same, err := r.Patch(ctx, id, &person{}); err != nil || *same.D.Age != 31 {
+		t.Fatalf("empty Patch = %+v, %v", same, err)
+	}
+	updated, err := r.Update(ctx, id, &person{Name: ptr("bob"), Age: ptr(40)})
+	if err != nil || *updated.D.Name != "bob" || *updated.D.Age != 40 {
+		t.Fatalf("Update = %+v, %v", updated, err)
+	}
+	if _, err := r.Update(ctx, id, &person{Name: ptr("bob")}); err == nil {
+		t.Fatal("Update with a missing NOT NULL field should fail")
+	}
+
+	// 软删除后 Get、Update、Patch 都找不到，重复删除和恢复按实际行数返回
+	other, err := r.Create(ctx, &person{Name: ptr("carol"), Age: ptr(20)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := []struct {
+		name string
+		run  func() (int64, error)
+		want int64
+	}{
+		{"delete", func() (int64, error) { return r.SoftDelete(ctx, []int64{id, id + 100}) }, 1},
+		{"delete again", func() (int64, error) { return r.SoftDelete(ctx, []int64{id}) }, 0},
+		{"delete none", func() (int64, error) { return r.SoftDelete(ctx, nil) }, 0},
+		{"restore live", func() (int64, error) { return r.Restore(ctx, []int64{*other.ID}) }, 0},
+		{"count live", func() (int64, error) { return r.Count(ctx, &PaginatorWith[person]{}) }, 1},
+		{"count deleted", func() (int64, error) { return r.Count(ctx, &PaginatorWith[person]{Deleted: DeletedOnly}) }, 1},
+		{"count all", func() (int64, error) { return r.Count(ctx, &PaginatorWith[person]{Deleted: DeletedInclude}) }, 2},
+		{"count by name", func() (int64, error) {
+			return r.Count(ctx, &PaginatorWith[person]{D: person{Name: ptr("CAROL")}, Deleted: DeletedInclude})
+		}, 1},
+	}
+	for _, s := range steps {
+		if n, err := s.run(); err != nil || n != s.want {
+			t.Fatalf("%s = %d, %v, want %d", s.name, n, err, s.want)
+		}
+	}
+	if _, err := r.Get(ctx, id); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get soft-deleted = %v", err)
+	}
+	if _, err := r.Patch(ctx, id, &person{Age: ptr(1)}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Patch soft-deleted = %v", err)
+	}
+	if _, err := r.Update(ctx, id, &person{Name: ptr("x"), Age: ptr(1)}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Update soft-deleted = %v", err)
+	}
+	if n, err := r.Restore(ctx, []int64{id, *other.ID}); err != nil || n != 1 {
+		t.Fatalf("Restore = %d, %v", n, err)
+	}
+	if _, err := r.Get(ctx, id); err != nil {
+		t.Fatalf("Get restored = %v", err)
+	}
+
+	// 每次实际发生的变更各有一条事件，没有影响到行的操作不写事件
+	want := []string{"person.created", "person.updated", "person.updated", "person.deleted", "person.restored"}
+	if got := events(t, db, id); !slices.Equal(got, want) {
+		t.Fatalf("events = %v, want %v", got, want)
+	}
+}
+
+func TestRepositoryBatchCreateRollsBack(t *testing.T) {
+	db := migratedDB(t)
+	ctx := context.Background()
+	r := NewRepository[person](db)
+	r.Events = true
+
+	rows, err := r.BatchCreate(ctx, []person{{Name: ptr("a"), Age: ptr(1)}, {Name: ptr("b"), Age: ptr(2)}})
+	if err != nil || len(rows) != 2 || *rows[1].D.Name != "b" || *rows[1].ID != *rows[0].ID+1 {
+		t.Fatalf("BatchCreate = %+v, %v", rows, err)
+	}
+	if rows, err := r.BatchCreate(ctx, nil); err != nil || len(rows) != 0 {
+		t.Fatalf("empty BatchCreate = %+v, %v", rows, err)
+	}
+
+	// 第二条缺少 NOT NULL 的 age，整批都不写入，也没有事件
+	if _, err := r.BatchCreate(ctx, []person{{Name: ptr("c"), Age: ptr(3)}, {Name: ptr("d")}}); err == nil {
+		t.Fatal("expected a NOT NULL violation")
+	}
+	var users, outbox int
+	db.QueryRow("SELECT COUNT(*) FROM users").Scan(&users)
+	db.QueryRow("SELECT COUNT(*) FROM outbox").Scan(&outbox)
+	if users != 2 || outbox != 2 {
+		t.Fatalf("users = %d, outbox = %d", users, outbox)
+	}
+}
+
+// 调用方传入事务时，事件和数据变更一起提交或回滚
+func TestRepositoryEventsShareTransaction(t *testing.T) {
+	db := migratedDB(t)
+	ctx := context.Background()
+
+	for _, commit := range []bool{false, true} {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := NewRepository[person](tx)
+		r.Events = true
+		created, err := r.Create(ctx, &person{Name: ptr("tx"), Age: ptr(1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if commit {
+			err = tx.Commit()
+		} else {
+			err = tx.Rollback()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := 0
+		if commit {
+			want = 1
+		}
+		if got := events(t, db, *created.ID); len(got) != want {
+			t.Fatalf("commit = %v: events = %v", commit, got)
+		}
+	}
+
+	// 不开启 Events 时不写 outbox
+	r := NewRepository[person](db)
+	created, err := r.Create(ctx, &person{Name: ptr("quiet"), Age: ptr(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := events(t, db, *created.ID); len(got) != 0 {
+		t.Fatalf("events = %v", got)
+	}
+}
+
+// Record 的 Patch 区分缺省的 key 和值为 null 的 key
+func TestRepositoryPatchRecord(t *testing.T) {
+	db := migratedDB(t)
+	ctx := context.Background()
+	r := &Repository[Record]{DB: db, Schema: personRecord}
+
+	created, err := r.Create(ctx, &Record{"name": "alice", "age": 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := *created.ID
+	patched, err := r.Patch(ctx, id, &Record{"name": "bob"})
+	if err != nil || patched.D["name"] != "bob" || patched.D["age"] != int64(30) {
+		t.Fatalf("Patch = %+v, %v", patched, err)
+	}
+	// null 会写入 NULL，age 是 NOT NULL 所以失败，而不是被当成缺省跳过
+	if _, err := r.Patch(ctx, id, &Record{"age": nil}); err == nil {
+		t.Fatal("expected null to be written")
+	}
+	got, err := r.Get(ctx, id)
+	if err != nil || got.D["age"] != int64(30) {
+		t.Fatalf("Get = %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,180 @@
+package biz
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Kind 列的值类型，用于解析查询参数和生成扫描目标
+type Kind int
+
+const (
+	KindString Kind = iota
+	KindInt
+	KindFloat
+	KindBool
+	KindTime
+)
+
+// Column 模型中的一列
+type Column struct {
+	Name     string // 数据库列名
+	Key      string // JSON 字段名
+	Kind     Kind
+	Ops      []Op  // 允许的过滤操作符，来自 `filter` 标签
+	Sortable bool  // 是否允许排序，来自 `sort:"true"`，排序列必须 NOT NULL
+	index    []int // 在模型结构体中的字段位置
+}
+
+// Schema 由模型结构体标签推导出的表结构
+type Schema struct {
+	Table   string
+	Entity  string   // 类型名的 snake case，用作事件名前缀，例如 mall
+	Columns []Column // 不含 id、created_at、updated_at、deleted_at
+}
+
+// builtinColumns 每张表都有的公共列
+var builtinColumns = []Column{
+	{Name: "id", Key: "id", Kind: KindInt, Ops: []Op{OpEq, OpNe, OpGt, OpGte, OpLt, OpLte, OpIn, OpNin}, Sortable: true},
+	{Name: "created_at", Key: "created_at", Kind: KindTime, Ops: []Op{OpGt, OpGte, OpLt, OpLte}, Sortable: true},
+	{Name: "updated_at", Key: "updated_at", Kind: KindTime, Ops: []Op{OpGt, OpGte, OpLt, OpLte, OpNull}},
+}
+
+// Tabler 模型可以实现该接口自定义表名，否则使用类型名的复数小写形式
+type Tabler interface {
+	TableName() string
+}
+
+var schemas sync.Map // reflect.Type -> *Schema
+
+// SchemaOf 返回模型 T 的表结构，结果会被缓存
+//
+// 列名取 `db` 标签，没有时取 `json` 标签，`db:"-"` 的字段会被忽略。
+// `filter` 标签声明该列允许的过滤操作符，例如 `filter:"eq,gte,lte,in"`，
+// `sort:"true"` 声明该列可以排序。
+func SchemaOf[T any]() *Schema {
+	typ := reflect.TypeFor[T]()
+	if s, ok := schemas.Load(typ); ok {
+		return s.(*Schema)
+	}
+
+	s := &Schema{Table: tableName(typ), Entity: SnakeCase(typ.Name())}
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		key := tagName(f.Tag.Get("json"))
+		name := tagName(f.Tag.Get("db"))
+		if name == "-" {
+			continue
+		}
+		if key == "" || key == "-" {
+			key = SnakeCase(f.Name)
+		}
+		if name == "" {
+			name = key
+		}
+		s.Columns = append(s.Columns, Column{
+			Name:     name,
+			Key:      key,
+			Kind:     kindOf(f.Type),
+			Ops:      parseOps(f.Tag.Get("filter")),
+			Sortable: f.Tag.Get("sort") == "true",
+			index:    f.Index,
+		})
+	}
+
+	actual, _ := schemas.LoadOrStore(typ, s)
+	return actual.(*Schema)
+}
+
+// Column 按 JSON 字段名或列名查找列
+func (s *Schema) Column(key string) (Column, bool) {
+	for _, c := range s.Columns {
+		if c.Key == key || c.Name == key {
+			return c, true
+		}
+	}
+	return Column{}, false
+}
+
+// filterColumn 查找可过滤的列，包括公共列
+func (s *Schema) filterColumn(key string) (Column, bool) {
+	if c, ok := s.Column(key); ok {
+		return c, true
+	}
+	for _, c := range builtinColumns {
+		if c.Key == key {
+			return c, true
+		}
+	}
+	return Column{}, false
+}
+
+// columnList 返回 SELECT/RETURNING 使用的列，顺序与 scanTargets 对应
+func (s *Schema) columnList() string {
+	cols := make([]string, 0, len(s.Columns)+4)
+	cols = append(cols, "id")
+	for _, c := range s.Columns {
+		cols = append(cols, c.Name)
+	}
+	cols = append(cols, "created_at", "updated_at", "deleted_at")
+	return strings.Join(cols, ", ")
+}
+
+func tableName(typ reflect.Type) string {
+	if t, ok := reflect.New(typ).Interface().(Tabler); ok {
+		return t.TableName()
+	}
+	return SnakeCase(typ.Name()) + "s"
+}
+
+func tagName(tag string) string {
+	name, _, _ := strings.Cut(tag, ",")
+	return name
+}
+
+// SnakeCase 把类型名或字段名转换成 snake case，例如 OrderItem -> order_item
+func SnakeCase(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+var (
+	timeType     = reflect.TypeFor[time.Time]()
+	nullTimeType = reflect.TypeFor[sql.NullTime]()
+)
+
+func kindOf(t reflect.Type) Kind {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType || t == nullTimeType {
+		return KindTime
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return KindInt
+	case reflect.Float32, reflect.Float64:
+		return KindFloat
+	case reflect.Bool:
+		return KindBool
+	default:
+		return KindString
+	}
+}
@@ -0,0 +1,182 @@
+package biz
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CursorSecret 用于签名分页游标，多实例部署时需要配置成相同的值
+var CursorSecret = func() []byte {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return b
+}()
+
+const maxSortKeys = 4
+
+// SortKey 一个排序列，Desc 为 true 表示降序
+type SortKey struct {
+	Column Column
+	Desc   bool
+}
+
+// ParseSort 解析 sort=-created_at,name，只允许 `sort:"true"` 的列和 id、created_at
+//
+// 结果总是以 id 结尾作为唯一的决胜列，保证游标分页稳定。
+func (s *Schema) ParseSort(spec string) ([]SortKey, error) {
+	var keys []SortKey
+	seen := map[string]bool{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key := SortKey{}
+		if name, ok := strings.CutPrefix(part, "-"); ok {
+			key.Desc, part = true, name
+		} else {
+			part = strings.TrimPrefix(part, "+")
+		}
+		col, ok := s.filterColumn(part)
+		if !ok || !col.Sortable {
+			return nil, &QueryError{"sort", fmt.Sprintf("field %q is not sortable", part)}
+		}
+		if seen[col.Name] {
+			return nil, &QueryError{"sort", fmt.Sprintf("field %q appears more than once", part)}
+		}
+		seen[col.Name] = true
+		key.Column = col
+		keys = append(keys, key)
+		if col.Name == "id" {
+			break // id 唯一，之后的列不会影响顺序
+		}
+	}
+	if !seen["id"] {
+		keys = append(keys, SortKey{Column: builtinColumns[0]})
+	}
+	// 结尾的 id 不计入上限，显式写出和自动追加的结果相同
+	if len(keys)-1 > maxSortKeys {
+		return nil, &QueryError{"sort", fmt.Sprintf("at most %d sort fields", maxSortKeys)}
+	}
+	return keys, nil
+}
+
+// sortSpec 规范化后的排序描述，写入游标用于校验
+func sortSpec(keys []SortKey) string {
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k.Column.Name
+		if k.Desc {
+			parts[i] = "-" + parts[i]
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func orderBy(keys []SortKey) string {
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k.Column.Name + " ASC"
+		if k.Desc {
+			parts[i] = k.Column.Name + " DESC"
+		}
+	}
+	return " ORDER BY " + strings.Join(parts, ", ")
+}
+
+// keyset 生成 "位于游标之后" 的条件:
+// (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ...，降序列使用 <
+func keyset(keys []SortKey, values []any) (string, []any) {
+	var ors []string
+	var args []any
+	for i, k := range keys {
+		var ands []string
+		for j := 0; j < i; j++ {
+			ands = append(ands, keys[j].Column.Name+" = ?")
+			args = append(args, values[j])
+		}
+		cmp := " > ?"
+		if k.Desc {
+			cmp = " < ?"
+		}
+		ands = append(ands, k.Column.Name+cmp)
+		args = append(args, values[i])
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	return "(" + strings.Join(ors, " OR ") + ")", args
+}
+
+type cursorBody struct {
+	Sort   string   `json:"s"`
+	Values []string `json:"v"`
+}
+
+// encodeCursor 生成 base64(json).base64(hmac) 格式的不透明游标
+func encodeCursor(keys []SortKey, values []any) string {
+	body := cursorBody{Sort: sortSpec(keys)}
+	for _, v := range values {
+		body.Values = append(body.Values, cursorValue(v))
+	}
+	payload, _ := json.Marshal(body)
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(cursorMAC(payload))
+}
+
+// decodeCursor 校验签名和排序一致性，并按列类型还原游标中的值
+func decodeCursor(cursor string, keys []SortKey) ([]any, error) {
+	invalid := &QueryError{"cursor", "invalid cursor"}
+	enc := base64.RawURLEncoding
+	p, s, ok := strings.Cut(cursor, ".")
+	if !ok {
+		return nil, invalid
+	}
+	payload, err := enc.DecodeString(p)
+	if err != nil {
+		return nil, invalid
+	}
+	sig, err := enc.DecodeString(s)
+	if err != nil || !hmac.Equal(sig, cursorMAC(payload)) {
+		return nil, invalid
+	}
+
+	var body cursorBody
+	if err := json.Unmarshal(payload, &body); err != nil || len(body.Values) != len(keys) {
+		return nil, invalid
+	}
+	if body.Sort != sortSpec(keys) {
+		return nil, &QueryError{"cursor", "cursor does not match sort"}
+	}
+	values := make([]any, len(keys))
+	for i, k := range keys {
+		if values[i], err = k.Column.parse(body.Values[i]); err != nil {
+			return nil, invalid
+		}
+	}
+	return values, nil
+}
+
+func cursorMAC(payload []byte) []byte {
+	mac := hmac.New(sha256.New, CursorSecret)
+	mac.Write(payload)
+	return mac.Sum(nil)[:16]
+}
+
+func cursorValue(v any) string {
+	switch v := v.(type) {
+	case time.Time:
+		return v.UTC().Format(sqliteTime)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,239 @@
+package biz
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	svr "github.com/axuman/go-server/svr"
+)
+
+func TestParseSort(t *testing.T) {
+	s := SchemaOf[widget]()
+	tests := []struct {
+		spec string
+		want string // 规范化后的排序，为空表示出错
+		err  string
+	}{
+		{"", "id", ""},
+		{"name", "name,id", ""},
+		{"-age, +name", "-age,name,id", ""},
+		{"-created_at", "-created_at,id", ""},
+		{"-id,name", "-id", ""},
+		{"name,age,rank", "name,age,rank,id", ""},
+		{"price", "", `field "price" is not sortable`},
+		{"nope", "", `field "nope" is not sortable`},
+		{"name,-name", "", `field "name" appears more than once`},
+		{"name,age,rank,created_at", "name,age,rank,created_at,id", ""},
+		{"name,age,rank,created_at,id", "name,age,rank,created_at,id", ""},
+		{"name,age,rank,created_at,score", "", "at most 4 sort fields"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			keys, err := s.ParseSort(tt.spec)
+			if tt.err != "" {
+				var qe *QueryError
+				if !errors.As(err, &qe) || qe.Param != "sort" || qe.Msg != tt.err {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := sortSpec(keys); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyset(t *testing.T) {
+	keys, err := SchemaOf[widget]().ParseSort("-age,name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cond, args := keyset(keys, []any{int64(30), "bob", int64(7)})
+	want := "((age < ?) OR (age = ? AND name > ?) OR (age = ? AND name = ? AND id > ?))"
+	if cond != want {
+		t.Fatalf("cond = %s", cond)
+	}
+	if !reflect.DeepEqual(args, []any{int64(30), int64(30), "bob", int64(30), "bob", int64(7)}) {
+		t.Fatalf("args = %v", args)
+	}
+	if got := orderBy(keys); got != " ORDER BY age DESC, name ASC, id ASC" {
+		t.Fatalf("order by = %s", got)
+	}
+}
+
+func TestCursor(t *testing.T) {
+	s := SchemaOf[widget]()
+	keys, err := s.ParseSort("-age,name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := []any{int64(30), "bob", int64(7)}
+	cursor := encodeCursor(keys, values)
+	got, err := decodeCursor(cursor, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, values) {
+		t.Fatalf("got %v, want %v", got, values)
+	}
+
+	enc := base64.RawURLEncoding
+	payload, sig, _ := strings.Cut(cursor, ".")
+	// signed 用正确的密钥签名，检查签名通过之后的校验
+	signed := func(body string) string {
+		return enc.EncodeToString([]byte(body)) + "." + enc.EncodeToString(cursorMAC([]byte(body)))
+	}
+	forged := func(body string) string {
+		return enc.EncodeToString([]byte(body)) + "." + sig
+	}
+	flip := func(s string) string {
+		b := []byte(s)
+		if b[0] == 'A' {
+			b[0] = 'B'
+		} else {
+			b[0] = 'A'
+		}
+		return string(b)
+	}
+	otherKeys, _ := s.ParseSort("name")
+
+	tests := []struct {
+		name   string
+		cursor string
+		keys   []SortKey
+		err    string
+	}{
+		{"tampered payload", forged(`{"s":"-age,name,id","v":["99","bob","7"]}`), keys, "invalid cursor"},
+		{"tampered signature", payload + "." + flip(sig), keys, "invalid cursor"},
+		{"truncated signature", payload + "." + sig[:len(sig)-2], keys, "invalid cursor"},
+		{"no signature", payload, keys, "invalid cursor"},
+		{"not base64", "!!!." + sig, keys, "invalid cursor"},
+		{"not json", signed("nope"), keys, "invalid cursor"},
+		{"wrong value count", signed(`{"s":"-age,name,id","v":["30","bob"]}`), keys, "invalid cursor"},
+		{"wrong value type", signed(`{"s":"-age,name,id","v":["old","bob","7"]}`), keys, "invalid cursor"},
+		{"different sort", cursor, otherKeys, "invalid cursor"},
+		{"same length, different sort", signed(`{"s":"age,name,id","v":["30","bob","7"]}`), keys, "cursor does not match sort"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeCursor(tt.cursor, tt.keys)
+			var qe *QueryError
+			if !errors.As(err, &qe) || qe.Param != "cursor" || qe.Msg != tt.err {
+				t.Fatalf("err = %v, want %q", err, tt.err)
+			}
+		})
+	}
+
+	// 换了密钥（例如重启且没有配置固定密钥）之后旧游标失效
+	old := CursorSecret
+	CursorSecret = []byte("another secret")
+	defer func() { CursorSecret = old }()
+	if _, err := decodeCursor(cursor, keys); err == nil {
+		t.Fatal("cursor signed with another secret was accepted")
+	}
+}
+
+// 按任意排序翻页时每条记录恰好出现一次，翻页过程中插入记录不会造成重复或遗漏
+func TestListKeysetPagination(t *testing.T) {
+	db, err := svr.OpenDB(svr.DBConfig{Path: filepath.Join(t.TempDir(), "test.db"), MaxOpenConns: 1, MaxIdleConns: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE widgets (
+		id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL, age INTEGER NOT NULL, unit_price REAL, sold INTEGER,
+		note TEXT, rank INTEGER, score INTEGER, created_at DATETIME DEFAULT CURRENT_TIMESTAMP, updated_at DATETIME, deleted_at DATETIME)`); err != nil {
+		t.Fatal(err)
+	}
+	// 大量重复的 age 和 name，只有靠 id 才能区分
+	for i := range 23 {
+		if _, err := db.Exec("INSERT INTO widgets (name, age) VALUES (?, ?)", fmt.Sprintf("n%d", i%3), i%4); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repo := NewRepository[widget](db)
+	ctx := context.Background()
+
+	tests := []struct {
+		sort string
+		rows int // 翻页中途插入的记录排在还没翻到的位置时才会出现
+	}{
+		{"", 24},
+		{"-age,name", 23},
+		{"name,-age", 23},
+		{"-created_at", 24},
+	}
+	for _, tt := range tests {
+		sort := tt.sort
+		t.Run(sort, func(t *testing.T) {
+			seen := map[int64]bool{}
+			var order []int64
+			cursor := ""
+			for page := 0; ; page++ {
+				p := &PaginatorWith[widget]{PS: 5}
+				values := url.Values{"sort": {sort}}
+				if cursor != "" {
+					values.Set("cursor", cursor)
+				}
+				if err := p.ParseQuery(values); err != nil {
+					t.Fatal(err)
+				}
+				res, err := repo.List(ctx, p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, row := range res.Items {
+					if seen[*row.ID] {
+						t.Fatalf("page %d: id %d seen twice", page, *row.ID)
+					}
+					seen[*row.ID] = true
+					order = append(order, *row.ID)
+				}
+				if page == 1 {
+					// 新记录 id 最大、age 最大、name 最小、created_at 最早
+					if _, err := db.Exec("INSERT INTO widgets (name, age, created_at) VALUES ('a', 9, '2000-01-01')"); err != nil {
+						t.Fatal(err)
+					}
+					defer db.Exec("DELETE FROM widgets WHERE name = 'a'")
+				}
+				if !res.HasMore {
+					break
+				}
+				cursor = res.NextCursor
+			}
+			if len(order) != tt.rows {
+				t.Fatalf("got %d rows, want %d", len(order), tt.rows)
+			}
+
+			// 和一次性按同样顺序查询的结果一致
+			p := &PaginatorWith[widget]{PS: 100}
+			if err := p.ParseQuery(url.Values{"sort": {sort}}); err != nil {
+				t.Fatal(err)
+			}
+			all, err := repo.Find(ctx, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want []int64
+			for _, row := range all {
+				if seen[*row.ID] {
+					want = append(want, *row.ID)
+				}
+			}
+			if !reflect.DeepEqual(order, want) {
+				t.Fatalf("order = %v\nwant  %v", order, want)
+			}
+		})
+	}
+}
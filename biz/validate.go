@@ -0,0 +1,175 @@
+package biz
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/zh"
+	"github.com/go-playground/locales/zh_Hant_TW"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	zh_translations "github.com/go-playground/validator/v10/translations/zh"
+	zh_tw_translations "github.com/go-playground/validator/v10/translations/zh_tw"
+)
+
+var (
+	validate = validator.New()
+	uni      *ut.UniversalTranslator
+)
+
+// validationMessage AppError 的提示语，按语言区分
+var validationMessage = map[string]string{
+	"en":         "Validation failed",
+	"zh":         "参数校验失败",
+	"zh_Hant_TW": "參數校驗失敗",
+}
+
+func init() {
+	// 错误中使用 JSON 字段名而不是 Go 字段名
+	validate.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name := tagName(f.Tag.Get("json"))
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return f.Name
+		}
+		return name
+	})
+
+	enLocale, zhLocale, twLocale := en.New(), zh.New(), zh_Hant_TW.New()
+	uni = ut.New(enLocale, enLocale, zhLocale, twLocale)
+
+	register := []struct {
+		locale string
+		fn     func(*validator.Validate, ut.Translator) error
+	}{
+		{enLocale.Locale(), en_translations.RegisterDefaultTranslations},
+		{zhLocale.Locale(), zh_translations.RegisterDefaultTranslations},
+		{twLocale.Locale(), zh_tw_translations.RegisterDefaultTranslations},
+	}
+	for _, r := range register {
+		trans, _ := uni.GetTranslator(r.locale)
+		if err := r.fn(validate, trans); err != nil {
+			panic("register " + r.locale + " validation translations: " + err.Error())
+		}
+	}
+}
+
+// FieldError 单个字段的校验错误，Field 为 JSON 路径，例如 name 或 [2].name
+type FieldError struct {
+	Field   string `json:"field"`
+	Tag     string `json:"tag"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// Validate 校验结构体，失败时返回 details 为 []FieldError 的 AppError，
+// 错误信息按 acceptLanguage（请求头 Accept-Language）翻译，默认英文
+func Validate(v any, acceptLanguage string) error {
+	return validateItem(v, "", acceptLanguage)
+}
+
+// ValidateEach 校验批量请求中的每一项，字段路径带上下标
+func ValidateEach[T any](items []T, acceptLanguage string) error {
+	var all []FieldError
+	for i := range items {
+		err := validateItem(&items[i], "["+strconv.Itoa(i)+"].", acceptLanguage)
+		if err == nil {
+			continue
+		}
+		var ae *AppError
+		if !errors.As(err, &ae) {
+			return err
+		}
+		fields, ok := ae.Details.([]FieldError)
+		if !ok {
+			return err
+		}
+		all = append(all, fields...)
+	}
+	if len(all) > 0 {
+		return validationError(all, acceptLanguage)
+	}
+	return nil
+}
+
+// ValidatePatch 只校验 v 中非零值（非 nil 指针）的字段，与 Repository.Patch 会更新的字段一致
+func ValidatePatch(v any, acceptLanguage string) error {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	var fields []string
+	for i := 0; i < rv.NumField(); i++ {
+		if f := rv.Type().Field(i); f.IsExported() && !rv.Field(i).IsZero() {
+			fields = append(fields, f.Name)
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return translateErrors(validate.StructPartial(v, fields...), "", acceptLanguage)
+}
+
+func validateItem(v any, prefix, acceptLanguage string) error {
+	return translateErrors(validate.Struct(v), prefix, acceptLanguage)
+}
+
+// translateErrors 把 validator 的错误转换成 details 为 []FieldError 的 AppError
+func translateErrors(err error, prefix, acceptLanguage string) error {
+	if err == nil {
+		return nil
+	}
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		return err
+	}
+
+	trans := translator(acceptLanguage)
+	fields := make([]FieldError, len(errs))
+	for i, fe := range errs {
+		// Namespace 形如 User.name，去掉顶层结构体名
+		ns := fe.Namespace()
+		if _, rest, ok := strings.Cut(ns, "."); ok {
+			ns = rest
+		}
+		fields[i] = FieldError{
+			Field:   prefix + ns,
+			Tag:     fe.Tag(),
+			Param:   fe.Param(),
+			Message: fe.Translate(trans),
+		}
+	}
+	return validationError(fields, acceptLanguage)
+}
+
+func validationError(fields []FieldError, acceptLanguage string) *AppError {
+	ae := ValidationFailed(fields)
+	ae.Message = validationMessage[translator(acceptLanguage).Locale()]
+	return ae
+}
+
+// translator 按 Accept-Language 的顺序查找支持的语言，例如 "zh-CN,zh;q=0.9,en;q=0.8"
+func translator(acceptLanguage string) ut.Translator {
+	var locales []string
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, _, _ := strings.Cut(part, ";")
+		tag = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(tag)), "-", "_")
+		if tag == "" {
+			continue
+		}
+		switch {
+		case tag == "zh_tw" || tag == "zh_hk" || strings.HasPrefix(tag, "zh_hant"):
+			locales = append(locales, "zh_Hant_TW")
+		case strings.HasPrefix(tag, "zh"):
+			locales = append(locales, "zh")
+		default:
+			primary, _, _ := strings.Cut(tag, "_")
+			locales = append(locales, tag, primary)
+		}
+	}
+	trans, _ := uni.FindTranslator(locales...)
+	return trans
+}
@@ -0,0 +1,97 @@
+package biz
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+type signup struct {
+	UserName *string `json:"user_name" validate:"required,max=8"`
+	Age      *int    `json:"age" validate:"required,lte=150"`
+	Note     string  `json:"-" validate:"max=3"`
+}
+
+// fieldErrors 断言 err 是校验失败的 AppError 并返回其中的字段错误
+func fieldErrors(t *testing.T, err error) (*AppError, []FieldError) {
+	t.Helper()
+	var ae *AppError
+	if !errors.As(err, &ae) || ae.Status != http.StatusBadRequest || ae.Code != CodeValidation {
+		t.Fatalf("err = %v, want a validation error", err)
+	}
+	fields, ok := ae.Details.([]FieldError)
+	if !ok {
+		t.Fatalf("details = %T", ae.Details)
+	}
+	return ae, fields
+}
+
+func TestValidateLanguage(t *testing.T) {
+	tests := []struct {
+		acceptLanguage string
+		message        string
+		required       string
+	}{
+		{"", "Validation failed", "user_name is a required field"},
+		{"en-US,en;q=0.9", "Validation failed", "user_name is a required field"},
+		{"de-DE", "Validation failed", "user_name is a required field"},
+		{"zh-CN,zh;q=0.9,en;q=0.8", "参数校验失败", "user_name为必填字段"},
+		{"zh", "参数校验失败", "user_name为必填字段"},
+		{"zh-Hant-TW", "參數校驗失敗", "user_name為必填欄位"},
+		{"zh-TW", "參數校驗失敗", "user_name為必填欄位"},
+		{"fr;q=1, zh-HK;q=0.8", "參數校驗失敗", "user_name為必填欄位"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.acceptLanguage, func(t *testing.T) {
+			ae, fields := fieldErrors(t, Validate(&signup{Age: ptr(200)}, tt.acceptLanguage))
+			if ae.Message != tt.message {
+				t.Fatalf("message = %q, want %q", ae.Message, tt.message)
+			}
+			if len(fields) != 2 || fields[0].Message != tt.required {
+				t.Fatalf("fields = %+v", fields)
+			}
+		})
+	}
+}
+
+func TestValidateFieldNames(t *testing.T) {
+	_, fields := fieldErrors(t, Validate(&signup{UserName: ptr("much too long"), Age: ptr(200), Note: "long"}, "en"))
+	want := []FieldError{
+		{Field: "user_name", Tag: "max", Param: "8", Message: "user_name must be a maximum of 8 characters in length"},
+		{Field: "age", Tag: "lte", Param: "150", Message: "age must be 150 or less"},
+		{Field: "Note", Tag: "max", Param: "3", Message: "Note must be a maximum of 3 characters in length"},
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Fatalf("got %+v\nwant %+v", fields, want)
+	}
+	if err := Validate(&signup{UserName: ptr("ok"), Age: ptr(1)}, ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateEachAndPatch(t *testing.T) {
+	items := []signup{
+		{UserName: ptr("a"), Age: ptr(1)},
+		{Age: ptr(1)},
+		{UserName: ptr("c"), Age: ptr(151)},
+	}
+	_, fields := fieldErrors(t, ValidateEach(items, "zh"))
+	if len(fields) != 2 || fields[0].Field != "[1].user_name" || fields[1].Field != "[2].age" || fields[1].Message != "age必须小于或等于150" {
+		t.Fatalf("fields = %+v", fields)
+	}
+	if err := ValidateEach(items[:1], ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Patch 只校验出现的字段
+	if err := ValidatePatch(&signup{Age: ptr(1)}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidatePatch(&signup{}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, fields := fieldErrors(t, ValidatePatch(&signup{Age: ptr(151)}, "")); len(fields) != 1 || fields[0].Field != "age" {
+		t.Fatalf("fields = %+v", fields)
+	}
+}
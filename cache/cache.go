@@ -0,0 +1,333 @@
+// Package cache 进程内的分片缓存，支持按 key 过期、按条数和字节数的 LRU 淘汰，
+// 并发的未命中通过 singleflight 合并成一次加载。
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"hash/maphash"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrNotInteger = errors.New("value is not an integer or out of range")
+
+type Config struct {
+	Shards     int           // 默认 16
+	MaxEntries int           // 总条数上限，默认 100000
+	MaxBytes   int64         // key 和 value 的总字节数上限，默认 64MB
+	DefaultTTL time.Duration // Route 未指定 ttl 时使用，默认 30 秒
+}
+
+type entry struct {
+	key     string
+	value   []byte
+	expires int64 // UnixNano，0 表示不过期
+}
+
+func (e *entry) size() int64 {
+	return int64(len(e.key) + len(e.value))
+}
+
+type shard struct {
+	mu         sync.Mutex
+	items      map[string]*list.Element
+	lru        *list.List // 前面是最近使用的
+	bytes      int64
+	maxEntries int
+	maxBytes   int64
+}
+
+type Cache struct {
+	cfg    Config
+	seed   maphash.Seed
+	shards []*shard
+	flight group
+
+	versionsMu sync.Mutex
+	versions   map[string]uint64
+
+	hits, misses, evictions atomic.Int64
+
+	stop chan struct{}
+}
+
+func New(cfg Config) *Cache {
+	if cfg.Shards <= 0 {
+		cfg.Shards = 16
+	}
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = 100000
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = 64 << 20
+	}
+	if cfg.DefaultTTL <= 0 {
+		cfg.DefaultTTL = 30 * time.Second
+	}
+	c := &Cache{cfg: cfg, seed: maphash.MakeSeed(), versions: map[string]uint64{}, stop: make(chan struct{})}
+	for i := 0; i < cfg.Shards; i++ {
+		c.shards = append(c.shards, &shard{
+			items:      map[string]*list.Element{},
+			lru:        list.New(),
+			maxEntries: max(1, cfg.MaxEntries/cfg.Shards),
+			maxBytes:   max(1, cfg.MaxBytes/int64(cfg.Shards)),
+		})
+	}
+	go c.sweep()
+	return c
+}
+
+// Close 停止后台清理，之后仍然可以读写
+func (c *Cache) Close() {
+	close(c.stop)
+}
+
+func (c *Cache) shard(key string) *shard {
+	return c.shards[maphash.String(c.seed, key)%uint64(len(c.shards))]
+}
+
+// Get 返回 key 的值，调用方不能修改返回的切片
+func (c *Cache) Get(key string) ([]byte, bool) {
+	v, ok := c.peek(key)
+	if ok {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+	return v, ok
+}
+
+// peek 与 Get 相同但不计入命中率
+func (c *Cache) peek(key string) ([]byte, bool) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e := s.get(key, time.Now().UnixNano()); e != nil {
+		return e.value, true
+	}
+	return nil, false
+}
+
+// Set 写入 key，ttl <= 0 表示不过期
+func (c *Cache) Set(key string, value []byte, ttl time.Duration) {
+	s := c.shard(key)
+	s.mu.Lock()
+	c.evictions.Add(int64(s.set(key, value, expiresAt(ttl))))
+	s.mu.Unlock()
+}
+
+// Add 只在 key 不存在时写入，返回是否写入
+func (c *Cache) Add(key string, value []byte, ttl time.Duration) bool {
+	return c.setIf(key, value, ttl, false)
+}
+
+// Replace 只在 key 存在时写入，返回是否写入
+func (c *Cache) Replace(key string, value []byte, ttl time.Duration) bool {
+	return c.setIf(key, value, ttl, true)
+}
+
+func (c *Cache) setIf(key string, value []byte, ttl time.Duration, exists bool) bool {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if (s.get(key, time.Now().UnixNano()) != nil) != exists {
+		return false
+	}
+	c.evictions.Add(int64(s.set(key, value, expiresAt(ttl))))
+	return true
+}
+
+// Delete 删除 key，返回实际删除的个数
+func (c *Cache) Delete(keys ...string) int {
+	n := 0
+	now := time.Now().UnixNano()
+	for _, key := range keys {
+		s := c.shard(key)
+		s.mu.Lock()
+		if s.get(key, now) != nil {
+			s.remove(s.items[key])
+			n++
+		}
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// TTL 返回剩余有效期，不过期时为 -1，key 不存在时 ok 为 false
+func (c *Cache) TTL(key string) (ttl time.Duration, ok bool) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UnixNano()
+	e := s.get(key, now)
+	if e == nil {
+		return 0, false
+	}
+	if e.expires == 0 {
+		return -1, true
+	}
+	return time.Duration(e.expires - now), true
+}
+
+// Expire 修改有效期，ttl <= 0 表示不过期，key 不存在时返回 false
+func (c *Cache) Expire(key string, ttl time.Duration) bool {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.get(key, time.Now().UnixNano())
+	if e == nil {
+		return false
+	}
+	e.expires = expiresAt(ttl)
+	return true
+}
+
+// Incr 把十进制整数值加上 delta，key 不存在时从 0 开始，保留原有效期
+func (c *Cache) Incr(key string, delta int64) (int64, error) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n, expires int64
+	if e := s.get(key, time.Now().UnixNano()); e != nil {
+		var err error
+		if n, err = strconv.ParseInt(string(e.value), 10, 64); err != nil {
+			return 0, ErrNotInteger
+		}
+		expires = e.expires
+	}
+	if (delta > 0 && n > n+delta) || (delta < 0 && n < n+delta) {
+		return 0, ErrNotInteger
+	}
+	n += delta
+	c.evictions.Add(int64(s.set(key, strconv.AppendInt(nil, n, 10), expires)))
+	return n, nil
+}
+
+// GetOrLoad 命中时直接返回，否则调用 load 并缓存结果。
+// 同一个 key 的并发未命中只会调用一次 load，load 返回错误时不缓存。
+func (c *Cache) GetOrLoad(ctx context.Context, key string, ttl time.Duration, load func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	if v, ok := c.Get(key); ok {
+		return v, nil
+	}
+	return c.flight.do(key, func() ([]byte, error) {
+		if v, ok := c.peek(key); ok {
+			return v, nil
+		}
+		v, err := load(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.Set(key, v, ttl)
+		return v, nil
+	})
+}
+
+// Version 返回命名空间的当前版本，用于拼接 key；Bump 之后旧版本的 key 不会再被读到
+func (c *Cache) Version(ns string) uint64 {
+	c.versionsMu.Lock()
+	defer c.versionsMu.Unlock()
+	return c.versions[ns]
+}
+
+// Bump 使命名空间下的所有 key 失效，旧数据由 LRU 和过期清理回收
+func (c *Cache) Bump(ns string) {
+	c.versionsMu.Lock()
+	defer c.versionsMu.Unlock()
+	c.versions[ns]++
+}
+
+type Stats struct {
+	Entries   int   `json:"entries"`
+	Bytes     int64 `json:"bytes"`
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+}
+
+func (c *Cache) Stats() Stats {
+	st := Stats{Hits: c.hits.Load(), Misses: c.misses.Load(), Evictions: c.evictions.Load()}
+	for _, s := range c.shards {
+		s.mu.Lock()
+		st.Entries += len(s.items)
+		st.Bytes += s.bytes
+		s.mu.Unlock()
+	}
+	return st
+}
+
+// sweep 定期清理已过期但一直没有被访问的 key
+func (c *Cache) sweep() {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+		now := time.Now().UnixNano()
+		for _, s := range c.shards {
+			s.mu.Lock()
+			for el := s.lru.Back(); el != nil; {
+				prev := el.Prev()
+				if e := el.Value.(*entry); e.expires != 0 && e.expires <= now {
+					s.remove(el)
+				}
+				el = prev
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+func expiresAt(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return time.Now().Add(ttl).UnixNano()
+}
+
+// get 返回未过期的条目并移到 LRU 头部，过期的顺便删除
+func (s *shard) get(key string, now int64) *entry {
+	el, ok := s.items[key]
+	if !ok {
+		return nil
+	}
+	e := el.Value.(*entry)
+	if e.expires != 0 && e.expires <= now {
+		s.remove(el)
+		return nil
+	}
+	s.lru.MoveToFront(el)
+	return e
+}
+
+// set 写入条目，返回因超出上限淘汰的条数
+func (s *shard) set(key string, value []byte, expires int64) int {
+	e := &entry{key: key, value: value, expires: expires}
+	if el, ok := s.items[key]; ok {
+		s.bytes += e.size() - el.Value.(*entry).size()
+		el.Value = e
+		s.lru.MoveToFront(el)
+	} else {
+		s.items[key] = s.lru.PushFront(e)
+		s.bytes += e.size()
+	}
+
+	evicted := 0
+	for len(s.items) > s.maxEntries || (s.bytes > s.maxBytes && len(s.items) > 1) {
+		s.remove(s.lru.Back())
+		evicted++
+	}
+	return evicted
+}
+
+func (s *shard) remove(el *list.Element) {
+	e := s.lru.Remove(el).(*entry)
+	delete(s.items, e.key)
+	s.bytes -= e.size()
+}
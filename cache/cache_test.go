@@ -0,0 +1,214 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func keys(c *Cache, candidates ...string) []string {
+	var got []string
+	for _, k := range candidates {
+		if _, ok := c.peek(k); ok {
+			got = append(got, k)
+		}
+	}
+	return got
+}
+
+func TestEvictByEntries(t *testing.T) {
+	c := New(Config{Shards: 1, MaxEntries: 3})
+	for _, k := range []string{"a", "b", "c"} {
+		c.Set(k, []byte(k), 0)
+	}
+	c.Get("a") // a 变成最近使用，b 最先被淘汰
+	c.Set("d", []byte("d"), 0)
+	if got := keys(c, "a", "b", "c", "d"); len(got) != 3 || got[0] != "a" || got[1] != "c" {
+		t.Fatalf("keys = %v", got)
+	}
+	if st := c.Stats(); st.Entries != 3 || st.Evictions != 1 {
+		t.Fatalf("stats = %+v", st)
+	}
+}
+
+func TestEvictByBytes(t *testing.T) {
+	c := New(Config{Shards: 1, MaxBytes: 10})
+	c.Set("a", []byte("1234"), 0) // 5 字节
+	c.Set("b", []byte("1234"), 0)
+	if st := c.Stats(); st.Entries != 2 || st.Bytes != 10 {
+		t.Fatalf("stats = %+v", st)
+	}
+	c.Set("c", []byte("1234"), 0)
+	if got := keys(c, "a", "b", "c"); len(got) != 2 || got[0] != "b" {
+		t.Fatalf("keys = %v", got)
+	}
+	// 覆盖写入按新旧大小的差值计算
+	c.Set("c", []byte("12345678"), 0)
+	if got := keys(c, "a", "b", "c"); len(got) != 1 || got[0] != "c" {
+		t.Fatalf("keys = %v", got)
+	}
+	// 单个超过上限的条目仍然保留
+	c.Set("d", make([]byte, 100), 0)
+	if st := c.Stats(); st.Entries != 1 || st.Bytes != 101 {
+		t.Fatalf("stats = %+v", st)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	c := New(Config{})
+	c.Set("short", []byte("v"), 20*time.Millisecond)
+	c.Set("forever", []byte("v"), 0)
+	if ttl, ok := c.TTL("short"); !ok || ttl <= 0 || ttl > 20*time.Millisecond {
+		t.Fatalf("TTL = %v, %v", ttl, ok)
+	}
+	if ttl, ok := c.TTL("forever"); !ok || ttl != -1 {
+		t.Fatalf("TTL = %v, %v", ttl, ok)
+	}
+	if !c.Expire("forever", 20*time.Millisecond) || c.Expire("missing", time.Second) {
+		t.Fatal("Expire")
+	}
+	time.Sleep(30 * time.Millisecond)
+	for _, k := range []string{"short", "forever"} {
+		if _, ok := c.Get(k); ok {
+			t.Fatalf("%s did not expire", k)
+		}
+	}
+	if st := c.Stats(); st.Entries != 0 || st.Bytes != 0 {
+		t.Fatalf("stats = %+v", st)
+	}
+	// 过期的 key 可以重新 Add
+	if !c.Add("short", []byte("v"), 0) || c.Add("short", []byte("w"), 0) {
+		t.Fatal("Add")
+	}
+}
+
+func TestGetOrLoadSingleflight(t *testing.T) {
+	c := New(Config{})
+	var loads atomic.Int32
+	release := make(chan struct{})
+	load := func(ctx context.Context) ([]byte, error) {
+		loads.Add(1)
+		<-release
+		return []byte("v"), nil
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := c.GetOrLoad(context.Background(), "k", time.Minute, load)
+			if err == nil && string(v) != "v" {
+				err = errors.New("got " + string(v))
+			}
+			errs <- err
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := loads.Load(); n != 1 {
+		t.Fatalf("load called %d times", n)
+	}
+
+	// 加载失败不缓存
+	boom := errors.New("boom")
+	for range 2 {
+		if _, err := c.GetOrLoad(context.Background(), "bad", time.Minute, func(context.Context) ([]byte, error) {
+			loads.Add(1)
+			return nil, boom
+		}); err != boom {
+			t.Fatalf("err = %v", err)
+		}
+	}
+	if n := loads.Load(); n != 3 {
+		t.Fatalf("load called %d times", n)
+	}
+}
+
+func TestRouteAndInvalidate(t *testing.T) {
+	c := New(Config{})
+	var calls atomic.Int32
+	app := fiber.New()
+	app.Get("/q", c.Route("users", 0), func(ctx *fiber.Ctx) error {
+		calls.Add(1)
+		if ctx.Query("fail") != "" {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "bad"})
+		}
+		return ctx.JSON(fiber.Map{"data": []int{1}})
+	})
+	for _, method := range []string{"POST", "PUT", "DELETE"} {
+		app.Add(method, "/w", c.Invalidate("users"), func(ctx *fiber.Ctx) error { return ctx.SendStatus(fiber.StatusOK) })
+	}
+
+	do := func(method, path string, header ...string) string {
+		t.Helper()
+		req := httptest.NewRequest(method, path, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		res, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, res.Body)
+		return res.Header.Get(HeaderCache)
+	}
+
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		header []string
+		want   string
+		calls  int32
+	}{
+		{"first", "GET", "/q?b=2&a=1", nil, "MISS", 1},
+		{"params reordered", "GET", "/q?a=1&b=2", nil, "HIT", 1},
+		{"repeated values reordered", "GET", "/q?a=2&b=2&a=1", nil, "MISS", 2},
+		{"repeated values", "GET", "/q?a=1&a=2&b=2", nil, "HIT", 2},
+		{"no-cache", "GET", "/q?a=1&b=2", []string{"Cache-Control", "no-cache"}, "", 3},
+		{"create", "POST", "/w", nil, "", 3},
+		{"stale after create", "GET", "/q?a=1&b=2", nil, "MISS", 4},
+		{"cached again", "GET", "/q?b=2&a=1", nil, "HIT", 4},
+		{"update", "PUT", "/w", nil, "", 4},
+		{"stale after update", "GET", "/q?a=1&b=2", nil, "MISS", 5},
+		{"batch delete", "DELETE", "/w", nil, "", 5},
+		{"stale after delete", "GET", "/q?a=1&b=2", nil, "MISS", 6},
+		{"error not cached", "GET", "/q?fail=1", nil, "MISS", 7},
+		{"error again", "GET", "/q?fail=1", nil, "MISS", 8},
+	}
+	for _, s := range steps {
+		if got := do(s.method, s.path, s.header...); got != s.want || calls.Load() != s.calls {
+			t.Fatalf("%s: X-Cache = %q, calls = %d, want %q, %d", s.name, got, calls.Load(), s.want, s.calls)
+		}
+	}
+	if c.Version("users") != 3 {
+		t.Fatalf("version = %d", c.Version("users"))
+	}
+
+	// nil Cache 不缓存也不报错
+	var nilCache *Cache
+	app = fiber.New()
+	app.Get("/q", nilCache.Route("users", 0), func(ctx *fiber.Ctx) error { return ctx.SendStatus(http.StatusOK) })
+	app.Post("/w", nilCache.Invalidate("users"), func(ctx *fiber.Ctx) error { return ctx.SendStatus(http.StatusOK) })
+	if got := do("GET", "/q"); got != "" {
+		t.Fatalf("nil cache: X-Cache = %q", got)
+	}
+	do("POST", "/w")
+}
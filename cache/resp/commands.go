@@ -0,0 +1,257 @@
+package resp
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/axuman/go-server/cache"
+)
+
+const (
+	errSyntax     = "ERR syntax error"
+	errNotInteger = "ERR value is not an integer or out of range"
+	errExpire     = "ERR invalid expire time in 'set' command"
+)
+
+func cmdPing(c *conn, args [][]byte) {
+	if len(c.subs) > 0 { // 订阅模式下 PING 的回复格式不同
+		c.w.array(2)
+		c.w.bulk([]byte("pong"))
+		if len(args) > 0 {
+			c.w.bulk(args[0])
+		} else {
+			c.w.bulk(nil)
+		}
+		return
+	}
+	if len(args) > 0 {
+		c.w.bulk(args[0])
+		return
+	}
+	c.w.simple("PONG")
+}
+
+// cmdSelect 只有一个库
+func cmdSelect(c *conn, args [][]byte) {
+	if string(args[0]) != "0" {
+		c.w.error("ERR DB index is out of range")
+		return
+	}
+	c.w.simple("OK")
+}
+
+func cmdGet(c *conn, args [][]byte) {
+	if v, ok := c.s.cache.Get(string(args[0])); ok {
+		c.w.bulk(v)
+		return
+	}
+	c.w.null()
+}
+
+func cmdMGet(c *conn, args [][]byte) {
+	c.w.array(len(args))
+	for _, k := range args {
+		if v, ok := c.s.cache.Get(string(k)); ok {
+			c.w.bulk(v)
+		} else {
+			c.w.null()
+		}
+	}
+}
+
+// cmdSet SET key value [EX seconds | PX milliseconds] [NX | XX]
+func cmdSet(c *conn, args [][]byte) {
+	key, value := string(args[0]), args[1]
+	var ttl time.Duration
+	var nx, xx bool
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(string(args[i])); opt {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "EX", "PX":
+			if ttl != 0 || i+1 >= len(args) {
+				c.w.error(errSyntax)
+				return
+			}
+			i++
+			n, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				c.w.error(errNotInteger)
+				return
+			}
+			if n <= 0 {
+				c.w.error(errExpire)
+				return
+			}
+			if opt == "EX" {
+				ttl = time.Duration(n) * time.Second
+			} else {
+				ttl = time.Duration(n) * time.Millisecond
+			}
+		default:
+			c.w.error(errSyntax)
+			return
+		}
+	}
+
+	switch {
+	case nx && xx:
+		c.w.error(errSyntax)
+		return
+	case nx:
+		if !c.s.cache.Add(key, value, ttl) {
+			c.w.null()
+			return
+		}
+	case xx:
+		if !c.s.cache.Replace(key, value, ttl) {
+			c.w.null()
+			return
+		}
+	default:
+		c.s.cache.Set(key, value, ttl)
+	}
+	c.w.simple("OK")
+}
+
+func cmdSetEx(c *conn, args [][]byte) {
+	n, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		c.w.error(errNotInteger)
+		return
+	}
+	if n <= 0 {
+		c.w.error("ERR invalid expire time in 'setex' command")
+		return
+	}
+	c.s.cache.Set(string(args[0]), args[2], time.Duration(n)*time.Second)
+	c.w.simple("OK")
+}
+
+func cmdDel(c *conn, args [][]byte) {
+	c.w.integer(int64(c.s.cache.Delete(keys(args)...)))
+}
+
+func cmdExists(c *conn, args [][]byte) {
+	n := 0
+	for _, k := range args {
+		if _, ok := c.s.cache.TTL(string(k)); ok {
+			n++
+		}
+	}
+	c.w.integer(int64(n))
+}
+
+func cmdIncrBy(sign int64) func(c *conn, args [][]byte) {
+	return func(c *conn, args [][]byte) {
+		n, err := strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil {
+			c.w.error(errNotInteger)
+			return
+		}
+		incr(c, args[0], sign*n)
+	}
+}
+
+func incr(c *conn, key []byte, delta int64) {
+	n, err := c.s.cache.Incr(string(key), delta)
+	if errors.Is(err, cache.ErrNotInteger) {
+		c.w.error(errNotInteger)
+		return
+	}
+	c.w.integer(n)
+}
+
+// cmdExpire 和 Redis 一样，ttl <= 0 时直接删除 key
+func cmdExpire(unit time.Duration) func(c *conn, args [][]byte) {
+	return func(c *conn, args [][]byte) {
+		n, err := strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil {
+			c.w.error(errNotInteger)
+			return
+		}
+		key := string(args[0])
+		if n <= 0 {
+			c.w.integer(int64(c.s.cache.Delete(key)))
+			return
+		}
+		if c.s.cache.Expire(key, time.Duration(n)*unit) {
+			c.w.integer(1)
+		} else {
+			c.w.integer(0)
+		}
+	}
+}
+
+// cmdTTL key 不存在返回 -2，不过期返回 -1
+func cmdTTL(unit time.Duration) func(c *conn, args [][]byte) {
+	return func(c *conn, args [][]byte) {
+		ttl, ok := c.s.cache.TTL(string(args[0]))
+		switch {
+		case !ok:
+			c.w.integer(-2)
+		case ttl < 0:
+			c.w.integer(-1)
+		default:
+			c.w.integer(int64((ttl + unit/2) / unit))
+		}
+	}
+}
+
+func cmdPublish(c *conn, args [][]byte) {
+	c.w.integer(int64(c.s.Publish(string(args[0]), args[1])))
+}
+
+func cmdSubscribe(c *conn, args [][]byte) {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	for _, ch := range keys(args) {
+		c.subs[ch] = struct{}{}
+		if c.s.subs[ch] == nil {
+			c.s.subs[ch] = map[*conn]struct{}{}
+		}
+		c.s.subs[ch][c] = struct{}{}
+		c.w.array(3)
+		c.w.bulk([]byte("subscribe"))
+		c.w.bulk([]byte(ch))
+		c.w.integer(int64(len(c.subs)))
+	}
+}
+
+// cmdUnsubscribe 不带参数时退订全部
+func cmdUnsubscribe(c *conn, args [][]byte) {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	chs := keys(args)
+	if len(chs) == 0 {
+		for ch := range c.subs {
+			chs = append(chs, ch)
+		}
+	}
+	if len(chs) == 0 {
+		c.w.array(3)
+		c.w.bulk([]byte("unsubscribe"))
+		c.w.null()
+		c.w.integer(0)
+		return
+	}
+	for _, ch := range chs {
+		c.s.unsubscribe(c, ch)
+		c.w.array(3)
+		c.w.bulk([]byte("unsubscribe"))
+		c.w.bulk([]byte(ch))
+		c.w.integer(int64(len(c.subs)))
+	}
+}
+
+func keys(args [][]byte) []string {
+	list := make([]string, len(args))
+	for i, a := range args {
+		list[i] = string(a)
+	}
+	return list
+}
@@ -0,0 +1,182 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/axuman/go-server/cache"
+)
+
+func TestReadCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []string
+		err  error
+	}{
+		{"array", "*2\r\n$3\r\nGET\r\n$1\r\nk\r\n", []string{"GET", "k"}, nil},
+		{"binary bulk", "*2\r\n$4\r\nECHO\r\n$4\r\na\r\nb\r\n", []string{"ECHO", "a\r\nb"}, nil},
+		{"empty bulk", "*2\r\n$3\r\nGET\r\n$0\r\n\r\n", []string{"GET", ""}, nil},
+		{"empty array", "*0\r\n", []string{}, nil},
+		{"inline", "set  k v\r\n", []string{"set", "k", "v"}, nil},
+		{"inline without CR", "PING\n", []string{"PING"}, nil},
+		{"blank line", "\r\n", nil, nil},
+		{"bad array length", "*x\r\n", nil, errProtocol},
+		{"array too long", "*1048577\r\n", nil, errProtocol},
+		{"not a bulk", "*1\r\n:1\r\n", nil, errProtocol},
+		{"negative bulk", "*1\r\n$-1\r\n", nil, errProtocol},
+		{"bulk too long", "*1\r\n$67108865\r\n", nil, errProtocol},
+		{"bulk without CRLF", "*1\r\n$1\r\nab\r\n", nil, errProtocol},
+		{"truncated bulk", "*1\r\n$5\r\nab", nil, io.ErrUnexpectedEOF},
+		{"truncated array", "*2\r\n$1\r\na\r\n", nil, io.EOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := readCommand(bufio.NewReader(strings.NewReader(tt.in)))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if tt.err != nil {
+				return
+			}
+			var got []string
+			if args != nil {
+				got = make([]string, len(args))
+				for i, a := range args {
+					got[i] = string(a)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadCommandLineTooLong(t *testing.T) {
+	r := bufio.NewReaderSize(strings.NewReader(strings.Repeat("a", 64)+"\r\n"), 16)
+	if _, err := readCommand(r); !errors.Is(err, errProtocol) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func listen(t *testing.T, c *cache.Cache, password string) *Server {
+	t.Helper()
+	s := New(c, Config{Addr: "127.0.0.1:0", Password: password})
+	if err := s.ListenAndServe(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func dial(t *testing.T, s *Server) net.Conn {
+	t.Helper()
+	nc, err := net.Dial("tcp", s.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { nc.Close() })
+	nc.SetDeadline(time.Now().Add(5 * time.Second))
+	return nc
+}
+
+// roundTrip 发送原始请求并读取同样长度的回复
+func roundTrip(t *testing.T, nc net.Conn, req, want string) {
+	t.Helper()
+	if _, err := io.WriteString(nc, req); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(nc, got); err != nil {
+		t.Fatalf("%q: %v (got %q)", req, err, got)
+	}
+	if string(got) != want {
+		t.Fatalf("%q: got %q, want %q", req, got, want)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	nc := dial(t, listen(t, cache.New(cache.Config{}), ""))
+	tests := []struct {
+		req, want string
+	}{
+		{"PING\r\n", "+PONG\r\n"},
+		{"*2\r\n$4\r\nECHO\r\n$2\r\nhi\r\n", "$2\r\nhi\r\n"},
+		{"GET k\r\n", "$-1\r\n"},
+		{"SET k v\r\n", "+OK\r\n"},
+		{"GET k\r\n", "$1\r\nv\r\n"},
+		{"SET k w NX\r\n", "$-1\r\n"},
+		{"SET n 1 XX\r\n", "$-1\r\n"},
+		{"SET k v EX 0\r\n", "-ERR invalid expire time in 'set' command\r\n"},
+		{"SET k v NX XX\r\n", "-ERR syntax error\r\n"},
+		{"MGET k missing\r\n", "*2\r\n$1\r\nv\r\n$-1\r\n"},
+		{"TTL k\r\n", ":-1\r\n"},
+		{"EXPIRE k 100\r\n", ":1\r\n"},
+		{"TTL k\r\n", ":100\r\n"},
+		{"TTL missing\r\n", ":-2\r\n"},
+		{"INCR n\r\n", ":1\r\n"},
+		{"INCRBY n 10\r\n", ":11\r\n"},
+		{"DECRBY n 2\r\n", ":9\r\n"},
+		{"INCR k\r\n", "-ERR value is not an integer or out of range\r\n"},
+		{"EXISTS k n missing\r\n", ":2\r\n"},
+		{"DEL k n missing\r\n", ":2\r\n"},
+		{"SELECT 1\r\n", "-ERR DB index is out of range\r\n"},
+		{"GET\r\n", "-ERR wrong number of arguments for 'get' command\r\n"},
+		{"FLUSHALL\r\n", "-ERR unknown command 'flushall'\r\n"},
+		{"AUTH x\r\n", "-ERR AUTH <password> called without any password configured\r\n"},
+		// 管道中的多条命令一起回复
+		{"SET a 1\r\nINCR a\r\nGET a\r\n", "+OK\r\n:2\r\n$1\r\n2\r\n"},
+		{"*1\r\n$x\r\n", "-ERR Protocol error\r\n"},
+	}
+	for _, tt := range tests {
+		roundTrip(t, nc, tt.req, tt.want)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	nc := dial(t, listen(t, cache.New(cache.Config{}), "secret"))
+	roundTrip(t, nc, "GET k\r\n", "-NOAUTH Authentication required.\r\n")
+	roundTrip(t, nc, "AUTH wrong\r\n", "-WRONGPASS invalid username-password pair\r\n")
+	roundTrip(t, nc, "AUTH default secret\r\n", "+OK\r\n")
+	roundTrip(t, nc, "GET k\r\n", "$-1\r\n")
+}
+
+func TestPubSub(t *testing.T) {
+	s := listen(t, cache.New(cache.Config{}), "")
+	sub := dial(t, s)
+	roundTrip(t, sub, "SUBSCRIBE a b\r\n", "*3\r\n$9\r\nsubscribe\r\n$1\r\na\r\n:1\r\n*3\r\n$9\r\nsubscribe\r\n$1\r\nb\r\n:2\r\n")
+	roundTrip(t, sub, "GET k\r\n", "-ERR only (UN)SUBSCRIBE / PING / QUIT are allowed in this context\r\n")
+
+	pub := dial(t, s)
+	roundTrip(t, pub, "PUBLISH a hello\r\n", ":1\r\n")
+	roundTrip(t, sub, "", "*3\r\n$7\r\nmessage\r\n$1\r\na\r\n$5\r\nhello\r\n")
+	roundTrip(t, pub, "PUBLISH c x\r\n", ":0\r\n")
+
+	roundTrip(t, sub, "UNSUBSCRIBE a\r\n", "*3\r\n$11\r\nunsubscribe\r\n$1\r\na\r\n:1\r\n")
+	roundTrip(t, sub, "UNSUBSCRIBE\r\n", "*3\r\n$11\r\nunsubscribe\r\n$1\r\nb\r\n:0\r\n")
+	roundTrip(t, sub, "GET k\r\n", "$-1\r\n")
+	roundTrip(t, pub, "PUBLISH a x\r\n", ":0\r\n")
+}
+
+// RESP 使用独立的 Cache，客户端不能覆盖或删除接口缓存
+func TestKeyspaceIsolatedFromRouteCache(t *testing.T) {
+	routes := cache.New(cache.Config{})
+	key := "route:malls#0:/api/dmail/mall/q?"
+	routes.Set(key, []byte(`{"data":[]}`), time.Minute)
+
+	nc := dial(t, listen(t, cache.New(cache.Config{}), ""))
+	roundTrip(t, nc, "GET "+key+"\r\n", "$-1\r\n")
+	roundTrip(t, nc, "SET "+key+" forged\r\n", "+OK\r\n")
+	roundTrip(t, nc, "DEL "+key+"\r\n", ":1\r\n")
+
+	if v, ok := routes.Get(key); !ok || string(v) != `{"data":[]}` {
+		t.Fatalf("route cache entry = %q, %v", v, ok)
+	}
+}
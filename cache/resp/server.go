@@ -0,0 +1,300 @@
+// Package resp 让进程内缓存监听 TCP 或 Unix socket，支持 Redis 协议（RESP2）的一个子集，
+// Rust、JS 等服务可以直接用现有的 Redis 客户端读写共享缓存。
+// 传入的 Cache 不要和 Route 共用，否则客户端能伪造、删除或挤掉接口缓存。
+//
+// 支持的命令: PING ECHO GET SET(EX/PX/NX/XX) SETEX DEL EXISTS INCR INCRBY DECR DECRBY
+// EXPIRE PEXPIRE TTL PTTL MGET PUBLISH SUBSCRIBE UNSUBSCRIBE AUTH SELECT QUIT
+package resp
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/axuman/go-server/cache"
+)
+
+type Config struct {
+	Network  string // tcp（默认）或 unix
+	Addr     string // 例如 127.0.0.1:6380 或 /tmp/go-server.sock
+	Password string // 不为空时需要先 AUTH
+}
+
+type Server struct {
+	cfg   Config
+	cache *cache.Cache
+
+	mu     sync.Mutex
+	ln     net.Listener
+	conns  map[*conn]struct{}
+	subs   map[string]map[*conn]struct{} // channel -> 订阅者
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func New(c *cache.Cache, cfg Config) *Server {
+	if cfg.Network == "" {
+		cfg.Network = "tcp"
+	}
+	return &Server{cfg: cfg, cache: c, conns: map[*conn]struct{}{}, subs: map[string]map[*conn]struct{}{}}
+}
+
+// ListenAndServe 开始监听并在后台处理连接
+func (s *Server) ListenAndServe() error {
+	if s.cfg.Network == "unix" {
+		os.Remove(s.cfg.Addr) // 上次异常退出留下的 socket 文件
+	}
+	ln, err := net.Listen(s.cfg.Network, s.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.ln = ln
+	s.mu.Unlock()
+	log.Printf("resp: listening on %s %s", s.cfg.Network, ln.Addr())
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					log.Printf("resp: accept: %v", err)
+				}
+				return
+			}
+			s.serve(nc)
+		}
+	}()
+	return nil
+}
+
+// Close 停止监听并断开所有连接
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	if s.ln != nil {
+		err = s.ln.Close()
+	}
+	for c := range s.conns {
+		c.nc.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// Publish 向订阅了 channel 的客户端发送消息，返回接收者数量
+func (s *Server) Publish(channel string, msg []byte) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.subs[channel] {
+		select {
+		case c.msgs <- [2][]byte{[]byte(channel), msg}:
+		default:
+			// 和 Redis 的输出缓冲区上限一样，跟不上的订阅者直接断开
+			log.Printf("resp: subscriber %s is too slow, disconnecting", c.nc.RemoteAddr())
+			c.nc.Close()
+		}
+	}
+	return len(s.subs[channel])
+}
+
+type conn struct {
+	s      *Server
+	nc     net.Conn
+	r      *bufio.Reader
+	wmu    sync.Mutex
+	w      writer
+	authed bool
+	subs   map[string]struct{}
+	msgs   chan [2][]byte
+}
+
+func (s *Server) serve(nc net.Conn) {
+	c := &conn{
+		s:      s,
+		nc:     nc,
+		r:      bufio.NewReaderSize(nc, 64<<10),
+		w:      writer{bufio.NewWriter(nc)},
+		authed: s.cfg.Password == "",
+		subs:   map[string]struct{}{},
+		msgs:   make(chan [2][]byte, 1024),
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		nc.Close()
+		return
+	}
+	s.conns[c] = struct{}{}
+	s.mu.Unlock()
+
+	s.wg.Add(2)
+	done := make(chan struct{})
+	go func() {
+		defer s.wg.Done()
+		c.pump(done)
+	}()
+	go func() {
+		defer s.wg.Done()
+		defer close(done)
+		c.loop()
+		s.drop(c)
+		nc.Close()
+	}()
+}
+
+// pump 把订阅的消息写给客户端
+func (c *conn) pump(done chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case m := <-c.msgs:
+			c.wmu.Lock()
+			c.w.array(3)
+			c.w.bulk([]byte("message"))
+			c.w.bulk(m[0])
+			c.w.bulk(m[1])
+			err := c.w.Flush()
+			c.wmu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (c *conn) loop() {
+	for {
+		args, err := readCommand(c.r)
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				c.wmu.Lock()
+				c.w.error("ERR " + err.Error())
+				c.w.Flush()
+				c.wmu.Unlock()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		c.wmu.Lock()
+		quit := c.exec(strings.ToUpper(string(args[0])), args[1:])
+		var err2 error
+		if c.r.Buffered() == 0 || quit { // 管道中的命令一起刷出
+			err2 = c.w.Flush()
+		}
+		c.wmu.Unlock()
+		if quit || err2 != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) drop(c *conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, c)
+	for ch := range c.subs {
+		s.unsubscribe(c, ch)
+	}
+}
+
+func (s *Server) unsubscribe(c *conn, ch string) {
+	delete(c.subs, ch)
+	delete(s.subs[ch], c)
+	if len(s.subs[ch]) == 0 {
+		delete(s.subs, ch)
+	}
+}
+
+// exec 执行一条命令并写入回复，返回 true 表示关闭连接
+func (c *conn) exec(cmd string, args [][]byte) bool {
+	w := c.w
+	if cmd == "QUIT" {
+		w.simple("OK")
+		return true
+	}
+	if cmd == "AUTH" {
+		pass := ""
+		if len(args) > 0 {
+			pass = string(args[len(args)-1]) // AUTH [username] password
+		}
+		if c.s.cfg.Password == "" {
+			w.error("ERR AUTH <password> called without any password configured")
+		} else if subtle.ConstantTimeCompare([]byte(pass), []byte(c.s.cfg.Password)) == 1 {
+			c.authed = true
+			w.simple("OK")
+		} else {
+			w.error("WRONGPASS invalid username-password pair")
+		}
+		return false
+	}
+	if !c.authed {
+		w.error("NOAUTH Authentication required.")
+		return false
+	}
+	if len(c.subs) > 0 && cmd != "SUBSCRIBE" && cmd != "UNSUBSCRIBE" && cmd != "PING" {
+		w.error("ERR only (UN)SUBSCRIBE / PING / QUIT are allowed in this context")
+		return false
+	}
+
+	h, ok := commands[cmd]
+	if !ok {
+		w.error(fmt.Sprintf("ERR unknown command '%s'", strings.ToLower(cmd)))
+		return false
+	}
+	if len(args) < h.minArgs || (h.maxArgs >= 0 && len(args) > h.maxArgs) {
+		w.error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd)))
+		return false
+	}
+	h.fn(c, args)
+	return false
+}
+
+type command struct {
+	minArgs, maxArgs int // maxArgs < 0 表示不限
+	fn               func(c *conn, args [][]byte)
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"PING":        {0, 1, cmdPing},
+		"ECHO":        {1, 1, func(c *conn, args [][]byte) { c.w.bulk(args[0]) }},
+		"SELECT":      {1, 1, cmdSelect},
+		"GET":         {1, 1, cmdGet},
+		"MGET":        {1, -1, cmdMGet},
+		"SET":         {2, -1, cmdSet},
+		"SETEX":       {3, 3, cmdSetEx},
+		"DEL":         {1, -1, cmdDel},
+		"EXISTS":      {1, -1, cmdExists},
+		"INCR":        {1, 1, func(c *conn, args [][]byte) { incr(c, args[0], 1) }},
+		"DECR":        {1, 1, func(c *conn, args [][]byte) { incr(c, args[0], -1) }},
+		"INCRBY":      {2, 2, cmdIncrBy(1)},
+		"DECRBY":      {2, 2, cmdIncrBy(-1)},
+		"EXPIRE":      {2, 2, cmdExpire(time.Second)},
+		"PEXPIRE":     {2, 2, cmdExpire(time.Millisecond)},
+		"TTL":         {1, 1, cmdTTL(time.Second)},
+		"PTTL":        {1, 1, cmdTTL(time.Millisecond)},
+		"PUBLISH":     {2, 2, cmdPublish},
+		"SUBSCRIBE":   {1, -1, cmdSubscribe},
+		"UNSUBSCRIBE": {0, -1, cmdUnsubscribe},
+		"COMMAND":     {0, -1, func(c *conn, args [][]byte) { c.w.array(0) }}, // redis-cli 连接时会调用
+		"CLIENT":      {1, -1, func(c *conn, args [][]byte) { c.w.simple("OK") }},
+	}
+}
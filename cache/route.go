@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const HeaderCache = "X-Cache"
+
+var errUncacheable = errors.New("cache: response is not cacheable")
+
+// Route 缓存 GET 请求的 200 JSON 响应，key 由 ns 的版本、路径和排序后的查询参数组成，
+// ttl <= 0 时使用 DefaultTTL。请求带 Cache-Control: no-cache 时跳过缓存。
+// c 为 nil 时不缓存。
+func (c *Cache) Route(ns string, ttl time.Duration) fiber.Handler {
+	if c == nil {
+		return func(ctx *fiber.Ctx) error { return ctx.Next() }
+	}
+	if ttl <= 0 {
+		ttl = c.cfg.DefaultTTL
+	}
+	return func(ctx *fiber.Ctx) error {
+		if ctx.Method() != fiber.MethodGet || ctx.Get(fiber.HeaderCacheControl) == "no-cache" {
+			return ctx.Next()
+		}
+
+		key := c.routeKey(ns, ctx)
+		leader := false
+		var handlerErr error
+		body, err := c.GetOrLoad(ctx.UserContext(), key, ttl, func(context.Context) ([]byte, error) {
+			leader = true
+			if handlerErr = ctx.Next(); handlerErr != nil {
+				return nil, handlerErr
+			}
+			if ctx.Response().StatusCode() != fiber.StatusOK {
+				return nil, errUncacheable
+			}
+			return bytes.Clone(ctx.Response().Body()), nil
+		})
+		if leader {
+			ctx.Set(HeaderCache, "MISS")
+			return handlerErr
+		}
+		if err != nil {
+			// 合并的那次请求失败了，自己再执行一次
+			return ctx.Next()
+		}
+		ctx.Set(HeaderCache, "HIT")
+		ctx.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return ctx.Send(body)
+	}
+}
+
+// Invalidate 在写操作之后使 ns 下的 Route 缓存失效，c 为 nil 时什么都不做
+func (c *Cache) Invalidate(ns string) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		err := ctx.Next()
+		if c != nil {
+			c.Bump(ns)
+		}
+		return err
+	}
+}
+
+// routeKey 查询参数按 key 和 value 排序，参数顺序不同的请求共用缓存
+func (c *Cache) routeKey(ns string, ctx *fiber.Ctx) string {
+	query := string(ctx.Request().URI().QueryString())
+	if values, err := url.ParseQuery(query); err == nil {
+		for _, v := range values {
+			slices.Sort(v)
+		}
+		query = values.Encode()
+	}
+	return "route:" + ns + "#" + strconv.FormatUint(c.Version(ns), 10) + ":" + ctx.Path() + "?" + query
+}
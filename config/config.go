@@ -0,0 +1,277 @@
+// Package config 配置中心：按 默认值 < 配置文件 < 环境变量 < 命令行参数 的优先级加载，
+// 启动时校验，运行中轮询配置文件，带 reload:"true" 标记的字段可以热更新。
+//
+// 配置文件支持 TOML、YAML 和 JSON，按扩展名区分。每个字段对应:
+//
+//	文件    [server] addr = ":3001"（YAML 为 server: {addr: ":3001"}）
+//	环境变量 GOSERVER_SERVER_ADDR=:3001（env 标记的旧变量名同样有效）
+//	参数    -server.addr=:3001
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Duration 在文件、环境变量和参数中都写成 "5s" 这样的字符串
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+type Config struct {
+	Server     ServerConfig     `key:"server"`
+	DB         DBConfig         `key:"db"`
+	Log        LogConfig        `key:"log"`
+	RateLimit  RateLimitConfig  `key:"ratelimit"`
+	Shield     ShieldConfig     `key:"shield"`
+	Sign       SignConfig       `key:"sign"`
+	Crypt      CryptConfig      `key:"crypt"`
+	Gateway    GatewayConfig    `key:"gateway"`
+	Resilience ResilienceConfig `key:"resilience"`
+	MQ         MQConfig         `key:"mq"`
+	Outbox     OutboxConfig     `key:"outbox"`
+	Cache      CacheConfig      `key:"cache"`
+	RESP       RESPConfig       `key:"resp"`
+	IPC        IPCConfig        `key:"ipc"`
+	Sidecar    SidecarConfig    `key:"sidecar"`
+	LowCode    LowCodeConfig    `key:"lowcode"`
+	Purge      PurgeConfig      `key:"purge"`
+	Cursor     CursorConfig     `key:"cursor"`
+	Admin      AdminConfig      `key:"admin"`
+}
+
+type ServerConfig struct {
+	Addr            string   `key:"addr"`
+	DrainDelay      Duration `key:"drain_delay"`      // /health 变为 503 后等待负载均衡摘除流量
+	ShutdownTimeout Duration `key:"shutdown_timeout"` // 等待进行中的请求和清理函数的最长时间
+}
+
+type DBConfig struct {
+	Path            string   `key:"path"`
+	MaxOpenConns    int      `key:"max_open_conns"`
+	MaxIdleConns    int      `key:"max_idle_conns"`
+	ConnMaxLifetime Duration `key:"conn_max_lifetime"`
+	Pragmas         []string `key:"pragmas"` // 为空时使用 svr.DefaultPragmas
+}
+
+type LogConfig struct {
+	Level string `key:"level" reload:"true"` // debug、info、warn、error
+}
+
+type RateLimitConfig struct {
+	Enabled bool    `key:"enabled" reload:"true"`
+	RPS     float64 `key:"rps" reload:"true"`   // 每个 IP 每秒请求数
+	Burst   int     `key:"burst" reload:"true"` // 突发容量
+}
+
+type ShieldConfig struct {
+	Enabled      bool     `key:"enabled" env:"SHIELD_ENABLED"`
+	Secret       string   `key:"secret" env:"SHIELD_SECRET" secret:"true"`
+	Difficulty   int      `key:"difficulty"`
+	TTL          Duration `key:"ttl"`           // 通行 cookie 有效期
+	ChallengeTTL Duration `key:"challenge_ttl"` // 题目有效期
+	Routes       []string `key:"routes"`        // 启用 5秒盾的路由组，同 api.Policies 的键，为空时全部启用
+}
+
+type SignConfig struct {
+	Keys string `key:"keys" env:"SIGN_KEYS" secret:"true"` // app1:secret1,app1:old:2026-12-31,app2:secret2，为空时不启用
+}
+
+type CryptConfig struct {
+	Required    bool `key:"required" env:"CRYPT_REQUIRED"`
+	MaxSessions int  `key:"max_sessions"` // 会话数上限，超过后淘汰最久未使用的会话
+}
+
+type GatewayConfig struct {
+	Config string `key:"config" env:"GATEWAY_CONFIG"` // 网关路由文件，不存在时不启用
+}
+
+// ResilienceConfig 按路由组覆盖 api.Policies 中的超时和熔断策略
+type ResilienceConfig struct {
+	Routes []string `key:"routes"` // "dmail.user timeout=10s failure_threshold=50 open_for=30s half_open_max=2"
+}
+
+type MQConfig struct {
+	Path              string   `key:"path"` // 独立的 SQLite 文件
+	VisibilityTimeout Duration `key:"visibility_timeout"`
+	MaxAttempts       int      `key:"max_attempts"` // 超过后转入死信 topic
+	Retention         Duration `key:"retention"`    // 已确认消息的保留时间
+}
+
+type OutboxConfig struct {
+	PollInterval  Duration `key:"poll_interval"`
+	BatchSize     int      `key:"batch_size"`
+	MaxAttempts   int      `key:"max_attempts"` // 超过后事件标记为 dead，不再重试
+	Retention     Duration `key:"retention"`    // 已转发和 dead 事件的保留时间
+	Webhooks      []string `key:"webhooks"`     // 事件同时 POST 到这些地址
+	WebhookSecret string   `key:"webhook_secret" secret:"true"`
+	IPC           []string `key:"ipc"` // 事件同时通过 IPC 调用这些方法，service.method
+}
+
+type CacheConfig struct {
+	Enabled    bool     `key:"enabled"`
+	MaxEntries int      `key:"max_entries"`
+	MaxBytes   int64    `key:"max_bytes"`
+	ListTTL    Duration `key:"list_ttl"` // q 接口结果的缓存时间
+}
+
+// RESPConfig 以 Redis 协议对外提供一个独立的缓存，和接口缓存互不影响
+type RESPConfig struct {
+	Enabled    bool   `key:"enabled"`
+	Network    string `key:"network"` // tcp 或 unix
+	Addr       string `key:"addr"`    // 127.0.0.1:6380 或 socket 文件路径
+	Password   string `key:"password" secret:"true"`
+	MaxEntries int    `key:"max_entries"`
+	MaxBytes   int64  `key:"max_bytes"`
+}
+
+type IPCConfig struct {
+	Socket   string   `key:"socket"`   // 本服务的 IPC socket，sidecar 通过它注册自己，为空时不监听
+	Services []string `key:"services"` // 静态注册的服务，name=/path/to.sock
+	Routes   []string `key:"routes"`   // 暴露成 HTTP 接口的方法，"POST /rs/hash rust.hash [stream]"
+}
+
+type SidecarConfig struct {
+	Config string `key:"config"` // 子进程配置文件，不存在时不启用
+}
+
+// LowCodeConfig 运行时定义的实体，定义通过 /admin/entities 管理
+type LowCodeConfig struct {
+	Enabled bool `key:"enabled"` // 提供 /lc/<实体>/q 等接口
+}
+
+// PurgeConfig 定期硬删除软删除超过保留期的记录
+type PurgeConfig struct {
+	Retention Duration `key:"retention"`  // 为 0 时不清理，已删除的记录可以一直恢复
+	Interval  Duration `key:"interval"`   // 两次清理的间隔
+	BatchSize int      `key:"batch_size"` // 每批删除的行数，越小持有写锁的时间越短
+}
+
+type CursorConfig struct {
+	Secret string `key:"secret" secret:"true"` // 多实例部署时必须配置成相同的值
+}
+
+type AdminConfig struct {
+	Token string `key:"token" secret:"true"` // 为空时 /admin 只允许本机访问
+}
+
+// Default 返回默认配置
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:            ":3001",
+			DrainDelay:      Duration(3 * time.Second),
+			ShutdownTimeout: Duration(20 * time.Second),
+		},
+		DB: DBConfig{
+			Path:            "./dmail.db",
+			MaxOpenConns:    32,
+			MaxIdleConns:    8,
+			ConnMaxLifetime: Duration(5 * time.Minute),
+		},
+		Log:       LogConfig{Level: "info"},
+		RateLimit: RateLimitConfig{RPS: 50, Burst: 100},
+		Gateway:   GatewayConfig{Config: "./gateway.json"},
+		Sidecar:   SidecarConfig{Config: "./sidecars.json"},
+		Crypt:     CryptConfig{MaxSessions: 100000},
+		Shield:    ShieldConfig{TTL: Duration(30 * time.Minute), ChallengeTTL: Duration(2 * time.Minute)},
+		LowCode:   LowCodeConfig{Enabled: true},
+		Purge:     PurgeConfig{Interval: Duration(time.Hour), BatchSize: 500},
+		MQ: MQConfig{
+			Path:              "./mq.db",
+			VisibilityTimeout: Duration(30 * time.Second),
+			MaxAttempts:       5,
+			Retention:         Duration(24 * time.Hour),
+		},
+		Cache: CacheConfig{
+			Enabled:    true,
+			MaxEntries: 100000,
+			MaxBytes:   64 << 20,
+			ListTTL:    Duration(30 * time.Second),
+		},
+		RESP: RESPConfig{
+			Network:    "tcp",
+			Addr:       "127.0.0.1:6380",
+			MaxEntries: 100000,
+			MaxBytes:   64 << 20,
+		},
+		Outbox: OutboxConfig{
+			PollInterval: Duration(500 * time.Millisecond),
+			BatchSize:    100,
+			MaxAttempts:  20,
+			Retention:    Duration(7 * 24 * time.Hour),
+		},
+	}
+}
+
+// Validate 启动和热更新时校验配置
+func (c *Config) Validate() error {
+	var errs []string
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Sprintf(format, args...))
+		}
+	}
+	check(c.Server.Addr != "", "server.addr is required")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	check(c.Server.DrainDelay >= 0, "server.drain_delay must not be negative")
+	check(c.DB.Path != "", "db.path is required")
+	check(c.DB.MaxOpenConns > 0, "db.max_open_conns must be positive")
+	check(c.DB.MaxIdleConns >= 0 && c.DB.MaxIdleConns <= c.DB.MaxOpenConns, "db.max_idle_conns must be between 0 and db.max_open_conns")
+	_, err := c.Log.SlogLevel()
+	check(err == nil, "log.level must be one of debug, info, warn, error")
+	check(!c.RateLimit.Enabled || c.RateLimit.RPS > 0, "ratelimit.rps must be positive")
+	check(!c.RateLimit.Enabled || c.RateLimit.Burst >= 1, "ratelimit.burst must be at least 1")
+	check(c.Shield.Secret == "" || len(c.Shield.Secret) >= 16, "shield.secret must be at least 16 bytes")
+	check(c.Shield.Difficulty >= 0 && c.Shield.Difficulty <= 32, "shield.difficulty must be between 0 and 32")
+	check(c.Shield.TTL > 0 && c.Shield.ChallengeTTL > 0, "shield.ttl and shield.challenge_ttl must be positive")
+	check(c.Crypt.MaxSessions > 0, "crypt.max_sessions must be positive")
+	for _, spec := range c.Resilience.Routes {
+		check(len(strings.Fields(spec)) > 1, "resilience.routes: %q must be \"<group> key=value ...\"", spec)
+	}
+	check(c.MQ.Path != "" && c.MQ.Path != c.DB.Path, "mq.path is required and must differ from db.path")
+	check(c.MQ.VisibilityTimeout > 0, "mq.visibility_timeout must be positive")
+	check(c.MQ.MaxAttempts > 0, "mq.max_attempts must be positive")
+	check(c.Outbox.PollInterval > 0, "outbox.poll_interval must be positive")
+	check(c.Outbox.BatchSize > 0, "outbox.batch_size must be positive")
+	check(c.Outbox.MaxAttempts > 0, "outbox.max_attempts must be positive")
+	for _, spec := range c.Outbox.IPC {
+		service, method, _ := strings.Cut(spec, ".")
+		check(service != "" && method != "", "outbox.ipc: %q must be service.method", spec)
+	}
+	for _, u := range c.Outbox.Webhooks {
+		check(strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://"), "outbox.webhooks: %q is not an http(s) URL", u)
+	}
+	check(!c.Cache.Enabled || c.Cache.MaxEntries > 0 && c.Cache.MaxBytes > 0 && c.Cache.ListTTL > 0,
+		"cache.max_entries, cache.max_bytes and cache.list_ttl must be positive")
+	check(!c.RESP.Enabled || (c.RESP.Network == "tcp" || c.RESP.Network == "unix") && c.RESP.Addr != "",
+		"resp.network must be tcp or unix and resp.addr is required")
+	check(!c.RESP.Enabled || c.RESP.MaxEntries > 0 && c.RESP.MaxBytes > 0,
+		"resp.max_entries and resp.max_bytes must be positive")
+	for _, svc := range c.IPC.Services {
+		name, socket, _ := strings.Cut(svc, "=")
+		check(name != "" && socket != "", "ipc.services: %q must be name=/path/to.sock", svc)
+	}
+	check(c.Purge.Retention >= 0, "purge.retention must not be negative")
+	check(c.Purge.Retention == 0 || c.Purge.Interval > 0 && c.Purge.BatchSize > 0,
+		"purge.interval and purge.batch_size must be positive")
+	check(c.Cursor.Secret == "" || len(c.Cursor.Secret) >= 16, "cursor.secret must be at least 16 bytes")
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (l LogConfig) SlogLevel() (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(l.Level))
+	return level, err
+}
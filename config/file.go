@@ -0,0 +1,86 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// parseFile 按扩展名解析 .toml、.yaml/.yml 或 .json 配置文件，
+// 嵌套的表展开成 "table.key" -> string 或 []string
+func parseFile(path string, data []byte) (map[string]any, error) {
+	doc := map[string]any{}
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &doc)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	default:
+		_, err = toml.Decode(string(data), &doc)
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]any{}
+	return out, flatten(out, "", doc)
+}
+
+func flatten(out map[string]any, prefix string, m map[string]any) error {
+	for k, v := range m {
+		if prefix != "" {
+			k = prefix + "." + k
+		}
+		switch v := v.(type) {
+		case map[string]any:
+			if err := flatten(out, k, v); err != nil {
+				return err
+			}
+		case []any:
+			list := make([]string, len(v))
+			for i, item := range v {
+				s, ok := scalar(item)
+				if !ok {
+					return fmt.Errorf("%s: nested arrays and objects are not supported", k)
+				}
+				list[i] = s
+			}
+			out[k] = list
+		case nil:
+		default:
+			s, ok := scalar(v)
+			if !ok {
+				return fmt.Errorf("%s: unsupported value %v", k, v)
+			}
+			out[k] = s
+		}
+	}
+	return nil
+}
+
+// scalar 把各格式解码出的标量统一成字符串，再由 Config.set 按字段类型解析
+func scalar(v any) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	case int:
+		return strconv.Itoa(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case uint64:
+		return strconv.FormatUint(v, 10), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case time.Time:
+		return v.Format(time.RFC3339Nano), true
+	}
+	return "", false
+}
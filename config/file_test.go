@@ -0,0 +1,215 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseFile(t *testing.T) {
+	want := map[string]any{
+		"server.addr":        ":8080",
+		"server.drain_delay": "2s",
+		"db.max_open_conns":  "16",
+		"ratelimit.enabled":  "true",
+		"ratelimit.rps":      "12.5",
+		"outbox.webhooks":    []string{"http://a", "http://b"},
+	}
+	tests := []struct {
+		path string
+		data string
+	}{
+		{"c.toml", `
+# comment
+[server]
+addr = ":8080" # trailing comment
+drain_delay = "2s"
+
+[db]
+max_open_conns = 16
+
+[ratelimit]
+enabled = true
+rps = 12.5
+
+[outbox]
+webhooks = [
+  "http://a",
+  "http://b",
+]
+`},
+		{"c.yaml", `
+server:
+  addr: ":8080"
+  drain_delay: 2s
+db:
+  max_open_conns: 16
+ratelimit:
+  enabled: true
+  rps: 12.5
+outbox:
+  webhooks:
+    - http://a
+    - http://b
+`},
+		{"c.json", `{
+  "server": {"addr": ":8080", "drain_delay": "2s"},
+  "db": {"max_open_conns": 16},
+  "ratelimit": {"enabled": true, "rps": 12.5},
+  "outbox": {"webhooks": ["http://a", "http://b"]}
+}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := parseFile(tt.path, []byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %v\nwant %v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseFileErrors(t *testing.T) {
+	tests := []struct {
+		path string
+		data string
+	}{
+		{"c.toml", "[server\naddr = 1"},
+		{"c.toml", "[server]\naddr = 1\naddr = 2"},
+		{"c.toml", "[outbox]\nwebhooks = [[1]]"},
+		{"c.yaml", "server: [1\n"},
+		{"c.yaml", "outbox:\n  webhooks:\n    - {a: 1}\n"},
+		{"c.json", `{"server": `},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path+" "+tt.data, func(t *testing.T) {
+			if _, err := parseFile(tt.path, []byte(tt.data)); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	data := "[server]\naddr = \":1\"\n[log]\nlevel = \"warn\"\n[ratelimit]\nburst = 7\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOSERVER_LOG_LEVEL", "error")
+	t.Setenv("GOSERVER_SERVER_ADDR", ":2")
+
+	src, err := parseFlags([]string{"-config", path, "-server.addr=:3", "-cache.enabled=false"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := src.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{"flag over env over file", cfg.Server.Addr, ":3"},
+		{"env over file", cfg.Log.Level, "error"},
+		{"file over default", cfg.RateLimit.Burst, 7},
+		{"default", time.Duration(cfg.Server.ShutdownTimeout), 20 * time.Second},
+		{"bool flag", cfg.Cache.Enabled, false},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoadRejectsUnknownKeyAndInvalidValue(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"unknown.toml": "[server]\nport = 1\n",
+		"invalid.toml": "[db]\nmax_open_conns = \"many\"\n",
+		"failed.toml":  "[db]\nmax_open_conns = 0\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		src := &source{path: path, flags: map[string]string{}}
+		if _, err := src.load(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+// int64 字段（cache.max_bytes、resp.max_bytes）从文件、环境变量和命令行都能设置
+func TestLoadInt64(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte("[cache]\nmax_bytes = 1234\n[resp]\nmax_bytes = 4321\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		env   map[string]string
+		flags []string
+		cache int64
+		resp  int64
+	}{
+		{"file", nil, nil, 1234, 4321},
+		{"env", map[string]string{"GOSERVER_CACHE_MAX_BYTES": "5678", "GOSERVER_RESP_MAX_BYTES": "8765"}, nil, 5678, 8765},
+		{"flag", map[string]string{"GOSERVER_CACHE_MAX_BYTES": "5678"}, []string{"-cache.max_bytes=999", "-resp.max_bytes=8589934592"}, 999, 8 << 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			src, err := parseFlags(append([]string{"-config", path, "-resp.enabled"}, tt.flags...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := src.load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Cache.MaxBytes != tt.cache || cfg.RESP.MaxBytes != tt.resp {
+				t.Fatalf("cache.max_bytes = %d, resp.max_bytes = %d", cfg.Cache.MaxBytes, cfg.RESP.MaxBytes)
+			}
+		})
+	}
+}
+
+// 每个字段的类型都能被 set 处理，不会静默忽略
+func TestSetEveryField(t *testing.T) {
+	def := Default()
+	for _, f := range fields() {
+		v := def.value(f)
+		raw := any(fmt.Sprint(v.Interface()))
+		if v.Kind() == reflect.Slice {
+			raw = []string{"a"}
+		}
+		cfg := Default()
+		if err := cfg.set(f, raw); err != nil {
+			t.Errorf("%s: %v", f.key, err)
+		}
+	}
+
+	cfg := Default()
+	for key, raw := range map[string]string{
+		"db.max_open_conns": "99999999999999999999",
+		"cache.max_bytes":   "1.5",
+		"ratelimit.rps":     "fast",
+	} {
+		f, _ := lookup(key)
+		if err := cfg.set(f, raw); err == nil {
+			t.Errorf("%s = %s: expected an error", key, raw)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const envPrefix = "GOSERVER_"
+
+// field 配置中的一个叶子字段，key 形如 server.addr
+type field struct {
+	key    string
+	env    []string // 按优先级从低到高
+	reload bool
+	secret bool
+	index  []int
+}
+
+var fields = sync.OnceValue(func() []field {
+	var list []field
+	root := reflect.TypeOf(Config{})
+	for i := 0; i < root.NumField(); i++ {
+		section := root.Field(i)
+		for j := 0; j < section.Type.NumField(); j++ {
+			sf := section.Type.Field(j)
+			key := section.Tag.Get("key") + "." + sf.Tag.Get("key")
+			f := field{
+				key:    key,
+				reload: sf.Tag.Get("reload") == "true",
+				secret: sf.Tag.Get("secret") == "true",
+				index:  []int{i, j},
+			}
+			if legacy := sf.Tag.Get("env"); legacy != "" {
+				f.env = append(f.env, legacy)
+			}
+			f.env = append(f.env, envPrefix+strings.ToUpper(strings.ReplaceAll(key, ".", "_")))
+			list = append(list, f)
+		}
+	}
+	return list
+})
+
+func lookup(key string) (field, bool) {
+	for _, f := range fields() {
+		if f.key == key {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+func (c *Config) value(f field) reflect.Value {
+	return reflect.ValueOf(c).Elem().FieldByIndex(f.index)
+}
+
+var durationType = reflect.TypeOf(Duration(0))
+
+// set 把字符串（或文件中的数组）写入字段
+func (c *Config) set(f field, raw any) error {
+	v := c.value(f)
+	if v.Kind() == reflect.Slice {
+		switch raw := raw.(type) {
+		case []string:
+			v.Set(reflect.ValueOf(raw))
+		case string:
+			var list []string
+			for _, s := range strings.Split(raw, ",") {
+				if s = strings.TrimSpace(s); s != "" {
+					list = append(list, s)
+				}
+			}
+			v.Set(reflect.ValueOf(list))
+		}
+		return nil
+	}
+
+	s, ok := raw.(string)
+	if !ok {
+		return fmt.Errorf("%s: expected a single value", f.key)
+	}
+	var err error
+	switch {
+	case v.Type() == durationType:
+		var d time.Duration
+		if d, err = time.ParseDuration(s); err == nil {
+			v.SetInt(int64(d))
+		}
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+	case v.Kind() == reflect.Bool:
+		var b bool
+		if b, err = strconv.ParseBool(s); err == nil {
+			v.SetBool(b)
+		}
+	case v.CanInt():
+		var n int64
+		if n, err = strconv.ParseInt(s, 10, v.Type().Bits()); err == nil {
+			v.SetInt(n)
+		}
+	case v.CanUint():
+		var n uint64
+		if n, err = strconv.ParseUint(s, 10, v.Type().Bits()); err == nil {
+			v.SetUint(n)
+		}
+	case v.CanFloat():
+		var n float64
+		if n, err = strconv.ParseFloat(s, v.Type().Bits()); err == nil {
+			v.SetFloat(n)
+		}
+	default:
+		return fmt.Errorf("%s: unsupported type %s", f.key, v.Type())
+	}
+	if err != nil {
+		return fmt.Errorf("%s: invalid value %q", f.key, s)
+	}
+	return nil
+}
+
+// source 记录一次加载所需的输入，热更新时按同样的方式重新加载
+type source struct {
+	path     string            // 配置文件，为空表示没有
+	optional bool              // 默认路径的文件不存在时忽略
+	flags    map[string]string // 命令行中显式设置的参数
+}
+
+// parseFlags 解析 -config 和每个字段对应的 -<key> 参数
+func parseFlags(args []string) (*source, error) {
+	src := &source{flags: map[string]string{}}
+	fs := flag.NewFlagSet("go-server", flag.ContinueOnError)
+	fs.StringVar(&src.path, "config", "", "config file (.toml, .yaml or .json), default $GOSERVER_CONFIG or ./config.toml")
+	def := Default()
+	for _, f := range fields() {
+		store := func(s string) error {
+			src.flags[f.key] = s
+			return nil
+		}
+		usage := fmt.Sprintf("default %v, env %s", def.value(f), f.env[len(f.env)-1])
+		if def.value(f).Kind() == reflect.Bool {
+			fs.BoolFunc(f.key, usage, store)
+		} else {
+			fs.Func(f.key, usage, store)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if src.path == "" {
+		src.path = os.Getenv(envPrefix + "CONFIG")
+	}
+	if src.path == "" {
+		src.path, src.optional = "./config.toml", true
+	}
+	return src, nil
+}
+
+// load 默认值 < 配置文件 < 环境变量 < 命令行参数
+func (src *source) load() (*Config, error) {
+	cfg := Default()
+
+	if src.path != "" {
+		values, err := readFile(src.path)
+		if errors.Is(err, os.ErrNotExist) && src.optional {
+			values = nil
+		} else if err != nil {
+			return nil, err
+		}
+		for key, raw := range values {
+			f, ok := lookup(key)
+			if !ok {
+				return nil, fmt.Errorf("%s: unknown key %s", src.path, key)
+			}
+			if err := cfg.set(f, raw); err != nil {
+				return nil, fmt.Errorf("%s: %w", src.path, err)
+			}
+		}
+	}
+
+	for _, f := range fields() {
+		for _, name := range f.env {
+			if s, ok := os.LookupEnv(name); ok {
+				if err := cfg.set(f, s); err != nil {
+					return nil, fmt.Errorf("env %s: %w", name, err)
+				}
+			}
+		}
+		if s, ok := src.flags[f.key]; ok {
+			if err := cfg.set(f, s); err != nil {
+				return nil, fmt.Errorf("flag -%w", err)
+			}
+		}
+	}
+
+	return cfg, cfg.Validate()
+}
+
+func readFile(path string) (map[string]any, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values, err := parseFile(path, b)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// Redacted 返回按 section 分组的配置，密钥类字段用 ****** 代替
+func (c *Config) Redacted() map[string]map[string]any {
+	out := map[string]map[string]any{}
+	for _, f := range fields() {
+		section, key, _ := strings.Cut(f.key, ".")
+		if out[section] == nil {
+			out[section] = map[string]any{}
+		}
+		v := c.value(f).Interface()
+		if f.secret && !c.value(f).IsZero() {
+			v = "******"
+		}
+		out[section][key] = v
+	}
+	return out
+}
+
+// Reloadable 返回可以热更新的字段
+func Reloadable() []string {
+	var keys []string
+	for _, f := range fields() {
+		if f.reload {
+			keys = append(keys, f.key)
+		}
+	}
+	return keys
+}
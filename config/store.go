@@ -0,0 +1,129 @@
+package config
+
+import (
+	"context"
+	"log"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Store 持有当前生效的配置，热更新时整体替换
+type Store struct {
+	src      *source
+	cur      atomic.Pointer[Config]
+	loadedAt atomic.Pointer[time.Time]
+
+	mu      sync.Mutex
+	modTime time.Time
+	subs    []func(old, cfg *Config)
+}
+
+// Load 解析命令行参数（不含程序名）并加载配置，配置无效时返回错误
+func Load(args []string) (*Store, error) {
+	src, err := parseFlags(args)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := src.load()
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{src: src, modTime: modTime(src.path)}
+	s.store(cfg)
+	return s, nil
+}
+
+// Get 返回当前配置，调用方不能修改
+func (s *Store) Get() *Config {
+	return s.cur.Load()
+}
+
+// Path 配置文件路径，文件可能不存在
+func (s *Store) Path() string {
+	return s.src.path
+}
+
+func (s *Store) LoadedAt() time.Time {
+	return *s.loadedAt.Load()
+}
+
+// OnReload 注册热更新回调，只在可热更新的字段变化时调用
+func (s *Store) OnReload(fn func(old, cfg *Config)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subs = append(s.subs, fn)
+}
+
+// Watch 每隔 interval 检查配置文件的修改时间，变化时重新加载，直到 ctx 结束
+func (s *Store) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		mt := modTime(s.src.path)
+		s.mu.Lock()
+		changed := !mt.Equal(s.modTime)
+		s.modTime = mt
+		s.mu.Unlock()
+		if changed {
+			if err := s.Reload(); err != nil {
+				log.Printf("config: reload %s failed, keeping current config: %v", s.src.path, err)
+			}
+		}
+	}
+}
+
+// Reload 重新加载配置，只应用可热更新的字段，其他字段的变化需要重启才生效
+func (s *Store) Reload() error {
+	next, err := s.src.load()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.Get()
+	cfg := *old
+	changed := false
+	for _, f := range fields() {
+		nv := next.value(f)
+		if reflect.DeepEqual(nv.Interface(), old.value(f).Interface()) {
+			continue
+		}
+		if !f.reload {
+			log.Printf("config: %s changed, restart required to apply", f.key)
+			continue
+		}
+		log.Printf("config: %s reloaded", f.key)
+		cfg.value(f).Set(nv)
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	s.store(&cfg)
+	for _, fn := range s.subs {
+		fn(old, &cfg)
+	}
+	return nil
+}
+
+func (s *Store) store(cfg *Config) {
+	now := time.Now()
+	s.cur.Store(cfg)
+	s.loadedAt.Store(&now)
+}
+
+func modTime(path string) time.Time {
+	if fi, err := os.Stat(path); err == nil {
+		return fi.ModTime()
+	}
+	return time.Time{}
+}
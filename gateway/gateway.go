@@ -0,0 +1,336 @@
+// Package gateway 按配置把路径前缀反向代理到上游服务（Rust、JS 等），与本地 /dmail 路由并存。
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	t "github.com/axuman/go-server/biz"
+	"github.com/axuman/go-server/resilience"
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	CodeBadGateway      = "bad_gateway"
+	CodeUpstreamTimeout = "upstream_timeout"
+	CodeNoUpstream      = "no_healthy_upstream"
+)
+
+// Duration 支持在 JSON 中写 "5s" 这样的字符串
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		var n int64
+		if err := json.Unmarshal(b, &n); err != nil {
+			return fmt.Errorf("duration must be a string like \"5s\" or nanoseconds")
+		}
+		*d = Duration(n)
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// RouteConfig 一条代理路由
+type RouteConfig struct {
+	Prefix        string            `json:"prefix"`         // 例如 /rs
+	Upstreams     []string          `json:"upstreams"`      // 例如 http://127.0.0.1:8081
+	StripPrefix   bool              `json:"strip_prefix"`   // 转发时去掉 Prefix
+	SetHeaders    map[string]string `json:"set_headers"`    // 覆盖或新增请求头
+	RemoveHeaders []string          `json:"remove_headers"` // 删除请求头
+	Timeout       Duration          `json:"timeout"`        // 默认 10 秒
+	Pool          PoolConfig        `json:"pool"`           // 负载均衡和健康检查
+	Retry         RetryConfig       `json:"retry"`
+	Breaker       BreakerConfig     `json:"breaker"`
+}
+
+// RetryConfig 只重试幂等方法，连接失败、超时或状态码在 On 中时换一个实例重试
+type RetryConfig struct {
+	Attempts  int      `json:"attempts"`   // 最多重试次数，默认不重试
+	BaseDelay Duration `json:"base_delay"` // 默认 50ms
+	MaxDelay  Duration `json:"max_delay"`  // 默认 2s
+	On        []int    `json:"on"`         // 默认 502、503、504
+}
+
+// BreakerConfig 路由级熔断，上游连续失败 FailureThreshold 次后直接返回 503
+type BreakerConfig struct {
+	FailureThreshold int      `json:"failure_threshold"` // 0 表示不启用
+	OpenFor          Duration `json:"open_for"`          // 默认 30s
+	HalfOpenMax      int      `json:"half_open_max"`     // 默认 1
+}
+
+type Config struct {
+	Routes []RouteConfig `json:"routes"`
+}
+
+// LoadFile 读取 JSON 格式的网关配置
+func LoadFile(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+type route struct {
+	cfg     RouteConfig
+	name    string // 指标名
+	pool    *Pool
+	retry   resilience.Retry
+	breaker *resilience.Breaker
+}
+
+type Gateway struct {
+	routes []*route
+	client *fasthttp.Client
+}
+
+func New(cfg Config) (*Gateway, error) {
+	g := &Gateway{
+		client: &fasthttp.Client{
+			Name:                     "go-server-gateway",
+			NoDefaultUserAgentHeader: true,
+			MaxConnsPerHost:          512,
+			MaxIdleConnDuration:      time.Minute,
+			DisablePathNormalizing:   true,
+		},
+	}
+	for _, rc := range cfg.Routes {
+		if !strings.HasPrefix(rc.Prefix, "/") || rc.Prefix == "/" {
+			return nil, fmt.Errorf("gateway route prefix %q must start with / and not be the root", rc.Prefix)
+		}
+		rc.Prefix = strings.TrimRight(rc.Prefix, "/")
+		if len(rc.Upstreams) == 0 {
+			return nil, fmt.Errorf("gateway route %s has no upstreams", rc.Prefix)
+		}
+		if rc.Timeout <= 0 {
+			rc.Timeout = Duration(10 * time.Second)
+		}
+		var urls []*url.URL
+		for _, raw := range rc.Upstreams {
+			u, err := url.Parse(raw)
+			if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+				return nil, fmt.Errorf("gateway route %s: invalid upstream %q", rc.Prefix, raw)
+			}
+			u.Path = strings.TrimRight(u.Path, "/")
+			urls = append(urls, u)
+		}
+		pool, err := newPool(rc.Pool, urls)
+		if err != nil {
+			g.Close()
+			return nil, fmt.Errorf("gateway route %s: %w", rc.Prefix, err)
+		}
+		if len(rc.Retry.On) == 0 {
+			rc.Retry.On = []int{fiber.StatusBadGateway, fiber.StatusServiceUnavailable, fiber.StatusGatewayTimeout}
+		}
+		name := "gateway " + rc.Prefix
+		g.routes = append(g.routes, &route{
+			cfg:  rc,
+			name: name,
+			pool: pool,
+			retry: resilience.Retry{
+				Max:       rc.Retry.Attempts,
+				BaseDelay: time.Duration(rc.Retry.BaseDelay),
+				MaxDelay:  time.Duration(rc.Retry.MaxDelay),
+			},
+			breaker: resilience.NewBreaker(name, resilience.BreakerConfig{
+				FailureThreshold: rc.Breaker.FailureThreshold,
+				OpenFor:          time.Duration(rc.Breaker.OpenFor),
+				HalfOpenMax:      rc.Breaker.HalfOpenMax,
+			}),
+		})
+	}
+	return g, nil
+}
+
+// Close 停止所有健康检查
+func (g *Gateway) Close() {
+	for _, rt := range g.routes {
+		rt.pool.close()
+	}
+}
+
+// RouteStatus 管理接口返回的路由状态
+type RouteStatus struct {
+	Prefix    string           `json:"prefix"`
+	Strategy  string           `json:"strategy"`
+	Upstreams []UpstreamStatus `json:"upstreams"`
+}
+
+// Health 只返回健康实例的总数，不暴露上游地址，有路由没有健康实例时返回 503
+func (g *Gateway) Health(c *fiber.Ctx) error {
+	var healthy, total int
+	status := fiber.StatusOK
+	for _, rt := range g.routes {
+		n := 0
+		for _, u := range rt.pool.status() {
+			if u.Healthy {
+				n++
+			}
+			total++
+		}
+		if n == 0 {
+			status = fiber.StatusServiceUnavailable
+		}
+		healthy += n
+	}
+	return c.Status(status).JSON(fiber.Map{"healthy": healthy, "total": total})
+}
+
+// Status 返回各路由上游实例的健康状态，包括上游地址，只在 /admin 下提供
+func (g *Gateway) Status(c *fiber.Ctx) error {
+	list := make([]RouteStatus, len(g.routes))
+	for i, rt := range g.routes {
+		list[i] = RouteStatus{Prefix: rt.cfg.Prefix, Strategy: rt.pool.cfg.Strategy, Upstreams: rt.pool.status()}
+	}
+	return c.JSON(list)
+}
+
+// Mount 注册所有代理路由
+func (g *Gateway) Mount(router fiber.Router) {
+	for _, rt := range g.routes {
+		h := g.handler(rt)
+		router.All(rt.cfg.Prefix, h)
+		router.All(rt.cfg.Prefix+"/*", h)
+	}
+}
+
+func (g *Gateway) handler(rt *route) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := rt.breaker.Allow(); err != nil {
+			return err
+		}
+		resilience.Count(rt.name, "requests")
+		status, err := g.forward(c, rt)
+		rt.breaker.Record(err == nil && status < fiber.StatusInternalServerError)
+		return err
+	}
+}
+
+// forward 转发请求，幂等方法按 Retry 配置重试，返回上游的状态码
+func (g *Gateway) forward(c *fiber.Ctx, rt *route) (int, error) {
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+
+	attempts := 1
+	if resilience.Idempotent(c.Method()) {
+		attempts += rt.retry.Max
+	}
+	ctx := c.UserContext()
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			if rt.retry.Wait(ctx, i-1) != nil {
+				break
+			}
+			resilience.Count(rt.name, "retries")
+		}
+		up := rt.pool.pick(c)
+		if up == nil {
+			return fiber.StatusServiceUnavailable, t.NewError(fiber.StatusServiceUnavailable, CodeNoUpstream, "No healthy upstream")
+		}
+		timeout := rt.timeout(ctx)
+		if timeout <= 0 {
+			err = context.DeadlineExceeded
+			break
+		}
+
+		req.Reset()
+		resp.Reset()
+		c.Request().CopyTo(req)
+		rt.rewrite(c, req, up.URL)
+
+		up.active.Add(1)
+		err = g.client.DoTimeout(req, resp, timeout)
+		up.active.Add(-1)
+		rt.pool.report(up, err != nil || resp.StatusCode() >= fiber.StatusInternalServerError)
+		if err == nil && !slices.Contains(rt.cfg.Retry.On, resp.StatusCode()) {
+			break
+		}
+	}
+
+	if err != nil {
+		if errors.Is(err, fasthttp.ErrTimeout) || errors.Is(err, context.DeadlineExceeded) {
+			resilience.Count(rt.name, "timeouts")
+			return fiber.StatusGatewayTimeout, &t.AppError{Status: fiber.StatusGatewayTimeout, Code: CodeUpstreamTimeout, Message: "Upstream timed out", Err: err}
+		}
+		return fiber.StatusBadGateway, &t.AppError{Status: fiber.StatusBadGateway, Code: CodeBadGateway, Message: "Upstream unavailable", Err: err}
+	}
+
+	resp.CopyTo(c.Response())
+	for _, h := range hopHeaders {
+		c.Response().Header.Del(h)
+	}
+	return resp.StatusCode(), nil
+}
+
+// timeout 取路由超时和请求剩余时间中较小的一个
+func (rt *route) timeout(ctx context.Context) time.Duration {
+	d := time.Duration(rt.cfg.Timeout)
+	if deadline, ok := ctx.Deadline(); ok {
+		d = min(d, time.Until(deadline))
+	}
+	return d
+}
+
+// hopHeaders 逐跳头，不能转发
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+func (rt *route) rewrite(c *fiber.Ctx, req *fasthttp.Request, up *url.URL) {
+	path := c.Path()
+	if rt.cfg.StripPrefix {
+		path = strings.TrimPrefix(path, rt.cfg.Prefix)
+		if path == "" || path[0] != '/' {
+			path = "/" + path
+		}
+	}
+
+	uri := req.URI()
+	uri.SetScheme(up.Scheme)
+	uri.SetHost(up.Host)
+	uri.SetPath(up.Path + path)
+	req.SetHost(up.Host)
+
+	for _, h := range hopHeaders {
+		req.Header.Del(h)
+	}
+	req.Header.Set(fiber.HeaderXForwardedFor, c.IP())
+	req.Header.Set(fiber.HeaderXForwardedHost, c.Hostname())
+	req.Header.Set(fiber.HeaderXForwardedProto, c.Protocol())
+	if id, ok := c.Locals("requestid").(string); ok {
+		req.Header.Set(fiber.HeaderXRequestID, id)
+	}
+	for _, h := range rt.cfg.RemoveHeaders {
+		req.Header.Del(h)
+	}
+	for k, v := range rt.cfg.SetHeaders {
+		req.Header.Set(k, v)
+	}
+}
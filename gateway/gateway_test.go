@@ -0,0 +1,332 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/axuman/go-server/biz"
+	"github.com/gofiber/fiber/v2"
+)
+
+// upstream 启动一个返回自己名字的上游，h 不为空时由 h 处理
+func upstream(t *testing.T, name string, h http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	if h == nil {
+		h = func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, name) }
+	}
+	s := httptest.NewServer(h)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newGateway(t *testing.T, routes ...RouteConfig) (*Gateway, *fiber.App) {
+	t.Helper()
+	g, err := New(Config{Routes: routes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(g.Close)
+	app := fiber.New(fiber.Config{ErrorHandler: func(c *fiber.Ctx, err error) error {
+		var fe *fiber.Error
+		if errors.As(err, &fe) {
+			return c.Status(fe.Code).SendString(fe.Message)
+		}
+		ae := biz.AsAppError(err)
+		return c.Status(ae.Status).JSON(ae)
+	}})
+	g.Mount(app)
+	return g, app
+}
+
+func send(t *testing.T, app *fiber.App, req *http.Request) (int, string) {
+	t.Helper()
+	res, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(res.Body)
+	return res.StatusCode, string(b)
+}
+
+func get(t *testing.T, app *fiber.App, path string) (int, string) {
+	t.Helper()
+	return send(t, app, httptest.NewRequest("GET", path, nil))
+}
+
+// waitFor 轮询 cond，超时失败
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	echo := upstream(t, "", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"uri":           r.URL.RequestURI(),
+			"host":          r.Host,
+			"key":           r.Header.Get("X-Api-Key"),
+			"authorization": r.Header.Get("Authorization"),
+			"forwarded_for": r.Header.Get("X-Forwarded-For"),
+			"keep":          r.Header.Get("X-Keep"),
+		})
+	})
+	host := echo.Listener.Addr().String()
+	_, app := newGateway(t,
+		RouteConfig{
+			Prefix:        "/rs/",
+			Upstreams:     []string{echo.URL + "/base/"},
+			StripPrefix:   true,
+			SetHeaders:    map[string]string{"X-Api-Key": "secret"},
+			RemoveHeaders: []string{"Authorization"},
+		},
+		RouteConfig{Prefix: "/js", Upstreams: []string{echo.URL}},
+	)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/rs/a/b?x=1&y=2", "/base/a/b?x=1&y=2"},
+		{"/rs", "/base/"},
+		{"/js/feed?page=2", "/js/feed?page=2"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.Header.Set("Authorization", "Bearer token")
+		req.Header.Set("X-Api-Key", "client")
+		req.Header.Set("X-Keep", "1")
+		status, body := send(t, app, req)
+		var got map[string]string
+		if err := json.Unmarshal([]byte(body), &got); err != nil || status != http.StatusOK {
+			t.Fatalf("%s: %d %s", tt.path, status, body)
+		}
+		if got["uri"] != tt.want || got["host"] != host || got["keep"] != "1" || got["forwarded_for"] == "" {
+			t.Errorf("%s: got %v, want uri %s", tt.path, got, tt.want)
+		}
+		rewritten := tt.path[:3] == "/rs"
+		if rewritten && (got["key"] != "secret" || got["authorization"] != "") {
+			t.Errorf("%s: headers not rewritten: %v", tt.path, got)
+		}
+		if !rewritten && (got["key"] != "client" || got["authorization"] != "Bearer token") {
+			t.Errorf("%s: headers changed: %v", tt.path, got)
+		}
+	}
+	if status, _ := get(t, app, "/rsx"); status != http.StatusNotFound {
+		t.Fatalf("/rsx = %d, want 404", status)
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	a, b, c := upstream(t, "a", nil), upstream(t, "b", nil), upstream(t, "c", nil)
+	_, app := newGateway(t, RouteConfig{Prefix: "/rs", Upstreams: []string{a.URL, b.URL, c.URL}})
+	counts := map[string]int{}
+	last := ""
+	for range 9 {
+		_, name := get(t, app, "/rs")
+		if name == last {
+			t.Fatalf("%s picked twice in a row", name)
+		}
+		counts[name]++
+		last = name
+	}
+	if counts["a"] != 3 || counts["b"] != 3 || counts["c"] != 3 {
+		t.Fatalf("counts = %v", counts)
+	}
+}
+
+func TestLeastConn(t *testing.T) {
+	var urls []*url.URL
+	for _, s := range []string{"http://a", "http://b", "http://c"} {
+		u, _ := url.Parse(s)
+		urls = append(urls, u)
+	}
+	p, err := newPool(PoolConfig{Strategy: LeastConn}, urls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.upstreams[0].active.Store(3)
+	p.upstreams[1].active.Store(1)
+	p.upstreams[2].active.Store(2)
+	for range 5 {
+		if u := p.pick(nil); u != p.upstreams[1] {
+			t.Fatalf("picked %s", u.URL)
+		}
+	}
+	// 不可用的实例不参与比较
+	p.upstreams[1].healthy.Store(false)
+	if u := p.pick(nil); u != p.upstreams[2] {
+		t.Fatalf("picked %s", u.URL)
+	}
+}
+
+func TestConsistentHash(t *testing.T) {
+	a, b, c := upstream(t, "a", nil), upstream(t, "b", nil), upstream(t, "c", nil)
+	g, app := newGateway(t, RouteConfig{
+		Prefix:    "/rs",
+		Upstreams: []string{a.URL, b.URL, c.URL},
+		Pool:      PoolConfig{Strategy: ConsistentHash, HashKey: "header:X-User-ID"},
+	})
+	pick := func(user string) string {
+		req := httptest.NewRequest("GET", "/rs", nil)
+		req.Header.Set("X-User-ID", user)
+		_, name := send(t, app, req)
+		return name
+	}
+
+	first := map[string]string{}
+	used := map[string]bool{}
+	for i := range 60 {
+		user := "user" + strconv.Itoa(i)
+		first[user] = pick(user)
+		used[first[user]] = true
+		if again := pick(user); again != first[user] {
+			t.Fatalf("%s: %s then %s", user, first[user], again)
+		}
+	}
+	if len(used) < 2 {
+		t.Fatalf("keys only reached %v", used)
+	}
+
+	// 摘除 user0 所在的实例之后，只有原来落在它上面的 key 换实例
+	ejected := first["user0"]
+	g.routes[0].pool.upstreams[map[string]int{"a": 0, "b": 1, "c": 2}[ejected]].healthy.Store(false)
+	for user, was := range first {
+		now := pick(user)
+		if was == ejected && now == ejected || was != ejected && now != was {
+			t.Fatalf("%s: %s -> %s", user, was, now)
+		}
+	}
+
+	if _, err := New(Config{Routes: []RouteConfig{{Prefix: "/x", Upstreams: []string{a.URL}, Pool: PoolConfig{Strategy: ConsistentHash}}}}); err == nil {
+		t.Fatal("consistent_hash without hash_key should be rejected")
+	}
+}
+
+func TestHealthCheckEjectAndRecover(t *testing.T) {
+	var down atomic.Bool
+	flaky := upstream(t, "", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" && down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		io.WriteString(w, "flaky")
+	})
+	stable := upstream(t, "stable", nil)
+	g, app := newGateway(t, RouteConfig{
+		Prefix:    "/rs",
+		Upstreams: []string{flaky.URL, stable.URL},
+		Pool: PoolConfig{HealthCheck: HealthCheckConfig{
+			Path:               "/healthz",
+			Interval:           Duration(10 * time.Millisecond),
+			UnhealthyThreshold: 2,
+			HealthyThreshold:   2,
+		}},
+	})
+	healthy := func() bool { return g.routes[0].pool.upstreams[0].healthy.Load() }
+
+	down.Store(true)
+	waitFor(t, "the upstream to be ejected", func() bool { return !healthy() })
+	for range 4 {
+		if _, name := get(t, app, "/rs"); name != "stable" {
+			t.Fatalf("routed to %s while it is unhealthy", name)
+		}
+	}
+
+	down.Store(false)
+	waitFor(t, "the upstream to recover", healthy)
+	seen := map[string]bool{}
+	for range 4 {
+		_, name := get(t, app, "/rs")
+		seen[name] = true
+	}
+	if !seen["flaky"] {
+		t.Fatalf("recovered upstream not used: %v", seen)
+	}
+}
+
+func TestOutlierEjection(t *testing.T) {
+	bad := upstream(t, "", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, "bad")
+	})
+	good := upstream(t, "good", nil)
+	g, app := newGateway(t, RouteConfig{
+		Prefix:    "/rs",
+		Upstreams: []string{bad.URL, good.URL},
+		Pool:      PoolConfig{Outlier: OutlierConfig{ConsecutiveFailures: 2, EjectFor: Duration(time.Hour)}},
+	})
+
+	failures := 0
+	for range 10 {
+		if _, name := get(t, app, "/rs"); name == "bad" {
+			failures++
+		}
+	}
+	if failures != 2 {
+		t.Fatalf("bad upstream served %d requests, want 2 before ejection", failures)
+	}
+	st := g.routes[0].pool.status()
+	if st[0].EjectedUntil == nil || st[1].EjectedUntil != nil || st[0].Errors != 2 {
+		t.Fatalf("status = %+v", st)
+	}
+
+	// 最多摘除 50%，剩下的一个即使失败也不摘除
+	good.Close()
+	for range 6 {
+		get(t, app, "/rs")
+	}
+	if st := g.routes[0].pool.status(); st[1].EjectedUntil != nil {
+		t.Fatalf("ejected more than max_eject_percent: %+v", st)
+	}
+}
+
+func TestRetryOnStatus(t *testing.T) {
+	var calls atomic.Int32
+	up := upstream(t, "", func(w http.ResponseWriter, r *http.Request) {
+		// 每三次请求中前两次返回 503
+		if calls.Add(1)%3 != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, "busy")
+			return
+		}
+		io.WriteString(w, "ok")
+	})
+	_, app := newGateway(t, RouteConfig{
+		Prefix:    "/rs",
+		Upstreams: []string{up.URL},
+		Retry:     RetryConfig{Attempts: 2, BaseDelay: Duration(time.Millisecond), MaxDelay: Duration(time.Millisecond)},
+		Pool:      PoolConfig{Outlier: OutlierConfig{ConsecutiveFailures: -1}},
+	})
+
+	if status, body := get(t, app, "/rs"); status != http.StatusOK || body != "ok" || calls.Load() != 3 {
+		t.Fatalf("GET = %d %s after %d calls", status, body, calls.Load())
+	}
+	// POST 不是幂等方法，不重试，上游的 503 原样返回
+	calls.Store(0)
+	if status, body := send(t, app, httptest.NewRequest("POST", "/rs", nil)); status != http.StatusServiceUnavailable || body != "busy" || calls.Load() != 1 {
+		t.Fatalf("POST = %d %s after %d calls", status, body, calls.Load())
+	}
+	// 重试次数用完后返回最后一次的响应
+	calls.Store(0)
+	_, app = newGateway(t, RouteConfig{
+		Prefix:    "/rs",
+		Upstreams: []string{up.URL},
+		Retry:     RetryConfig{Attempts: 1, BaseDelay: Duration(time.Millisecond)},
+	})
+	if status, _ := get(t, app, "/rs"); status != http.StatusServiceUnavailable || calls.Load() != 2 {
+		t.Fatalf("GET = %d after %d calls", status, calls.Load())
+	}
+}
@@ -0,0 +1,289 @@
+package gateway
+
+import (
+	"fmt"
+	"hash/crc32"
+	"log"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// 负载均衡策略
+const (
+	RoundRobin     = "round_robin"
+	LeastConn      = "least_conn"
+	ConsistentHash = "consistent_hash"
+)
+
+const hashReplicas = 128
+
+type HealthCheckConfig struct {
+	Path               string   `json:"path"`                // 为空时不做主动探测
+	Interval           Duration `json:"interval"`            // 默认 10 秒
+	Timeout            Duration `json:"timeout"`             // 默认 2 秒
+	HealthyThreshold   int      `json:"healthy_threshold"`   // 连续成功几次恢复，默认 1
+	UnhealthyThreshold int      `json:"unhealthy_threshold"` // 连续失败几次摘除，默认 2
+}
+
+// OutlierConfig 被动检测：代理时连续失败（连接错误或 5xx）达到阈值就暂时摘除
+type OutlierConfig struct {
+	ConsecutiveFailures int      `json:"consecutive_failures"` // 默认 5，小于 0 关闭
+	EjectFor            Duration `json:"eject_for"`            // 默认 30 秒
+	MaxEjectPercent     int      `json:"max_eject_percent"`    // 最多摘除的比例，默认 50
+}
+
+type PoolConfig struct {
+	Strategy    string            `json:"strategy"` // round_robin（默认）、least_conn、consistent_hash
+	HashKey     string            `json:"hash_key"` // header:X-User-ID、query:user_id、cookie:uid 或 ip
+	HealthCheck HealthCheckConfig `json:"health_check"`
+	Outlier     OutlierConfig     `json:"outlier"`
+}
+
+// Upstream 一个上游实例及其运行状态
+type Upstream struct {
+	URL *url.URL
+
+	healthy      atomic.Bool
+	ejectedUntil atomic.Int64 // UnixNano
+	active       atomic.Int64 // 正在处理的请求数
+	fails        atomic.Int64 // 被动检测的连续失败次数
+	probeStreak  atomic.Int64 // 主动探测连续成功(>0)或失败(<0)次数
+	requests     atomic.Int64
+	errors       atomic.Int64
+}
+
+func (u *Upstream) available(now int64) bool {
+	return u.healthy.Load() && u.ejectedUntil.Load() <= now
+}
+
+type ringNode struct {
+	hash uint32
+	up   *Upstream
+}
+
+// Pool 一组上游实例，负责选择实例和健康检查
+type Pool struct {
+	cfg       PoolConfig
+	upstreams []*Upstream
+	ring      []ringNode
+	next      atomic.Uint64
+	stop      chan struct{}
+	probe     *fasthttp.Client
+}
+
+func newPool(cfg PoolConfig, urls []*url.URL) (*Pool, error) {
+	switch cfg.Strategy {
+	case "":
+		cfg.Strategy = RoundRobin
+	case RoundRobin, LeastConn:
+	case ConsistentHash:
+		if cfg.HashKey == "" {
+			return nil, fmt.Errorf("consistent_hash requires hash_key")
+		}
+	default:
+		return nil, fmt.Errorf("unknown strategy %q", cfg.Strategy)
+	}
+	hc := &cfg.HealthCheck
+	if hc.Interval <= 0 {
+		hc.Interval = Duration(10 * time.Second)
+	}
+	if hc.Timeout <= 0 {
+		hc.Timeout = Duration(2 * time.Second)
+	}
+	if hc.HealthyThreshold <= 0 {
+		hc.HealthyThreshold = 1
+	}
+	if hc.UnhealthyThreshold <= 0 {
+		hc.UnhealthyThreshold = 2
+	}
+	oc := &cfg.Outlier
+	if oc.ConsecutiveFailures == 0 {
+		oc.ConsecutiveFailures = 5
+	}
+	if oc.EjectFor <= 0 {
+		oc.EjectFor = Duration(30 * time.Second)
+	}
+	if oc.MaxEjectPercent <= 0 {
+		oc.MaxEjectPercent = 50
+	}
+
+	p := &Pool{cfg: cfg, stop: make(chan struct{})}
+	for _, u := range urls {
+		up := &Upstream{URL: u}
+		up.healthy.Store(true)
+		p.upstreams = append(p.upstreams, up)
+		for i := 0; i < hashReplicas; i++ {
+			p.ring = append(p.ring, ringNode{crc32.ChecksumIEEE([]byte(u.String() + "#" + strconv.Itoa(i))), up})
+		}
+	}
+	slices.SortFunc(p.ring, func(a, b ringNode) int { return int(int64(a.hash) - int64(b.hash)) })
+
+	if hc.Path != "" {
+		p.probe = &fasthttp.Client{Name: "go-server-health", ReadTimeout: time.Duration(hc.Timeout)}
+		go p.healthLoop()
+	}
+	return p, nil
+}
+
+// pick 按策略选择一个可用实例，没有可用实例时返回 nil
+func (p *Pool) pick(c *fiber.Ctx) *Upstream {
+	now := time.Now().UnixNano()
+	switch p.cfg.Strategy {
+	case LeastConn:
+		var best *Upstream
+		start := int(p.next.Add(1) % uint64(len(p.upstreams)))
+		for i := range p.upstreams {
+			u := p.upstreams[(start+i)%len(p.upstreams)]
+			if u.available(now) && (best == nil || u.active.Load() < best.active.Load()) {
+				best = u
+			}
+		}
+		return best
+	case ConsistentHash:
+		if key := p.hashKey(c); key != "" {
+			h := crc32.ChecksumIEEE([]byte(key))
+			i, _ := slices.BinarySearchFunc(p.ring, h, func(n ringNode, h uint32) int { return int(int64(n.hash) - int64(h)) })
+			for j := range p.ring {
+				if n := p.ring[(i+j)%len(p.ring)]; n.up.available(now) {
+					return n.up
+				}
+			}
+			return nil
+		}
+	}
+
+	start := p.next.Add(1)
+	for i := range p.upstreams {
+		if u := p.upstreams[(start+uint64(i))%uint64(len(p.upstreams))]; u.available(now) {
+			return u
+		}
+	}
+	return nil
+}
+
+func (p *Pool) hashKey(c *fiber.Ctx) string {
+	kind, name, _ := strings.Cut(p.cfg.HashKey, ":")
+	switch kind {
+	case "header":
+		return c.Get(name)
+	case "query":
+		return c.Query(name)
+	case "cookie":
+		return c.Cookies(name)
+	case "ip":
+		return c.IP()
+	}
+	return ""
+}
+
+// report 记录一次代理结果，用于被动摘除
+func (p *Pool) report(u *Upstream, failed bool) {
+	u.requests.Add(1)
+	if !failed {
+		u.fails.Store(0)
+		return
+	}
+	u.errors.Add(1)
+	oc := p.cfg.Outlier
+	if oc.ConsecutiveFailures < 0 || u.fails.Add(1) < int64(oc.ConsecutiveFailures) {
+		return
+	}
+
+	now := time.Now().UnixNano()
+	ejected := 0
+	for _, o := range p.upstreams {
+		if o.ejectedUntil.Load() > now {
+			ejected++
+		}
+	}
+	if (ejected+1)*100 > len(p.upstreams)*oc.MaxEjectPercent {
+		return
+	}
+	u.fails.Store(0)
+	u.ejectedUntil.Store(now + int64(oc.EjectFor))
+	log.Printf("gateway: ejected upstream %s for %s", u.URL, time.Duration(oc.EjectFor))
+}
+
+func (p *Pool) healthLoop() {
+	ticker := time.NewTicker(time.Duration(p.cfg.HealthCheck.Interval))
+	defer ticker.Stop()
+	for {
+		for _, u := range p.upstreams {
+			go p.check(u)
+		}
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Pool) check(u *Upstream) {
+	hc := p.cfg.HealthCheck
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+
+	req.SetRequestURI(u.URL.String() + hc.Path)
+	err := p.probe.DoTimeout(req, resp, time.Duration(hc.Timeout))
+	if err == nil && resp.StatusCode() >= fiber.StatusInternalServerError {
+		err = fmt.Errorf("status %d", resp.StatusCode())
+	}
+	ok := err == nil
+
+	if ok {
+		streak := max(u.probeStreak.Load(), 0) + 1
+		u.probeStreak.Store(streak)
+		if streak >= int64(hc.HealthyThreshold) && !u.healthy.Swap(true) {
+			log.Printf("gateway: upstream %s is healthy", u.URL)
+		}
+		return
+	}
+	streak := min(u.probeStreak.Load(), 0) - 1
+	u.probeStreak.Store(streak)
+	if -streak >= int64(hc.UnhealthyThreshold) && u.healthy.Swap(false) {
+		log.Printf("gateway: upstream %s is unhealthy: %v", u.URL, err)
+	}
+}
+
+func (p *Pool) close() {
+	close(p.stop)
+}
+
+// UpstreamStatus 管理接口返回的实例状态
+type UpstreamStatus struct {
+	URL          string     `json:"url"`
+	Healthy      bool       `json:"healthy"`
+	EjectedUntil *time.Time `json:"ejected_until,omitempty"`
+	Active       int64      `json:"active"`
+	Requests     int64      `json:"requests"`
+	Errors       int64      `json:"errors"`
+}
+
+func (p *Pool) status() []UpstreamStatus {
+	now := time.Now()
+	list := make([]UpstreamStatus, len(p.upstreams))
+	for i, u := range p.upstreams {
+		s := UpstreamStatus{
+			URL:      u.URL.String(),
+			Healthy:  u.healthy.Load(),
+			Active:   u.active.Load(),
+			Requests: u.requests.Load(),
+			Errors:   u.errors.Load(),
+		}
+		if until := time.Unix(0, u.ejectedUntil.Load()); until.After(now) {
+			s.EjectedUntil = &until
+		}
+		list[i] = s
+	}
+	return list
+}
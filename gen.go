@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/axuman/go-server/gen"
+)
+
+const genUsage = `usage: go-server gen crud --model <Name> [flags]
+
+generates the handler, route registration and migration for a struct in the models package;
+code inside "// gen:user <name> begin/end" regions survives regeneration`
+
+// runGen 处理 `go-server gen ...` 子命令
+func runGen(args []string) error {
+	if len(args) == 0 || args[0] != "crud" {
+		return fmt.Errorf("unknown gen command\n%s", genUsage)
+	}
+	fs := flag.NewFlagSet("gen crud", flag.ContinueOnError)
+	var opts gen.Options
+	fs.StringVar(&opts.Model, "model", "", "struct name in the models package, e.g. Mall")
+	fs.StringVar(&opts.Group, "group", "dmail", "route group in api.BuildRoutes")
+	fs.StringVar(&opts.Root, "root", ".", "project root containing go.mod")
+	fs.BoolVar(&opts.Tests, "tests", false, "also generate <pkg>_test.go if it does not exist")
+	fs.BoolVar(&opts.Force, "force", false, "overwrite hand-written files and drop regions missing from the template")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if opts.Model == "" {
+		return fmt.Errorf("--model is required\n%s", genUsage)
+	}
+	return gen.CRUD(opts)
+}
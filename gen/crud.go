@@ -0,0 +1,244 @@
+// Package gen 命令行代码生成，为低代码做准备。
+//
+// go-server gen crud --model Mall 读取 models 包中的结构体，生成:
+//
+//	api/<group>/<pkg>/<pkg>.go           q/c/u/bc/bd 接口，重新生成时保留 gen:user 区域
+//	api/api.go                           import、Policies 和 BuildRoutes 中的注册
+//	svr/migrations/NNNN_create_<table>   建表迁移，已有同名迁移时跳过
+//	api/<group>/<pkg>/<pkg>_test.go      指定 -tests 时生成，文件已存在时跳过
+package gen
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+var templates = template.Must(template.ParseFS(templateFS, "templates/*.tmpl"))
+
+type Options struct {
+	Root  string // 项目根目录，包含 go.mod
+	Model string // models 包中的结构体名
+	Group string // 路由组，默认 dmail
+	Tests bool   // 同时生成测试
+	Force bool   // 覆盖没有 gen:user 标记的手写文件
+}
+
+func CRUD(opts Options) error {
+	if opts.Root == "" {
+		opts.Root = "."
+	}
+	if opts.Group == "" {
+		opts.Group = "dmail"
+	}
+	if opts.Model == "" {
+		return fmt.Errorf("--model is required")
+	}
+	module, err := modulePath(filepath.Join(opts.Root, "go.mod"))
+	if err != nil {
+		return err
+	}
+	model, err := parseModel(filepath.Join(opts.Root, "models"), opts.Model)
+	if err != nil {
+		return err
+	}
+	n := newNames(model, opts.Group, module)
+	dir := filepath.Join(opts.Root, "api", n.Group, n.Pkg)
+
+	// 先检查 api.go 能否注册，避免只生成了一半
+	apiFile := filepath.Join(opts.Root, "api", "api.go")
+	apiSrc, err := register(apiFile, n)
+	if err != nil {
+		return err
+	}
+
+	if err := writeHandler(filepath.Join(dir, n.Pkg+".go"), n, opts.Force); err != nil {
+		return err
+	}
+	if err := writeMigration(filepath.Join(opts.Root, "svr", "migrations"), model); err != nil {
+		return err
+	}
+	if apiSrc == nil {
+		report(apiFile, false)
+	} else if err := writeFile(apiFile, apiSrc); err != nil {
+		return err
+	}
+	if opts.Tests {
+		if err := writeTests(filepath.Join(dir, n.Pkg+"_test.go"), n, model); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeHandler 生成接口文件，已有文件中 gen:user 区域的代码会被放回
+func writeHandler(path string, n names, force bool) error {
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, "handler.go.tmpl", n); err != nil {
+		return err
+	}
+	out := buf.Bytes()
+
+	old, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		if !bytes.Contains(old, []byte(regionMarker)) && !force {
+			return fmt.Errorf("%s was not generated by gen crud, use -force to overwrite it", path)
+		}
+		regions, err := userRegions(old)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		var lost []string
+		if out, lost = mergeRegions(out, regions); len(lost) > 0 && !force {
+			return fmt.Errorf("%s: regions %s no longer exist in the template, use -force to drop them", path, strings.Join(lost, ", "))
+		}
+	}
+	if out, err = format.Source(out); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return writeFile(path, out)
+}
+
+var migrationName = regexp.MustCompile(`^(\d+)_(.+)\.up\.sql$`)
+
+type index struct {
+	Name    string
+	Columns string
+}
+
+// writeMigration 生成建表迁移，已经有 create_<table> 迁移时跳过，避免修改已应用的迁移
+func writeMigration(dir string, m *Model) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	next := 1
+	for _, e := range entries {
+		match := migrationName.FindStringSubmatch(e.Name())
+		if match == nil {
+			continue
+		}
+		if match[2] == "create_"+m.Table {
+			log.Printf("skip   %s (already exists)", filepath.Join(dir, e.Name()))
+			return nil
+		}
+		v, _ := strconv.Atoi(match[1])
+		next = max(next, v+1)
+	}
+
+	var indexes []index
+	for _, f := range m.Fields {
+		if f.Sortable {
+			indexes = append(indexes, index{m.Entity + "_deleted_at_" + f.Column + "_id", "deleted_at, " + f.Column + ", id"})
+		}
+	}
+	if len(indexes) == 0 {
+		indexes = append(indexes, index{m.Entity + "_deleted_at_id", "deleted_at, id"})
+	}
+	data := struct {
+		Model   *Model
+		Indexes []index
+	}{m, indexes}
+
+	base := filepath.Join(dir, fmt.Sprintf("%04d_create_%s", next, m.Table))
+	for _, kind := range []string{"up", "down"} {
+		var buf bytes.Buffer
+		if err := templates.ExecuteTemplate(&buf, kind+".sql.tmpl", data); err != nil {
+			return err
+		}
+		if err := writeFile(base+"."+kind+".sql", bytes.TrimLeft(buf.Bytes(), "\n")); err != nil {
+			return err
+		}
+	}
+	log.Printf("note   migrations are embedded, rebuild and run `go-server migrate up`")
+	return nil
+}
+
+// writeTests 只在文件不存在时生成
+func writeTests(path string, n names, m *Model) error {
+	if _, err := os.Stat(path); err == nil {
+		log.Printf("skip   %s (already exists)", path)
+		return nil
+	}
+	sample := map[string]any{}
+	for _, f := range m.Fields {
+		sample[f.Key] = f.Sample
+	}
+	b, err := json.Marshal(sample)
+	if err != nil {
+		return err
+	}
+	data := struct {
+		names
+		Sample string
+	}{n, string(b)}
+
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, "test.go.tmpl", data); err != nil {
+		return err
+	}
+	out, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return writeFile(path, out)
+}
+
+func writeFile(path string, data []byte) error {
+	old, err := os.ReadFile(path)
+	if err == nil && bytes.Equal(old, data) {
+		report(path, false)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return err
+	}
+	if os.IsNotExist(err) {
+		log.Printf("create %s", path)
+	} else {
+		report(path, true)
+	}
+	return nil
+}
+
+func report(path string, changed bool) {
+	if changed {
+		log.Printf("update %s", path)
+	} else {
+		log.Printf("keep   %s (unchanged)", path)
+	}
+}
+
+func modulePath(gomod string) (string, error) {
+	f, err := os.Open(gomod)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if rest, ok := strings.CutPrefix(strings.TrimSpace(sc.Text()), "module "); ok {
+			return strings.Trim(strings.TrimSpace(rest), `"`), nil
+		}
+	}
+	return "", fmt.Errorf("%s: module directive not found", gomod)
+}
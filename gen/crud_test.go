@@ -0,0 +1,159 @@
+package gen
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const orderItemModel = `package models
+
+type OrderItem struct {
+	Title *string ` + "`" + `json:"title" validate:"required" sort:"true"` + "`" + `
+	Price *float64 ` + "`" + `json:"price"` + "`" + `
+}
+`
+
+// project 在临时目录中准备 go.mod、models、api/api.go 和迁移目录，返回根目录
+func project(t *testing.T, migrations ...string) string {
+	t.Helper()
+	root := t.TempDir()
+	api, err := os.ReadFile(filepath.Join("testdata", "api.go.in"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"go.mod":                "module github.com/axuman/go-server\n",
+		"models/order_item.go":  orderItemModel,
+		"api/api.go":            string(api),
+		"svr/migrations/README": "",
+	}
+	for _, name := range migrations {
+		files["svr/migrations/"+name] = "-- " + name + "\n"
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func migrationFiles(t *testing.T, root string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Join(root, "svr", "migrations"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list []string
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".sql") {
+			list = append(list, e.Name())
+		}
+	}
+	return list
+}
+
+func TestMigrationNumbering(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string
+		want     string
+	}{
+		{"empty", nil, "0001_create_order_items"},
+		// 按最大的编号递增，中间的空缺不补
+		{"gap", []string{"0001_create_users.up.sql", "0001_create_users.down.sql", "0007_add_index.up.sql"}, "0008_create_order_items"},
+		{"no leading zeros", []string{"12_x.up.sql"}, "0013_create_order_items"},
+		{"ignores other files", []string{"0002_x.up.sql", "0009_x.sql", "notes.up.sql"}, "0003_create_order_items"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := project(t, tt.existing...)
+			m, err := parseModel(filepath.Join(root, "models"), "OrderItem")
+			if err != nil {
+				t.Fatal(err)
+			}
+			dir := filepath.Join(root, "svr", "migrations")
+			if err := writeMigration(dir, m); err != nil {
+				t.Fatal(err)
+			}
+			for _, kind := range []string{"up", "down"} {
+				if _, err := os.Stat(filepath.Join(dir, tt.want+"."+kind+".sql")); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// 已有 create_order_items 迁移时跳过，不生成新编号
+			before := migrationFiles(t, root)
+			if err := writeMigration(dir, m); err != nil {
+				t.Fatal(err)
+			}
+			if after := migrationFiles(t, root); !slices.Equal(before, after) {
+				t.Fatalf("files = %v, want %v", after, before)
+			}
+		})
+	}
+}
+
+// 重新生成时只改动模板部分，gen:user 区域、api.go 和迁移都保持不变
+func TestCRUDRegenerate(t *testing.T) {
+	root := project(t, "0001_create_users.up.sql")
+	opts := Options{Root: root, Model: "OrderItem", Tests: true}
+	if err := CRUD(opts); err != nil {
+		t.Fatal(err)
+	}
+	handler := filepath.Join(root, "api", "dmail", "orderitem", "orderitem.go")
+	read := func(path string) []byte {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	api := read(filepath.Join(root, "api", "api.go"))
+	if want := read(filepath.Join("testdata", "api.go.golden")); !bytes.Equal(api, want) {
+		t.Fatalf("api.go:\n%s", api)
+	}
+	migrations := migrationFiles(t, root)
+	if !slices.Contains(migrations, "0002_create_order_items.up.sql") {
+		t.Fatalf("migrations = %v", migrations)
+	}
+
+	// 生成的接口把表登记给 purge
+	src := read(handler)
+	if !bytes.Contains(src, []byte("purge.Register(table)")) {
+		t.Fatalf("handler:\n%s", src)
+	}
+
+	// 用户在区域内写的代码会被保留，区域外的修改会被覆盖
+	custom := "\t// gen:user create begin\n\tif payload.D.Title == nil {\n\t\treturn nil\n\t}\n"
+	edited := strings.Replace(string(src), "\t// gen:user create begin\n", custom, 1)
+	edited = strings.Replace(edited, "package orderitem\n", "package orderitem\n\n// hand edit\n", 1)
+	if edited == string(src) {
+		t.Fatal("create region not found in the handler")
+	}
+	if err := os.WriteFile(handler, []byte(edited), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CRUD(opts); err != nil {
+		t.Fatal(err)
+	}
+	regenerated := string(read(handler))
+	if !strings.Contains(regenerated, custom) || strings.Contains(regenerated, "// hand edit") {
+		t.Fatalf("handler:\n%s", regenerated)
+	}
+	if got := read(filepath.Join(root, "api", "api.go")); !bytes.Equal(got, api) {
+		t.Fatalf("api.go changed:\n%s", got)
+	}
+	if got := migrationFiles(t, root); !slices.Equal(got, migrations) {
+		t.Fatalf("migrations = %v, want %v", got, migrations)
+	}
+}
@@ -0,0 +1,212 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	t "github.com/axuman/go-server/biz"
+)
+
+// Field 模型中对应数据库列的字段
+type Field struct {
+	Name     string // Go 字段名
+	Column   string
+	Key      string // JSON 字段名
+	SQLType  string // TEXT、INTEGER、REAL、DATETIME、BLOB
+	NotNull  bool   // 排序列或 validate:"required"
+	Sortable bool
+	Sample   any // 生成测试时使用的示例值
+}
+
+// Model 从 models 包解析出的模型
+type Model struct {
+	Name   string // Mall
+	Entity string // mall，与 biz.Schema.Entity 相同
+	Table  string // malls
+	Fields []Field
+}
+
+// parseModel 在 dir 下的 Go 文件中查找结构体 name，列名规则与 biz.SchemaOf 一致
+func parseModel(dir, name string) (*Model, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	var st *ast.StructType
+	table := ""
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				switch d := decl.(type) {
+				case *ast.GenDecl:
+					for _, spec := range d.Specs {
+						if ts, ok := spec.(*ast.TypeSpec); ok && ts.Name.Name == name {
+							st, _ = ts.Type.(*ast.StructType)
+						}
+					}
+				case *ast.FuncDecl:
+					if s, ok := tableNameMethod(d, name); ok {
+						table = s
+					}
+				}
+			}
+		}
+	}
+	if st == nil {
+		return nil, fmt.Errorf("struct %s not found in %s", name, dir)
+	}
+
+	m := &Model{Name: name, Entity: t.SnakeCase(name), Table: table}
+	if m.Table == "" {
+		m.Table = m.Entity + "s"
+	}
+	for _, f := range st.Fields.List {
+		if len(f.Names) == 0 {
+			return nil, fmt.Errorf("%s: embedded fields are not supported", name)
+		}
+		var tag reflect.StructTag
+		if f.Tag != nil {
+			raw, _ := strconv.Unquote(f.Tag.Value)
+			tag = reflect.StructTag(raw)
+		}
+		for _, ident := range f.Names {
+			if !ident.IsExported() {
+				continue
+			}
+			column := tagName(tag.Get("db"))
+			if column == "-" {
+				continue
+			}
+			key := tagName(tag.Get("json"))
+			if key == "" || key == "-" {
+				key = t.SnakeCase(ident.Name)
+			}
+			if column == "" {
+				column = key
+			}
+			sqlType, sample, err := sqlTypeOf(f.Type)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", name, ident.Name, err)
+			}
+			sortable := tag.Get("sort") == "true"
+			m.Fields = append(m.Fields, Field{
+				Name:     ident.Name,
+				Column:   column,
+				Key:      key,
+				SQLType:  sqlType,
+				NotNull:  sortable || strings.Contains(","+tag.Get("validate")+",", ",required,"),
+				Sortable: sortable,
+				Sample:   sample,
+			})
+		}
+	}
+	if len(m.Fields) == 0 {
+		return nil, fmt.Errorf("%s has no columns", name)
+	}
+	return m, nil
+}
+
+// tableNameMethod 识别 func (Model) TableName() string { return "xxx" }
+func tableNameMethod(d *ast.FuncDecl, model string) (string, bool) {
+	if d.Name.Name != "TableName" || d.Recv == nil || len(d.Recv.List) != 1 || d.Body == nil || len(d.Body.List) != 1 {
+		return "", false
+	}
+	recv := d.Recv.List[0].Type
+	if star, ok := recv.(*ast.StarExpr); ok {
+		recv = star.X
+	}
+	if id, ok := recv.(*ast.Ident); !ok || id.Name != model {
+		return "", false
+	}
+	ret, ok := d.Body.List[0].(*ast.ReturnStmt)
+	if !ok || len(ret.Results) != 1 {
+		return "", false
+	}
+	lit, ok := ret.Results[0].(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	s, err := strconv.Unquote(lit.Value)
+	return s, err == nil
+}
+
+// sqlTypeOf 返回列类型和示例值
+func sqlTypeOf(expr ast.Expr) (string, any, error) {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	switch e := expr.(type) {
+	case *ast.Ident:
+		switch {
+		case e.Name == "string":
+			return "TEXT", "test", nil
+		case e.Name == "bool":
+			return "INTEGER", true, nil
+		case strings.HasPrefix(e.Name, "int") || strings.HasPrefix(e.Name, "uint"):
+			return "INTEGER", 1, nil
+		case strings.HasPrefix(e.Name, "float"):
+			return "REAL", 1.5, nil
+		}
+	case *ast.SelectorExpr:
+		if x, ok := e.X.(*ast.Ident); ok && x.Name == "time" && e.Sel.Name == "Time" {
+			return "DATETIME", "2024-01-01T00:00:00Z", nil
+		}
+	case *ast.ArrayType:
+		if id, ok := e.Elt.(*ast.Ident); ok && e.Len == nil && id.Name == "byte" {
+			return "BLOB", []byte("test"), nil
+		}
+	}
+	return "", nil, fmt.Errorf("unsupported field type %s", types.ExprString(expr))
+}
+
+func tagName(tag string) string {
+	name, _, _ := strings.Cut(tag, ",")
+	return name
+}
+
+// names 模板中使用的各种命名
+type names struct {
+	Model  string // OrderItem
+	Entity string // order_item
+	Pkg    string // orderitem
+	Var    string // orderItem
+	Plural string // orderItems，仓库函数名
+	Label  string // order item，错误信息中使用
+	Title  string // Order item
+	Route  string // order-item
+	Group  string // dmail
+	Policy string // dmail.order_item
+	Module string // github.com/axuman/go-server
+}
+
+func newNames(m *Model, group, module string) names {
+	label := strings.ReplaceAll(m.Entity, "_", " ")
+	v := []rune(m.Name)
+	for i := 0; i < len(v) && unicode.IsUpper(v[i]); i++ {
+		if i > 0 && i+1 < len(v) && unicode.IsLower(v[i+1]) {
+			break // HTTPServer -> httpServer
+		}
+		v[i] = unicode.ToLower(v[i])
+	}
+	return names{
+		Model:  m.Name,
+		Entity: m.Entity,
+		Pkg:    strings.ReplaceAll(m.Entity, "_", ""),
+		Var:    string(v),
+		Plural: string(v) + "s",
+		Label:  label,
+		Title:  strings.ToUpper(label[:1]) + label[1:],
+		Route:  strings.ReplaceAll(m.Entity, "_", "-"),
+		Group:  group,
+		Policy: group + "." + m.Entity,
+		Module: module,
+	}
+}
@@ -0,0 +1,71 @@
+package gen
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// 生成的文件中 gen:user 区域内的代码归用户所有，重新生成时原样保留:
+//
+//	// gen:user create begin
+//	...
+//	// gen:user create end
+const regionMarker = "// gen:user "
+
+// userRegions 提取每个区域的内容
+func userRegions(src []byte) (map[string]string, error) {
+	regions := map[string]string{}
+	name, inside := "", false
+	var body strings.Builder
+	for _, line := range strings.SplitAfter(string(src), "\n") {
+		rest, ok := strings.CutPrefix(strings.TrimSpace(line), regionMarker)
+		if !ok {
+			if inside {
+				body.WriteString(line)
+			}
+			continue
+		}
+		n, kind, _ := strings.Cut(rest, " ")
+		switch {
+		case kind == "begin" && !inside:
+			name, inside = n, true
+			body.Reset()
+		case kind == "end" && inside && n == name:
+			regions[name] = body.String()
+			inside = false
+		default:
+			return nil, fmt.Errorf("unbalanced region marker %q", strings.TrimSpace(line))
+		}
+	}
+	if inside {
+		return nil, fmt.Errorf("region %q is not closed", name)
+	}
+	return regions, nil
+}
+
+// mergeRegions 把 regions 填回新生成的代码，模板中的区域都是空的。
+// 返回新模板中已经没有的区域名，这些代码会丢失，由调用方决定是否继续。
+func mergeRegions(generated []byte, regions map[string]string) ([]byte, []string) {
+	var out strings.Builder
+	used := map[string]bool{}
+	for _, line := range strings.SplitAfter(string(generated), "\n") {
+		out.WriteString(line)
+		rest, ok := strings.CutPrefix(strings.TrimSpace(line), regionMarker)
+		if !ok {
+			continue
+		}
+		if n, kind, _ := strings.Cut(rest, " "); kind == "begin" {
+			out.WriteString(regions[n])
+			used[n] = true
+		}
+	}
+	var lost []string
+	for n, body := range regions {
+		if !used[n] && strings.TrimSpace(body) != "" {
+			lost = append(lost, n)
+		}
+	}
+	slices.Sort(lost)
+	return []byte(out.String()), lost
+}
@@ -0,0 +1,100 @@
+package gen
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestUserRegions(t *testing.T) {
+	src := `package x
+
+	// gen:user imports begin
+	"strings"
+	// gen:user imports end
+
+func f() {
+	// gen:user create begin
+	if x {
+		return
+	}
+
+	// gen:user create end
+	// gen:user empty begin
+	// gen:user empty end
+}
+`
+	got, err := userRegions([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 区域内容按原样保留，包括缩进和空行
+	want := map[string]string{
+		"imports": "\t\"strings\"\n",
+		"create":  "\tif x {\n\t\treturn\n\t}\n\n",
+		"empty":   "",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q\nwant %q", got, want)
+	}
+
+	tests := []struct {
+		name string
+		src  string
+		err  string
+	}{
+		{"end without begin", "// gen:user a end\n", "unbalanced"},
+		{"nested", "// gen:user a begin\n// gen:user b begin\n", "unbalanced"},
+		{"wrong end", "// gen:user a begin\n// gen:user b end\n", "unbalanced"},
+		{"unknown kind", "// gen:user a start\n", "unbalanced"},
+		{"not closed", "// gen:user a begin\nx\n", `region "a" is not closed`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := userRegions([]byte(tt.src)); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("err = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestMergeRegions(t *testing.T) {
+	generated := `func f() {
+	// gen:user create begin
+	// gen:user create end
+	// gen:user update begin
+	// gen:user update end
+}
+`
+	regions := map[string]string{
+		"create":  "\tlog.Println(1)\n",
+		"removed": "\tlog.Println(2)\n",
+		"blank":   "\n\t\n", // 只有空白的区域丢了也没关系
+		"gone":    "\tx++\n",
+	}
+	out, lost := mergeRegions([]byte(generated), regions)
+	want := `func f() {
+	// gen:user create begin
+	log.Println(1)
+	// gen:user create end
+	// gen:user update begin
+	// gen:user update end
+}
+`
+	if string(out) != want {
+		t.Fatalf("got\n%s\nwant\n%s", out, want)
+	}
+	if !slices.Equal(lost, []string{"gone", "removed"}) {
+		t.Fatalf("lost = %v", lost)
+	}
+
+	// 提取后再填回得到相同的内容
+	again, err := userRegions(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged, lost := mergeRegions([]byte(generated), again); string(merged) != want || len(lost) != 0 {
+		t.Fatalf("round trip:\n%s\nlost = %v", merged, lost)
+	}
+}
@@ -0,0 +1,179 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type edit struct {
+	offset int
+	text   string
+}
+
+// register 在 api.go 中加入 import、Policies 条目和 BuildRoutes 调用，已有的部分跳过。
+// 只返回修改后的内容，由调用方在其他文件都没有问题后写入，都已存在时返回 nil。
+func register(path string, n names) ([]byte, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	offset := func(p token.Pos) int { return fset.Position(p).Offset }
+	var edits []edit
+
+	// import
+	importPath := n.Module + "/api/" + n.Group + "/" + n.Pkg
+	var found, last *ast.ImportSpec
+	for _, imp := range f.Imports {
+		p, _ := strconv.Unquote(imp.Path.Value)
+		if p == importPath {
+			found = imp
+		} else if imp.Name != nil && imp.Name.Name == n.Pkg {
+			return nil, fmt.Errorf("%s: import name %s is already used by %s", path, n.Pkg, p)
+		}
+		if strings.HasPrefix(p, n.Module+"/api/") || last == nil {
+			last = imp
+		}
+	}
+	alias := n.Pkg
+	if found == nil {
+		edits = append(edits, edit{offset(last.End()), fmt.Sprintf("\n\t%s %q", n.Pkg, importPath)})
+	} else if found.Name != nil {
+		alias = found.Name.Name
+	}
+
+	// Policies，沿用最后一条的配置
+	if lit := policiesLiteral(f); lit != nil {
+		exists := false
+		value := "{Timeout: 5 * time.Second}"
+		for _, elt := range lit.Elts {
+			kv, ok := elt.(*ast.KeyValueExpr)
+			if !ok {
+				continue
+			}
+			if key, ok := kv.Key.(*ast.BasicLit); ok && key.Value == strconv.Quote(n.Policy) {
+				exists = true
+			}
+			value = string(src[offset(kv.Value.Pos()):offset(kv.Value.End())])
+		}
+		if !exists {
+			edits = append(edits, edit{offset(lit.Rbrace), fmt.Sprintf("\t%q: %s,\n", n.Policy, value)})
+		}
+	}
+
+	// BuildRoutes 中的注册
+	fn := funcDecl(f, "BuildRoutes")
+	if fn == nil {
+		return nil, fmt.Errorf("%s: func BuildRoutes not found", path)
+	}
+	routerVar, after := "", ast.Stmt(nil)
+	registered := false
+	for _, stmt := range fn.Body.List {
+		if as, ok := stmt.(*ast.AssignStmt); ok && len(as.Lhs) == 1 && len(as.Rhs) == 1 && isGroupCall(as.Rhs[0], n.Group) {
+			routerVar, after = as.Lhs[0].(*ast.Ident).Name, stmt
+			continue
+		}
+		call := buildRoutesCall(stmt)
+		if call == nil || routerVar == "" {
+			continue
+		}
+		if sel := call.Fun.(*ast.SelectorExpr); sel.X.(*ast.Ident).Name == alias {
+			registered = true
+		}
+		if id, ok := call.Args[0].(*ast.Ident); ok && id.Name == routerVar {
+			after = stmt
+		}
+	}
+	if routerVar == "" {
+		return nil, fmt.Errorf("%s: BuildRoutes has no router.Group(\"/%s\")", path, n.Group)
+	}
+	if !registered {
+		edits = append(edits, edit{offset(after.End()), fmt.Sprintf("\n\t%s.BuildRoutes(%s, withPolicy(protected, %q)...)", alias, routerVar, n.Policy)})
+	}
+
+	if len(edits) == 0 {
+		return nil, nil
+	}
+	slices.SortFunc(edits, func(a, b edit) int { return b.offset - a.offset })
+	out := src
+	for _, e := range edits {
+		out = slices.Concat(out[:e.offset], []byte(e.text), out[e.offset:])
+	}
+	if out, err = format.Source(out); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return out, nil
+}
+
+func policiesLiteral(f *ast.File) *ast.CompositeLit {
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			vs := spec.(*ast.ValueSpec)
+			for i, name := range vs.Names {
+				if name.Name == "Policies" && i < len(vs.Values) {
+					lit, _ := vs.Values[i].(*ast.CompositeLit)
+					return lit
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func funcDecl(f *ast.File, name string) *ast.FuncDecl {
+	for _, decl := range f.Decls {
+		if fd, ok := decl.(*ast.FuncDecl); ok && fd.Recv == nil && fd.Name.Name == name {
+			return fd
+		}
+	}
+	return nil
+}
+
+// isGroupCall 匹配 router.Group("/group")
+func isGroupCall(expr ast.Expr, group string) bool {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok || len(call.Args) == 0 {
+		return false
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Group" {
+		return false
+	}
+	lit, ok := call.Args[0].(*ast.BasicLit)
+	return ok && lit.Value == strconv.Quote("/"+group)
+}
+
+// buildRoutesCall 匹配 pkg.BuildRoutes(router, ...) 语句
+func buildRoutesCall(stmt ast.Stmt) *ast.CallExpr {
+	es, ok := stmt.(*ast.ExprStmt)
+	if !ok {
+		return nil
+	}
+	call, ok := es.X.(*ast.CallExpr)
+	if !ok || len(call.Args) == 0 {
+		return nil
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "BuildRoutes" {
+		return nil
+	}
+	if _, ok := sel.X.(*ast.Ident); !ok {
+		return nil
+	}
+	return call
+}
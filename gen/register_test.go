@@ -0,0 +1,116 @@
+package gen
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func orderItem() names {
+	return newNames(&Model{Name: "OrderItem", Entity: "order_item", Table: "order_items"}, "dmail", "github.com/axuman/go-server")
+}
+
+// writeTemp 把 src 写到临时目录中的 api.go
+func writeTemp(t *testing.T, src []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "api.go")
+	if err := os.WriteFile(path, src, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRegisterGolden(t *testing.T) {
+	got, err := register(filepath.Join("testdata", "api.go.in"), orderItem())
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join("testdata", "api.go.golden")
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("register output differs from %s, run go test -update\n%s", golden, got)
+	}
+
+	// 已经注册过的文件不再修改
+	again, err := register(writeTemp(t, got), orderItem())
+	if err != nil || again != nil {
+		t.Fatalf("second register = %q, %v", again, err)
+	}
+}
+
+func TestRegisterPartial(t *testing.T) {
+	in, err := os.ReadFile(filepath.Join("testdata", "api.go.in"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(filepath.Join("testdata", "api.go.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 只缺其中一部分时补上缺的，结果和从头注册一样
+	tests := []struct {
+		name string
+		edit func(string) string
+	}{
+		{"import only", func(s string) string {
+			return strings.Replace(s, "\tmall ", "\torderitem \"github.com/axuman/go-server/api/dmail/orderitem\"\n\tmall ", 1)
+		}},
+		{"policy only", func(s string) string {
+			return strings.Replace(s, "\n}\n\nfunc BuildRoutes", "\n\t\"dmail.order_item\": {Timeout: 5 * time.Second, Breaker: resilience.BreakerConfig{FailureThreshold: 20, OpenFor: 10 * time.Second}},\n}\n\nfunc BuildRoutes", 1)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := register(writeTemp(t, []byte(tt.edit(string(in)))), orderItem())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("got\n%s", got)
+			}
+		})
+	}
+}
+
+func TestRegisterErrors(t *testing.T) {
+	in, err := os.ReadFile(filepath.Join("testdata", "api.go.in"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		edit func(string) string
+		err  string
+	}{
+		{"alias taken", func(s string) string {
+			return strings.Replace(s, "\tmall \"", "\torderitem \"", 1)
+		}, "import name orderitem is already used"},
+		{"no group", func(s string) string {
+			return strings.ReplaceAll(s, `"/dmail"`, `"/mail"`)
+		}, `BuildRoutes has no router.Group("/dmail")`},
+		{"no BuildRoutes", func(s string) string {
+			return strings.Replace(s, "func BuildRoutes(", "func buildRoutes(", 1)
+		}, "func BuildRoutes not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := register(writeTemp(t, []byte(tt.edit(string(in)))), orderItem())
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("err = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
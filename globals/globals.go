@@ -2,7 +2,55 @@ package globals
 
 import (
 	"database/sql"
+
+	"github.com/axuman/go-server/cache"
+	"github.com/axuman/go-server/config"
+	"github.com/axuman/go-server/gateway"
+	"github.com/axuman/go-server/ipc"
+	"github.com/axuman/go-server/lowcode"
+	"github.com/axuman/go-server/middleware/crypt"
+	"github.com/axuman/go-server/middleware/ratelimit"
+	"github.com/axuman/go-server/middleware/shield"
+	"github.com/axuman/go-server/middleware/sign"
+	"github.com/axuman/go-server/mq"
+	"github.com/axuman/go-server/purge"
+	"github.com/axuman/go-server/sidecar"
 )
 
+// Config 配置中心，Get() 返回当前生效的配置
+var Config *config.Store
 
 var DmailDB *sql.DB
+
+// RateLimit 按 IP 限流，参数随配置热更新
+var RateLimit *ratelimit.Limiter
+
+// Shield 5秒盾，为 nil 时不启用
+var Shield *shield.Shield
+
+// Crypt 接口加密，请求带 X-Crypt-Session 头时生效
+var Crypt *crypt.Crypt
+
+// Signer 请求签名校验，为 nil 时不启用
+var Signer *sign.Signer
+
+// Cache 进程内缓存，为 nil 时不启用
+var Cache *cache.Cache
+
+// MQ 进程内消息队列，Emit 发布事件不阻塞请求
+var MQ *mq.Queue
+
+// Gateway 反向代理到 Rust、JS 等上游服务，为 nil 时不启用
+var Gateway *gateway.Gateway
+
+// IPC sidecar 服务注册表，通过 Unix socket 调用
+var IPC *ipc.Registry
+
+// Sidecars 子进程守护，为 nil 时不启用
+var Sidecars *sidecar.Supervisor
+
+// LowCode 运行时定义的实体，为 nil 时不启用
+var LowCode *lowcode.Engine
+
+// Purger 定期硬删除软删除的记录，为 nil 时不启用
+var Purger *purge.Purger
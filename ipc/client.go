@@ -0,0 +1,218 @@
+package ipc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+type Client struct {
+	nc   net.Conn
+	wmu  sync.Mutex
+	done chan struct{}
+
+	mu      sync.Mutex
+	next    uint64
+	pending map[uint64]*pending
+}
+
+// pending 等待回复的调用，gone 在调用方不再接收后关闭
+type pending struct {
+	ch   chan *frame
+	gone chan struct{}
+}
+
+// Dial 连接 Unix socket 上的服务端
+func Dial(ctx context.Context, path string) (*Client, error) {
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "unix", path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{nc: nc, done: make(chan struct{}), pending: map[uint64]*pending{}}
+	go c.readLoop()
+	return c, nil
+}
+
+// Done 在连接断开后关闭
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *Client) Close() error {
+	return c.nc.Close()
+}
+
+func (c *Client) readLoop() {
+	defer func() {
+		c.nc.Close()
+		c.mu.Lock()
+		close(c.done)
+		for id, p := range c.pending {
+			close(p.ch)
+			delete(c.pending, id)
+		}
+		c.mu.Unlock()
+	}()
+	r := bufio.NewReader(c.nc)
+	for {
+		f, err := readFrame(r)
+		if err != nil {
+			return
+		}
+		c.mu.Lock()
+		p, ok := c.pending[f.ID]
+		c.mu.Unlock()
+		if !ok {
+			continue // 已取消的调用
+		}
+		// 流式调用的消费者跟不上时会阻塞整个连接，靠 socket 的缓冲做流控
+		select {
+		case p.ch <- f:
+		case <-p.gone:
+		}
+	}
+}
+
+// start 发送请求并登记等待回复的 channel
+func (c *Client) start(ctx context.Context, method string, in any, stream bool) (uint64, chan *frame, error) {
+	var data json.RawMessage
+	if in != nil {
+		var err error
+		if data, err = json.Marshal(in); err != nil {
+			return 0, nil, err
+		}
+	}
+	f := &frame{Type: typeRequest, Method: method, Stream: stream, Data: data}
+	if deadline, ok := ctx.Deadline(); ok {
+		f.Deadline = deadline.UnixMilli()
+	}
+	p := &pending{ch: make(chan *frame, 16), gone: make(chan struct{})}
+
+	c.mu.Lock()
+	select {
+	case <-c.done:
+		c.mu.Unlock()
+		return 0, nil, ErrClosed
+	default:
+	}
+	c.next++
+	f.ID = c.next
+	c.pending[f.ID] = p
+	c.mu.Unlock()
+
+	if err := c.send(f); err != nil {
+		c.finish(f.ID)
+		return 0, nil, ErrClosed
+	}
+	return f.ID, p.ch, nil
+}
+
+// finish 不再接收 id 的回复
+func (c *Client) finish(id uint64) {
+	c.mu.Lock()
+	if p, ok := c.pending[id]; ok {
+		close(p.gone)
+		delete(c.pending, id)
+	}
+	c.mu.Unlock()
+}
+
+func (c *Client) cancel(id uint64) {
+	c.finish(id)
+	c.send(&frame{ID: id, Type: typeCancel})
+}
+
+func (c *Client) send(f *frame) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.nc.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return writeFrame(c.nc, f)
+}
+
+// Call 调用普通方法，ctx 的截止时间会传给服务端，ctx 取消时通知服务端取消。
+// out 为 nil 时忽略返回值。
+func (c *Client) Call(ctx context.Context, method string, in, out any) error {
+	id, ch, err := c.start(ctx, method, in, false)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		c.cancel(id)
+		return ctx.Err()
+	case f, ok := <-ch:
+		c.finish(id)
+		if !ok {
+			return ErrClosed
+		}
+		if f.Type == typeError {
+			return f.Error
+		}
+		if out == nil || len(f.Data) == 0 {
+			return nil
+		}
+		return json.Unmarshal(f.Data, out)
+	}
+}
+
+// Stream 调用流式方法，用 Recv 读取消息，不再需要时调用 Close
+func (c *Client) Stream(ctx context.Context, method string, in any) (*Stream, error) {
+	id, ch, err := c.start(ctx, method, in, true)
+	if err != nil {
+		return nil, err
+	}
+	return &Stream{c: c, ctx: ctx, id: id, ch: ch}, nil
+}
+
+type Stream struct {
+	c    *Client
+	ctx  context.Context
+	id   uint64
+	ch   chan *frame
+	done bool
+}
+
+// Recv 读取下一条消息，流正常结束时返回 io.EOF
+func (s *Stream) Recv(out any) error {
+	if s.done {
+		return io.EOF
+	}
+	select {
+	case <-s.ctx.Done():
+		s.Close()
+		return s.ctx.Err()
+	case f, ok := <-s.ch:
+		if !ok {
+			s.done = true
+			return ErrClosed
+		}
+		switch f.Type {
+		case typeMessage:
+			if out == nil {
+				return nil
+			}
+			return json.Unmarshal(f.Data, out)
+		case typeError:
+			s.done = true
+			s.c.finish(s.id)
+			return f.Error
+		default:
+			s.done = true
+			s.c.finish(s.id)
+			return io.EOF
+		}
+	}
+}
+
+// Close 提前结束时通知服务端取消
+func (s *Stream) Close() {
+	if !s.done {
+		s.done = true
+		s.c.cancel(s.id)
+	}
+}
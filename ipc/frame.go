@@ -0,0 +1,132 @@
+// Package ipc 本机服务之间的 RPC，主要给 Rust、JS 写的 sidecar 使用。
+//
+// 协议: Unix socket 上传输帧，每帧为 4 字节大端长度 + JSON:
+//
+//	{"id": 1, "type": "req", "method": "hash", "deadline": 1700000000000, "data": {...}}
+//
+// type 取值:
+//
+//	req     调用，deadline 为 Unix 毫秒（可选），stream 为 true 表示流式调用
+//	res     普通调用的返回值
+//	msg     流式调用的一条消息，之后以 end 结束
+//	end     流式调用结束
+//	err     调用失败，error 为 {"code", "message", "status"}
+//	cancel  客户端取消调用，服务端取消 handler 的 ctx
+//
+// 同一个连接上可以同时有多个调用，按 id 区分，id 由客户端分配。
+package ipc
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	t "github.com/axuman/go-server/biz"
+)
+
+const maxFrame = 16 << 20
+
+const (
+	typeRequest = "req"
+	typeReply   = "res"
+	typeMessage = "msg"
+	typeEnd     = "end"
+	typeError   = "err"
+	typeCancel  = "cancel"
+)
+
+const (
+	CodeMethodNotFound = "method_not_found"
+	CodeCanceled       = "canceled"
+)
+
+type frame struct {
+	ID       uint64          `json:"id"`
+	Type     string          `json:"type"`
+	Method   string          `json:"method,omitempty"`
+	Deadline int64           `json:"deadline,omitempty"`
+	Stream   bool            `json:"stream,omitempty"`
+	Data     json.RawMessage `json:"data,omitempty"`
+	Error    *Error          `json:"error,omitempty"`
+}
+
+// Error 调用失败时返回给客户端的错误，Status 用于通过 Route 暴露成 HTTP 接口时的状态码
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Status  int    `json:"status,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return "ipc: " + e.Code + ": " + e.Message
+}
+
+// Is 让超时和取消可以用 errors.Is(err, context.DeadlineExceeded) 判断
+func (e *Error) Is(target error) bool {
+	switch target {
+	case context.DeadlineExceeded:
+		return e.Code == t.CodeTimeout
+	case context.Canceled:
+		return e.Code == CodeCanceled
+	}
+	return false
+}
+
+func Errorf(status int, code, format string, args ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...), Status: status}
+}
+
+// ErrClosed 连接已断开
+var ErrClosed = &Error{Code: t.CodeUnavailable, Message: "connection closed", Status: http.StatusServiceUnavailable}
+
+// toError 把 handler 返回的错误转换成线上的格式，AppError 的状态码和错误码原样保留
+func toError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	if errors.Is(err, context.Canceled) {
+		return &Error{Code: CodeCanceled, Message: "Call canceled"}
+	}
+	ae := t.AsAppError(err)
+	return &Error{Code: ae.Code, Message: ae.Message, Status: ae.Status}
+}
+
+func writeFrame(w io.Writer, f *frame) error {
+	b, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	if len(b) > maxFrame {
+		return fmt.Errorf("ipc: frame of %d bytes exceeds the limit", len(b))
+	}
+	buf := make([]byte, 4, 4+len(b))
+	binary.BigEndian.PutUint32(buf, uint32(len(b)))
+	_, err = w.Write(append(buf, b...))
+	return err
+}
+
+func readFrame(r *bufio.Reader) (*frame, error) {
+	var head [4]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(head[:])
+	if n > maxFrame {
+		return nil, fmt.Errorf("ipc: frame of %d bytes exceeds the limit", n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	f := &frame{}
+	if err := json.Unmarshal(b, f); err != nil {
+		return nil, fmt.Errorf("ipc: bad frame: %w", err)
+	}
+	return f, nil
+}
@@ -0,0 +1,216 @@
+package ipc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/axuman/go-server/biz"
+)
+
+func TestFrame(t *testing.T) {
+	f := &frame{ID: 7, Type: typeRequest, Method: "hash", Deadline: 1700000000000, Data: json.RawMessage(`{"a":1}`)}
+	var buf bytes.Buffer
+	if err := writeFrame(&buf, f); err != nil {
+		t.Fatal(err)
+	}
+	if n := binary.BigEndian.Uint32(buf.Bytes()); int(n) != buf.Len()-4 {
+		t.Fatalf("length prefix = %d, body = %d", n, buf.Len()-4)
+	}
+	got, err := readFrame(bufio.NewReader(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != 7 || got.Type != typeRequest || got.Method != "hash" || got.Deadline != f.Deadline || string(got.Data) != `{"a":1}` {
+		t.Fatalf("got %+v", got)
+	}
+
+	raw := func(n uint32, body string) string {
+		var head [4]byte
+		binary.BigEndian.PutUint32(head[:], n)
+		return string(head[:]) + body
+	}
+	tests := []struct {
+		name string
+		in   string
+		err  string
+	}{
+		{"empty", "", "EOF"},
+		{"short header", "\x00\x00", "unexpected EOF"},
+		{"too large", raw(maxFrame+1, ""), "exceeds the limit"},
+		{"truncated body", raw(10, `{"id":1}`), "unexpected EOF"},
+		{"bad json", raw(5, `{"id"`), "bad frame"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readFrame(bufio.NewReader(strings.NewReader(tt.in)))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("err = %v, want %q", err, tt.err)
+			}
+		})
+	}
+
+	if err := writeFrame(io.Discard, &frame{Data: json.RawMessage(`"` + strings.Repeat("a", maxFrame) + `"`)}); err == nil {
+		t.Fatal("expected an oversized frame to be rejected")
+	}
+}
+
+func serve(t *testing.T) (*Server, string) {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "ipc.sock")
+	s := NewServer()
+	if err := s.Listen(socket); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close(context.Background()) })
+	return s, socket
+}
+
+func dial(t *testing.T, socket string) *Client {
+	t.Helper()
+	c, err := Dial(context.Background(), socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestCall(t *testing.T) {
+	s, socket := serve(t)
+	s.Handle("add", func(ctx context.Context, req json.RawMessage) (any, error) {
+		var in [2]int
+		if err := json.Unmarshal(req, &in); err != nil {
+			return nil, biz.BadRequest("bad input")
+		}
+		return in[0] + in[1], nil
+	})
+	s.Handle("boom", func(ctx context.Context, req json.RawMessage) (any, error) {
+		panic("boom")
+	})
+	s.HandleStream("count", func(ctx context.Context, req json.RawMessage, send func(v any) error) error {
+		for i := range 3 {
+			if err := send(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	c := dial(t, socket)
+	ctx := context.Background()
+
+	var sum int
+	if err := c.Call(ctx, "add", [2]int{1, 2}, &sum); err != nil || sum != 3 {
+		t.Fatalf("add = %d, %v", sum, err)
+	}
+
+	tests := []struct {
+		method string
+		in     any
+		code   string
+		status int
+	}{
+		{"add", "x", biz.CodeBadRequest, http.StatusBadRequest},
+		{"missing", nil, CodeMethodNotFound, http.StatusNotImplemented},
+		{"count", nil, biz.CodeBadRequest, http.StatusBadRequest}, // 流式方法不能用 Call
+		{"boom", nil, biz.CodeInternal, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		var e *Error
+		if err := c.Call(ctx, tt.method, tt.in, nil); !errors.As(err, &e) || e.Code != tt.code || e.Status != tt.status {
+			t.Errorf("%s: err = %v", tt.method, err)
+		}
+	}
+
+	st, err := c.Stream(ctx, "count", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for {
+		var n int
+		if err := st.Recv(&n); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, n)
+	}
+	if len(got) != 3 || got[2] != 2 {
+		t.Fatalf("stream = %v", got)
+	}
+}
+
+func TestCallCanceled(t *testing.T) {
+	s, socket := serve(t)
+	started := make(chan struct{})
+	canceled := make(chan error, 1)
+	s.Handle("wait", func(ctx context.Context, req json.RawMessage) (any, error) {
+		close(started)
+		<-ctx.Done()
+		canceled <- ctx.Err()
+		return nil, ctx.Err()
+	})
+	c := dial(t, socket)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- c.Call(ctx, "wait", nil, nil) }()
+	<-started
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Call = %v", err)
+	}
+	select {
+	case err := <-canceled:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("handler ctx = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the handler was not canceled")
+	}
+}
+
+// 服务端按帧里的 deadline 结束调用
+func TestCallDeadline(t *testing.T) {
+	s, socket := serve(t)
+	deadlines := make(chan time.Time, 1)
+	s.Handle("wait", func(ctx context.Context, req json.RawMessage) (any, error) {
+		d, _ := ctx.Deadline()
+		deadlines <- d
+		<-ctx.Done()
+		return nil, biz.AsAppError(ctx.Err())
+	})
+
+	nc, err := net.Dial("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	deadline := time.Now().Add(100 * time.Millisecond)
+	if err := writeFrame(nc, &frame{ID: 1, Type: typeRequest, Method: "wait", Deadline: deadline.UnixMilli()}); err != nil {
+		t.Fatal(err)
+	}
+	if d := <-deadlines; d.UnixMilli() != deadline.UnixMilli() {
+		t.Fatalf("handler deadline = %v, want %v", d, deadline)
+	}
+	nc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	f, err := readFrame(bufio.NewReader(nc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.ID != 1 || f.Type != typeError || !errors.Is(f.Error, context.DeadlineExceeded) {
+		t.Fatalf("got %+v %v", f, f.Error)
+	}
+
+}
@@ -0,0 +1,238 @@
+package ipc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	t "github.com/axuman/go-server/biz"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Registry 服务名到 socket 的映射，按需建立连接，断开后下次调用时重连。
+// sidecar 可以在启动时通过 registry.register 注册自己。
+type Registry struct {
+	mu       sync.Mutex
+	services map[string]*service
+	routes   []RouteSpec
+}
+
+type service struct {
+	name         string
+	socket       string
+	registeredAt time.Time
+
+	mu     sync.Mutex
+	client *Client
+}
+
+func NewRegistry() *Registry {
+	return &Registry{services: map[string]*service{}}
+}
+
+// Register 注册或更新服务，socket 变化时断开旧连接
+func (r *Registry) Register(name, socket string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if old, ok := r.services[name]; ok {
+		if old.socket == socket {
+			return
+		}
+		old.close()
+	}
+	r.services[name] = &service{name: name, socket: socket, registeredAt: time.Now()}
+}
+
+// Deregister 删除服务，返回服务是否存在
+func (r *Registry) Deregister(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.services[name]
+	if ok {
+		s.close()
+		delete(r.services, name)
+	}
+	return ok
+}
+
+// Client 返回服务的连接
+func (r *Registry) Client(ctx context.Context, name string) (*Client, error) {
+	r.mu.Lock()
+	s, ok := r.services[name]
+	r.mu.Unlock()
+	if !ok {
+		return nil, Errorf(http.StatusServiceUnavailable, t.CodeUnavailable, "service %q is not registered", name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client != nil {
+		select {
+		case <-s.client.Done():
+		default:
+			return s.client, nil
+		}
+	}
+	c, err := Dial(ctx, s.socket)
+	if err != nil {
+		return nil, Errorf(http.StatusServiceUnavailable, t.CodeUnavailable, "service %q is unavailable", name)
+	}
+	s.client = c
+	return c, nil
+}
+
+// Call 调用 service 的 method
+func (r *Registry) Call(ctx context.Context, service, method string, in, out any) error {
+	c, err := r.Client(ctx, service)
+	if err != nil {
+		return err
+	}
+	return c.Call(ctx, method, in, out)
+}
+
+// Stream 调用 service 的流式 method
+func (r *Registry) Stream(ctx context.Context, service, method string, in any) (*Stream, error) {
+	c, err := r.Client(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	return c.Stream(ctx, method, in)
+}
+
+// Close 断开所有连接
+func (r *Registry) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.services {
+		s.close()
+	}
+}
+
+func (s *service) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client != nil {
+		s.client.Close()
+		s.client = nil
+	}
+}
+
+// ServiceStatus 管理接口返回的服务状态
+type ServiceStatus struct {
+	Name         string    `json:"name"`
+	Socket       string    `json:"socket"`
+	Connected    bool      `json:"connected"`
+	RegisteredAt time.Time `json:"registered_at"`
+}
+
+func (r *Registry) List() []ServiceStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]ServiceStatus, 0, len(r.services))
+	for _, s := range r.services {
+		s.mu.Lock()
+		connected := s.client != nil
+		if connected {
+			select {
+			case <-s.client.Done():
+				connected = false
+			default:
+			}
+		}
+		s.mu.Unlock()
+		list = append(list, ServiceStatus{Name: s.name, Socket: s.socket, Connected: connected, RegisteredAt: s.registeredAt})
+	}
+	slices.SortFunc(list, func(a, b ServiceStatus) int { return strings.Compare(a.Name, b.Name) })
+	return list
+}
+
+// Status 管理接口
+func (r *Registry) Status(c *fiber.Ctx) error {
+	return c.JSON(r.List())
+}
+
+// Expose 在 s 上注册 registry.register、registry.deregister 和 registry.list
+func (r *Registry) Expose(s *Server) {
+	type registration struct {
+		Name   string `json:"name"`
+		Socket string `json:"socket"`
+	}
+	s.Handle("registry.register", func(ctx context.Context, req json.RawMessage) (any, error) {
+		var in registration
+		if err := json.Unmarshal(req, &in); err != nil || in.Name == "" || in.Socket == "" {
+			return nil, Errorf(http.StatusBadRequest, t.CodeBadRequest, "name and socket are required")
+		}
+		r.Register(in.Name, in.Socket)
+		return true, nil
+	})
+	s.Handle("registry.deregister", func(ctx context.Context, req json.RawMessage) (any, error) {
+		var in registration
+		if err := json.Unmarshal(req, &in); err != nil {
+			return nil, Errorf(http.StatusBadRequest, t.CodeBadRequest, "name is required")
+		}
+		return r.Deregister(in.Name), nil
+	})
+	s.Handle("registry.list", func(ctx context.Context, req json.RawMessage) (any, error) {
+		return r.List(), nil
+	})
+}
+
+// RouteSpec 把 sidecar 的方法暴露成 HTTP 接口，配置写法为
+// "POST /rs/hash rust.hash"，流式方法在最后加 stream
+type RouteSpec struct {
+	Method  string // HTTP 方法
+	Path    string
+	Service string
+	Call    string // sidecar 的方法名
+	Stream  bool
+}
+
+func ParseRoute(spec string) (RouteSpec, error) {
+	f := strings.Fields(spec)
+	stream := len(f) == 4 && f[3] == "stream"
+	if stream {
+		f = f[:3]
+	}
+	if len(f) != 3 {
+		return RouteSpec{}, fmt.Errorf("ipc route %q: want \"METHOD /path service.method [stream]\"", spec)
+	}
+	method := strings.ToUpper(f[0])
+	if !slices.Contains([]string{fiber.MethodGet, fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch, fiber.MethodDelete}, method) {
+		return RouteSpec{}, fmt.Errorf("ipc route %q: unsupported method %s", spec, f[0])
+	}
+	svc, call, ok := strings.Cut(f[2], ".")
+	if !strings.HasPrefix(f[1], "/") || !ok || svc == "" || call == "" {
+		return RouteSpec{}, fmt.Errorf("ipc route %q: want \"METHOD /path service.method [stream]\"", spec)
+	}
+	return RouteSpec{Method: method, Path: f[1], Service: svc, Call: call, Stream: stream}, nil
+}
+
+// AddRoute 解析并登记一条路由，由 Mount 注册到 Fiber
+func (r *Registry) AddRoute(spec string) error {
+	rs, err := ParseRoute(spec)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.routes = append(r.routes, rs)
+	r.mu.Unlock()
+	return nil
+}
+
+// Mount 注册 AddRoute 登记的路由
+func (r *Registry) Mount(router fiber.Router) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, rs := range r.routes {
+		if rs.Stream {
+			router.Add(rs.Method, rs.Path, StreamRoute(r, rs.Service, rs.Call))
+		} else {
+			router.Add(rs.Method, rs.Path, Route(r, rs.Service, rs.Call))
+		}
+	}
+}
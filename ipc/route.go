@@ -0,0 +1,110 @@
+package ipc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	t "github.com/axuman/go-server/biz"
+	"github.com/gofiber/fiber/v2"
+)
+
+// routeTimeout 请求没有截止时间时使用，和网关的默认超时一致
+const routeTimeout = 10 * time.Second
+
+// Route 把 service 的 method 暴露成 HTTP 接口。
+// 请求体作为参数原样传给 sidecar，没有请求体时传查询参数和路径参数组成的对象，返回值以 JSON 输出。
+func Route(r *Registry, service, method string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		in, err := input(c)
+		if err != nil {
+			return err
+		}
+		ctx := c.UserContext()
+		if _, ok := ctx.Deadline(); !ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, routeTimeout)
+			defer cancel()
+		}
+		var out json.RawMessage
+		if err := r.Call(ctx, service, method, in, &out); err != nil {
+			return httpError(err)
+		}
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return c.Send(out)
+	}
+}
+
+// StreamRoute 流式方法，每条消息输出一行 JSON（application/x-ndjson），
+// 中途出错时最后一行为 {"error": {...}}。流可能很长，不使用 routeTimeout
+func StreamRoute(r *Registry, service, method string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		in, err := input(c)
+		if err != nil {
+			return err
+		}
+		// handler 返回后才开始写响应，不能用会被中间件取消的 UserContext，只保留截止时间
+		ctx, cancel := context.Background(), context.CancelFunc(func() {})
+		if deadline, ok := c.UserContext().Deadline(); ok {
+			ctx, cancel = context.WithDeadline(ctx, deadline)
+		}
+		st, err := r.Stream(ctx, service, method, in)
+		if err != nil {
+			cancel()
+			return httpError(err)
+		}
+
+		c.Set(fiber.HeaderContentType, "application/x-ndjson")
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			defer cancel()
+			defer st.Close()
+			for {
+				var msg json.RawMessage
+				err := st.Recv(&msg)
+				if errors.Is(err, io.EOF) {
+					return
+				}
+				if err != nil {
+					e := toError(err)
+					line, _ := json.Marshal(fiber.Map{"error": e})
+					w.Write(append(line, '\n'))
+					w.Flush()
+					return
+				}
+				w.Write(append(msg, '\n'))
+				if w.Flush() != nil {
+					return // 客户端已断开
+				}
+			}
+		})
+		return nil
+	}
+}
+
+func input(c *fiber.Ctx) (json.RawMessage, error) {
+	if body := c.Body(); len(body) > 0 {
+		if !json.Valid(body) {
+			return nil, t.BadRequest("Request body must be JSON")
+		}
+		return append(json.RawMessage(nil), body...), nil
+	}
+	m := c.Queries()
+	for k, v := range c.AllParams() {
+		m[k] = v
+	}
+	return json.Marshal(m)
+}
+
+// httpError 使用 sidecar 返回的状态码和错误码，未指定状态码时为 502
+func httpError(err error) error {
+	e := toError(err)
+	status := e.Status
+	if status == 0 {
+		status = http.StatusBadGateway
+	}
+	return &t.AppError{Status: status, Code: e.Code, Message: e.Message, Err: err}
+}
@@ -0,0 +1,276 @@
+package ipc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	t "github.com/axuman/go-server/biz"
+)
+
+// Handler 普通方法，返回值编码为 JSON
+type Handler func(ctx context.Context, req json.RawMessage) (any, error)
+
+// StreamHandler 流式方法，每次 send 发送一条消息，返回后结束
+type StreamHandler func(ctx context.Context, req json.RawMessage, send func(v any) error) error
+
+type method struct {
+	handler Handler
+	stream  StreamHandler
+}
+
+type Server struct {
+	mu      sync.RWMutex
+	methods map[string]method
+
+	connsMu sync.Mutex
+	ln      net.Listener
+	conns   map[*serverConn]struct{}
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// NewServer 创建服务端，内置 ipc.ping 和 ipc.methods 两个方法
+func NewServer() *Server {
+	s := &Server{methods: map[string]method{}, conns: map[*serverConn]struct{}{}}
+	s.Handle("ipc.ping", func(ctx context.Context, req json.RawMessage) (any, error) {
+		return "pong", nil
+	})
+	s.Handle("ipc.methods", func(ctx context.Context, req json.RawMessage) (any, error) {
+		return s.Methods(), nil
+	})
+	return s
+}
+
+func (s *Server) Handle(name string, h Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.methods[name] = method{handler: h}
+}
+
+func (s *Server) HandleStream(name string, h StreamHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.methods[name] = method{stream: h}
+}
+
+// Methods 返回已注册的方法名
+func (s *Server) Methods() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.methods))
+	for name := range s.methods {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Listen 监听 Unix socket 并在后台处理连接
+func (s *Server) Listen(path string) error {
+	os.Remove(path) // 上次异常退出留下的 socket 文件
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	log.Printf("ipc: listening on %s", path)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.Serve(ln)
+	}()
+	return nil
+}
+
+// Serve 处理 ln 上的连接，直到 ln 关闭
+func (s *Server) Serve(ln net.Listener) error {
+	s.connsMu.Lock()
+	s.ln = ln
+	s.connsMu.Unlock()
+	for {
+		nc, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		c := &serverConn{s: s, nc: nc, calls: map[uint64]context.CancelFunc{}}
+		s.connsMu.Lock()
+		if s.closed {
+			s.connsMu.Unlock()
+			nc.Close()
+			return nil
+		}
+		s.conns[c] = struct{}{}
+		s.connsMu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			c.serve()
+		}()
+	}
+}
+
+// Close 停止监听，取消所有进行中的调用并断开连接
+func (s *Server) Close(ctx context.Context) error {
+	s.connsMu.Lock()
+	s.closed = true
+	if s.ln != nil {
+		s.ln.Close()
+	}
+	for c := range s.conns {
+		c.nc.Close()
+	}
+	s.connsMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type serverConn struct {
+	s   *Server
+	nc  net.Conn
+	wmu sync.Mutex
+
+	mu    sync.Mutex
+	calls map[uint64]context.CancelFunc
+}
+
+func (c *serverConn) serve() {
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls sync.WaitGroup
+	defer func() {
+		cancel()
+		c.nc.Close()
+		calls.Wait()
+		c.s.connsMu.Lock()
+		delete(c.s.conns, c)
+		c.s.connsMu.Unlock()
+	}()
+
+	r := bufio.NewReader(c.nc)
+	for {
+		f, err := readFrame(r)
+		if err != nil {
+			return
+		}
+		switch f.Type {
+		case typeRequest:
+			calls.Add(1)
+			go func() {
+				defer calls.Done()
+				c.call(ctx, f)
+			}()
+		case typeCancel:
+			c.mu.Lock()
+			if cancel, ok := c.calls[f.ID]; ok {
+				cancel()
+			}
+			c.mu.Unlock()
+		}
+	}
+}
+
+func (c *serverConn) call(parent context.Context, f *frame) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if f.Deadline > 0 {
+		ctx, cancel = context.WithDeadline(parent, time.UnixMilli(f.Deadline))
+	} else {
+		ctx, cancel = context.WithCancel(parent)
+	}
+	c.mu.Lock()
+	c.calls[f.ID] = cancel
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.calls, f.ID)
+		c.mu.Unlock()
+		cancel()
+	}()
+
+	c.s.mu.RLock()
+	m, ok := c.s.methods[f.Method]
+	c.s.mu.RUnlock()
+	switch {
+	case !ok:
+		c.fail(f.ID, Errorf(http.StatusNotImplemented, CodeMethodNotFound, "method %q is not registered", f.Method))
+		return
+	case f.Stream != (m.stream != nil):
+		c.fail(f.ID, Errorf(http.StatusBadRequest, t.CodeBadRequest, "method %q stream mismatch", f.Method))
+		return
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			c.fail(f.ID, fmt.Errorf("%s panicked: %v", f.Method, p))
+		}
+	}()
+
+	if m.stream != nil {
+		err := m.stream(ctx, f.Data, func(v any) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			data, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			return c.send(&frame{ID: f.ID, Type: typeMessage, Data: data})
+		})
+		if err != nil {
+			c.fail(f.ID, err)
+			return
+		}
+		c.send(&frame{ID: f.ID, Type: typeEnd})
+		return
+	}
+
+	v, err := m.handler(ctx, f.Data)
+	if err != nil {
+		c.fail(f.ID, err)
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		c.fail(f.ID, err)
+		return
+	}
+	c.send(&frame{ID: f.ID, Type: typeReply, Data: data})
+}
+
+// fail 返回错误，未知错误只把通用提示返回给客户端，原因写日志
+func (c *serverConn) fail(id uint64, err error) {
+	e := toError(err)
+	if e.Code == t.CodeInternal {
+		log.Printf("ipc: call %d failed: %v", id, err)
+	}
+	c.send(&frame{ID: id, Type: typeError, Error: e})
+}
+
+func (c *serverConn) send(f *frame) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.nc.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return writeFrame(c.nc, f)
+}
@@ -0,0 +1,114 @@
+package lowcode
+
+import (
+	"encoding/json"
+	"strings"
+
+	t "github.com/axuman/go-server/biz"
+	"github.com/gofiber/fiber/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Admin 注册实体定义的管理接口，router 通常是 /admin/entities
+//
+//	GET    /                  所有定义
+//	POST   /                  新建实体并建表
+//	GET    /:name             一个定义
+//	PUT    /:name             演进定义，新增/删除字段和索引，修改规则
+//	DELETE /:name?confirm=名称 删除定义和表
+//	GET    /:name/migrations  变更历史
+//
+// POST 和 PUT 带 ?dry_run=true 时只返回将要执行的语句。
+// 定义默认为 JSON，Content-Type 含 yaml 时按 YAML 解析。
+func (e *Engine) Admin(router fiber.Router) {
+	router.Get("/", e.listDefinitions)
+	router.Post("/", e.createDefinition)
+	router.Get("/:name", e.getDefinition)
+	router.Put("/:name", e.updateDefinition)
+	router.Delete("/:name", e.dropDefinition)
+	router.Get("/:name/migrations", e.getMigrations)
+}
+
+func (e *Engine) listDefinitions(c *fiber.Ctx) error {
+	return c.JSON(e.Definitions())
+}
+
+func (e *Engine) getDefinition(c *fiber.Ctx) error {
+	def := e.Definition(c.Params("name"))
+	if def == nil {
+		return t.NotFound("Entity not found")
+	}
+	return c.JSON(def)
+}
+
+func (e *Engine) createDefinition(c *fiber.Ctx) error {
+	def, err := parseDefinition(c)
+	if err != nil {
+		return err
+	}
+	result, stmts, err := e.Create(c.UserContext(), def, c.QueryBool("dry_run"))
+	if err != nil {
+		return t.Wrap(err, "Could not create entity")
+	}
+	return c.Status(fiber.StatusCreated).JSON(definitionResult(result, stmts))
+}
+
+func (e *Engine) updateDefinition(c *fiber.Ctx) error {
+	def, err := parseDefinition(c)
+	if err != nil {
+		return err
+	}
+	name := c.Params("name")
+	if def.Name != "" && def.Name != name {
+		return t.BadRequest("Entity cannot be renamed")
+	}
+	def.Name = name
+	result, stmts, err := e.Update(c.UserContext(), def, c.QueryBool("dry_run"))
+	if err != nil {
+		return t.Wrap(err, "Could not update entity")
+	}
+	return c.JSON(definitionResult(result, stmts))
+}
+
+func (e *Engine) dropDefinition(c *fiber.Ctx) error {
+	name := c.Params("name")
+	if c.Query("confirm") != name {
+		return t.BadRequest("Dropping an entity deletes its table, pass ?confirm=" + name)
+	}
+	if err := e.Drop(c.UserContext(), name); err != nil {
+		return t.Wrap(err, "Could not drop entity")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (e *Engine) getMigrations(c *fiber.Ctx) error {
+	list, err := e.Migrations(c.UserContext(), c.Params("name"))
+	if err != nil {
+		return t.Wrap(err, "Could not read migrations")
+	}
+	return c.JSON(list)
+}
+
+func definitionResult(def *Definition, stmts []string) fiber.Map {
+	return fiber.Map{"definition": def, "statements": stmts}
+}
+
+// parseDefinition 解析请求中的定义，YAML 先转成 JSON，数字同样保留为 json.Number
+func parseDefinition(c *fiber.Ctx) (Definition, error) {
+	var def Definition
+	raw := c.Body()
+	if strings.Contains(c.Get(fiber.HeaderContentType), "yaml") {
+		var doc any
+		if err := yaml.Unmarshal(raw, &doc); err != nil {
+			return def, t.BadRequest("Cannot parse YAML").WithDetails(err.Error())
+		}
+		var err error
+		if raw, err = json.Marshal(doc); err != nil {
+			return def, t.BadRequest("Cannot parse YAML").WithDetails(err.Error())
+		}
+	}
+	if err := decode(raw, &def); err != nil {
+		return def, t.BadRequest("Cannot parse JSON").WithDetails(err.Error())
+	}
+	return def, nil
+}
@@ -0,0 +1,152 @@
+package lowcode
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	t "github.com/axuman/go-server/biz"
+)
+
+// sqliteTime 与 CURRENT_TIMESTAMP 写入的格式一致
+const sqliteTime = "2006-01-02 15:04:05"
+
+// indexName 声明的索引名，unique 与普通索引可以建在相同的字段上
+func (d *Definition) indexName(idx Index) string {
+	name := d.Table() + "_" + strings.Join(idx.Fields, "_")
+	if idx.Unique {
+		name += "_unique"
+	}
+	return name
+}
+
+// indexes 返回索引名到建索引语句的映射，包括排序字段的 (deleted_at, 字段, id) 索引
+func (d *Definition) indexes() map[string]string {
+	table := d.Table()
+	m := map[string]string{}
+	for _, f := range d.Fields {
+		if f.Sort {
+			name := table + "_deleted_at_" + f.Name + "_id"
+			m[name] = "CREATE INDEX " + name + " ON " + table + " (deleted_at, " + f.Name + ", id)"
+		}
+	}
+	for _, idx := range d.Indexes {
+		name := d.indexName(idx)
+		stmt := "INDEX " + name + " ON " + table + " (" + strings.Join(idx.Fields, ", ") + ")"
+		if idx.Unique {
+			stmt = "UNIQUE " + stmt + " WHERE deleted_at IS NULL"
+		}
+		m[name] = "CREATE " + stmt
+	}
+	return m
+}
+
+func columnDef(f Field) string {
+	def := f.Name + " " + types[f.Type].sql
+	if f.Required {
+		def += " NOT NULL"
+	}
+	if f.Default != nil {
+		def += " DEFAULT " + literal(f.Default)
+	}
+	return def
+}
+
+// literal 把已经 coerce 过的 default 写成 SQL 字面量
+func literal(v any) string {
+	switch v := v.(type) {
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		return "'" + v.UTC().Format(sqliteTime) + "'"
+	}
+	return "NULL"
+}
+
+// createStatements 新实体的建表和建索引语句
+func createStatements(d *Definition) []string {
+	cols := []string{"id INTEGER PRIMARY KEY AUTOINCREMENT"}
+	for _, f := range d.Fields {
+		cols = append(cols, columnDef(f))
+	}
+	cols = append(cols,
+		"created_at DATETIME DEFAULT CURRENT_TIMESTAMP",
+		"updated_at DATETIME DEFAULT CURRENT_TIMESTAMP",
+		"deleted_at DATETIME DEFAULT NULL",
+	)
+	stmts := []string{"CREATE TABLE " + d.Table() + " (\n\t" + strings.Join(cols, ",\n\t") + "\n)"}
+	return append(stmts, sortedValues(d.indexes())...)
+}
+
+// evolveStatements 从 old 演进到 d 的语句
+//
+// 支持新增和删除字段、增删索引、修改校验/过滤/排序/默认值。字段类型和 required 不能修改，
+// SQLite 需要重建表才能做到，可以新增一个字段代替。
+func evolveStatements(old, d *Definition) ([]string, error) {
+	table := d.Table()
+	for _, f := range d.Fields {
+		prev, ok := old.field(f.Name)
+		switch {
+		case !ok:
+			if f.Required && f.Default == nil {
+				return nil, t.BadRequest(fmt.Sprintf("Required field %q needs a default to be added to an existing table", f.Name))
+			}
+		case prev.Type != f.Type:
+			return nil, t.BadRequest(fmt.Sprintf("Cannot change type of field %q, add a new field instead", f.Name))
+		case prev.Required != f.Required:
+			return nil, t.BadRequest(fmt.Sprintf("Cannot change required of field %q, add a new field instead", f.Name))
+		}
+	}
+
+	stmts := []string{}
+	oldIdx, newIdx := old.indexes(), d.indexes()
+	for _, name := range sortedKeys(oldIdx) {
+		if _, ok := newIdx[name]; !ok {
+			stmts = append(stmts, "DROP INDEX IF EXISTS "+name)
+		}
+	}
+	for _, f := range old.Fields {
+		if _, ok := d.field(f.Name); !ok {
+			stmts = append(stmts, "ALTER TABLE "+table+" DROP COLUMN "+f.Name)
+		}
+	}
+	for _, f := range d.Fields {
+		if _, ok := old.field(f.Name); !ok {
+			stmts = append(stmts, "ALTER TABLE "+table+" ADD COLUMN "+columnDef(f))
+		}
+	}
+	for _, name := range sortedKeys(newIdx) {
+		if _, ok := oldIdx[name]; !ok {
+			stmts = append(stmts, newIdx[name])
+		}
+	}
+	return stmts, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func sortedValues(m map[string]string) []string {
+	values := make([]string, 0, len(m))
+	for _, k := range sortedKeys(m) {
+		values = append(values, m[k])
+	}
+	return values
+}
@@ -0,0 +1,289 @@
+// Package lowcode 运行时定义的实体：用 JSON 或 YAML 描述字段、类型、校验、索引和过滤排序规则，
+// 引擎负责建表和演进表结构，并提供与 /dmail/mall 相同的 q/c/u/bc/bd 接口，不需要重新编译。
+//
+// 定义示例（YAML 的结构相同，管理接口按 Content-Type 区分）:
+//
+//	{
+//	  "name": "product",
+//	  "fields": [
+//	    {"name": "title", "type": "string", "required": true, "validate": "min=2,max=100", "filter": ["eq", "like", "prefix"], "sort": true},
+//	    {"name": "price", "type": "float", "default": 0, "validate": "gte=0", "filter": ["gte", "lte"]},
+//	    {"name": "sku", "type": "string", "required": true}
+//	  ],
+//	  "indexes": [{"fields": ["sku"], "unique": true}]
+//	}
+package lowcode
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	t "github.com/axuman/go-server/biz"
+)
+
+// 字段类型
+const (
+	TypeString = "string"
+	TypeInt    = "int"
+	TypeFloat  = "float"
+	TypeBool   = "bool"
+	TypeTime   = "time"
+)
+
+const (
+	// TablePrefix 实体表名前缀，避免与内置表冲突
+	TablePrefix = "lc_"
+
+	maxFields = 64
+)
+
+var identifier = regexp.MustCompile(`^[a-z][a-z0-9_]{0,47}$`)
+
+// reservedFields 每张表都有的公共列
+var reservedFields = map[string]bool{"id": true, "created_at": true, "updated_at": true, "deleted_at": true}
+
+// sqlKeywords SQLite 的关键字，字段名会直接拼进 SQL，不能使用
+var sqlKeywords = func() map[string]bool {
+	m := map[string]bool{}
+	for _, k := range strings.Fields(`abort action add after all alter always analyze and as asc attach
+		autoincrement before begin between by cascade case cast check collate column commit conflict
+		constraint create cross current current_date current_time current_timestamp database default
+		deferrable deferred delete desc detach distinct do drop each else end escape except exclude
+		exclusive exists explain fail filter first following for foreign from full generated glob group
+		groups having if ignore immediate in index indexed initially inner insert instead intersect into
+		is isnull join key last left like limit match materialized natural no not nothing notnull null
+		nulls of offset on or order others outer over partition plan pragma preceding primary query raise
+		range recursive references regexp reindex release rename replace restrict returning right rollback
+		row rows savepoint select set table temp temporary then ties to transaction trigger unbounded union
+		unique update using vacuum values view virtual when where window with without`) {
+		m[k] = true
+	}
+	return m
+}()
+
+type typeInfo struct {
+	sql  string
+	kind t.Kind
+	goT  reflect.Type
+}
+
+var types = map[string]typeInfo{
+	TypeString: {"TEXT", t.KindString, reflect.TypeFor[string]()},
+	TypeInt:    {"INTEGER", t.KindInt, reflect.TypeFor[int64]()},
+	TypeFloat:  {"REAL", t.KindFloat, reflect.TypeFor[float64]()},
+	TypeBool:   {"INTEGER", t.KindBool, reflect.TypeFor[bool]()},
+	TypeTime:   {"DATETIME", t.KindTime, reflect.TypeFor[time.Time]()},
+}
+
+// Definition 一个实体的定义
+type Definition struct {
+	Name    string  `json:"name"` // 小写字母、数字和下划线，接口路径为 /lc/<name>
+	Fields  []Field `json:"fields"`
+	Indexes []Index `json:"indexes,omitempty"`
+
+	Version   int       `json:"version"` // 每次演进加 1，由服务端维护
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Field 一个字段，同时也是表中的一列
+type Field struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`               // string、int、float、bool、time
+	Required bool   `json:"required,omitempty"` // NOT NULL，加到已有的表上时必须有 default
+	Default  any    `json:"default,omitempty"`  // 新建和全量更新时缺省的值
+	Validate string `json:"validate,omitempty"` // validator 规则，例如 min=2,max=50，只在有值时校验
+	Filter   []t.Op `json:"filter,omitempty"`   // 允许的过滤操作符
+	Sort     bool   `json:"sort,omitempty"`     // 允许排序，排序列必须 required
+}
+
+// Index 一个索引，unique 索引只约束未删除的记录
+type Index struct {
+	Fields []string `json:"fields"`
+	Unique bool     `json:"unique,omitempty"`
+}
+
+// Table 实体对应的表名
+func (d *Definition) Table() string {
+	return TablePrefix + d.Name
+}
+
+func (d *Definition) field(name string) (Field, bool) {
+	for _, f := range d.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// check 校验定义，并把 default 转换成字段类型
+func (d *Definition) check() error {
+	if !identifier.MatchString(d.Name) {
+		return t.BadRequest("Entity name must match " + identifier.String())
+	}
+	if len(d.Fields) == 0 || len(d.Fields) > maxFields {
+		return t.BadRequest(fmt.Sprintf("Entity must have 1 to %d fields", maxFields))
+	}
+	seen := map[string]bool{}
+	for i := range d.Fields {
+		f := &d.Fields[i]
+		switch {
+		case !identifier.MatchString(f.Name):
+			return t.BadRequest(fmt.Sprintf("Field name %q must match %s", f.Name, identifier))
+		case reservedFields[f.Name]:
+			return t.BadRequest(fmt.Sprintf("Field name %q is reserved", f.Name))
+		case sqlKeywords[f.Name]:
+			return t.BadRequest(fmt.Sprintf("Field name %q is an SQL keyword", f.Name))
+		case seen[f.Name]:
+			return t.BadRequest(fmt.Sprintf("Duplicate field %q", f.Name))
+		case types[f.Type].sql == "":
+			return t.BadRequest(fmt.Sprintf("Field %q has unknown type %q", f.Name, f.Type))
+		case f.Sort && !f.Required:
+			return t.BadRequest(fmt.Sprintf("Sortable field %q must be required", f.Name))
+		}
+		seen[f.Name] = true
+		for _, op := range f.Filter {
+			if !op.Valid() {
+				return t.BadRequest(fmt.Sprintf("Field %q has unknown filter operator %q", f.Name, op))
+			}
+		}
+		if f.Default != nil {
+			v, err := coerce(*f, f.Default)
+			if err != nil {
+				return t.BadRequest(fmt.Sprintf("Default of field %q: %v", f.Name, err))
+			}
+			f.Default = v
+		}
+	}
+
+	names := map[string]bool{}
+	for _, idx := range d.Indexes {
+		if len(idx.Fields) == 0 {
+			return t.BadRequest("Index must have at least one field")
+		}
+		for _, name := range idx.Fields {
+			if !seen[name] {
+				return t.BadRequest(fmt.Sprintf("Index references unknown field %q", name))
+			}
+		}
+		name := d.indexName(idx)
+		if names[name] {
+			return t.BadRequest("Duplicate index on " + strings.Join(idx.Fields, ", "))
+		}
+		names[name] = true
+	}
+
+	// 校验规则写错时 validator 会 panic，在定义时先逐个字段跑一遍
+	for _, f := range d.Fields {
+		if err := checkRule(f); err != nil {
+			return t.BadRequest(fmt.Sprintf("Field %q has invalid validate rule: %v", f.Name, err))
+		}
+	}
+	return nil
+}
+
+func checkRule(f Field) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			msg, _, _ := strings.Cut(fmt.Sprint(p), " on field ")
+			err = errors.New(msg)
+		}
+	}()
+	t.Validate(reflect.New(validationType(&Definition{Fields: []Field{f}})).Interface(), "")
+	return nil
+}
+
+// schema 生成 Repository 使用的表结构
+func (d *Definition) schema() *t.Schema {
+	s := &t.Schema{Table: d.Table(), Entity: d.Table()}
+	for _, f := range d.Fields {
+		s.Columns = append(s.Columns, t.Column{
+			Name:     f.Name,
+			Key:      f.Name,
+			Kind:     types[f.Type].kind,
+			Ops:      f.Filter,
+			Sortable: f.Sort,
+		})
+	}
+	return s
+}
+
+// validationType 生成带 validate 标签的结构体类型，复用 t.Validate 的翻译和错误格式
+func validationType(d *Definition) reflect.Type {
+	fields := make([]reflect.StructField, len(d.Fields))
+	for i, f := range d.Fields {
+		rule := "omitempty"
+		if f.Required {
+			rule = "required"
+		}
+		if f.Validate != "" {
+			rule += "," + f.Validate
+		}
+		fields[i] = reflect.StructField{
+			Name: "F" + strconv.Itoa(i),
+			Type: reflect.PointerTo(types[f.Type].goT),
+			Tag:  reflect.StructTag(`json:"` + f.Name + `" validate:"` + rule + `"`),
+		}
+	}
+	return reflect.StructOf(fields)
+}
+
+// coerce 把 JSON 中的值转换成字段类型，数字可以是 json.Number 或 float64
+func coerce(f Field, v any) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	switch f.Type {
+	case TypeString:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case TypeInt:
+		switch n := v.(type) {
+		case json.Number:
+			if i, err := n.Int64(); err == nil {
+				return i, nil
+			}
+		case float64:
+			if i := int64(n); float64(i) == n {
+				return i, nil
+			}
+		case int64:
+			return n, nil
+		}
+	case TypeFloat:
+		switch n := v.(type) {
+		case json.Number:
+			if x, err := n.Float64(); err == nil {
+				return x, nil
+			}
+		case float64:
+			return n, nil
+		case int64:
+			return float64(n), nil
+		}
+	case TypeBool:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	case TypeTime:
+		switch s := v.(type) {
+		case string:
+			for _, layout := range []string{time.RFC3339Nano, time.DateTime, time.DateOnly} {
+				if tm, err := time.Parse(layout, s); err == nil {
+					return tm.UTC(), nil
+				}
+			}
+		case time.Time:
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("must be of type %s", f.Type)
+}
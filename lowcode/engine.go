@@ -0,0 +1,278 @@
+package lowcode
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	t "github.com/axuman/go-server/biz"
+	"github.com/axuman/go-server/cache"
+	"github.com/gofiber/fiber/v2"
+)
+
+// entity 一个已编译的定义
+type entity struct {
+	def        *Definition
+	schema     *t.Schema
+	typ        reflect.Type  // 校验用的结构体
+	cached     fiber.Handler // q 接口的缓存
+	invalidate fiber.Handler // 写接口之后使缓存失效
+}
+
+// Engine 管理实体定义和对应的表，定义存放在 lowcode_entities 表中
+type Engine struct {
+	db    *sql.DB
+	cache *cache.Cache
+
+	mu       sync.RWMutex
+	entities map[string]*entity
+
+	define sync.Mutex // 串行执行定义变更
+}
+
+// Migration 一次定义变更执行的语句，只改校验、过滤等规则时 Statements 为空
+type Migration struct {
+	Version    int       `json:"version"`
+	Statements []string  `json:"statements"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// New 加载已有的定义，c 为 nil 时 q 接口不缓存
+func New(ctx context.Context, db *sql.DB, c *cache.Cache) (*Engine, error) {
+	e := &Engine{db: db, cache: c, entities: map[string]*entity{}}
+	rows, err := db.QueryContext(ctx, "SELECT name, definition, version, created_at, updated_at FROM lowcode_entities")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, raw string
+		var def Definition
+		if err := rows.Scan(&name, &raw, &def.Version, &def.CreatedAt, &def.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if err := decode([]byte(raw), &def); err != nil {
+			return nil, fmt.Errorf("lowcode entity %s: %w", name, err)
+		}
+		if err := def.check(); err != nil {
+			return nil, fmt.Errorf("lowcode entity %s: %w", name, err)
+		}
+		e.entities[name] = e.compile(&def)
+	}
+	return e, rows.Err()
+}
+
+func (e *Engine) compile(def *Definition) *entity {
+	return &entity{
+		def:        def,
+		schema:     def.schema(),
+		typ:        validationType(def),
+		cached:     e.cache.Route(def.Table(), 0),
+		invalidate: e.cache.Invalidate(def.Table()),
+	}
+}
+
+func (e *Engine) entity(name string) *entity {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.entities[name]
+}
+
+// Definitions 按名称排序返回所有定义
+func (e *Engine) Definitions() []*Definition {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	list := make([]*Definition, 0, len(e.entities))
+	for _, name := range slices.Sorted(maps.Keys(e.entities)) {
+		list = append(list, e.entities[name].def)
+	}
+	return list
+}
+
+// Tables 返回所有实体的表名
+func (e *Engine) Tables() []string {
+	defs := e.Definitions()
+	tables := make([]string, len(defs))
+	for i, def := range defs {
+		tables[i] = def.Table()
+	}
+	return tables
+}
+
+// Definition 返回实体的定义，不存在时返回 nil
+func (e *Engine) Definition(name string) *Definition {
+	if en := e.entity(name); en != nil {
+		return en.def
+	}
+	return nil
+}
+
+// Create 新建实体并建表，dryRun 时只返回将要执行的语句
+func (e *Engine) Create(ctx context.Context, def Definition, dryRun bool) (*Definition, []string, error) {
+	return e.apply(ctx, def, false, dryRun)
+}
+
+// Update 演进已有的实体，dryRun 时只返回将要执行的语句
+func (e *Engine) Update(ctx context.Context, def Definition, dryRun bool) (*Definition, []string, error) {
+	return e.apply(ctx, def, true, dryRun)
+}
+
+func (e *Engine) apply(ctx context.Context, def Definition, exists, dryRun bool) (*Definition, []string, error) {
+	if err := def.check(); err != nil {
+		return nil, nil, err
+	}
+	e.define.Lock()
+	defer e.define.Unlock()
+
+	cur := e.entity(def.Name)
+	switch {
+	case exists && cur == nil:
+		return nil, nil, t.NotFound("Entity not found")
+	case !exists && cur != nil:
+		return nil, nil, t.NewError(fiber.StatusConflict, t.CodeConflict, "Entity already exists")
+	}
+
+	stmts := []string{}
+	now := time.Now().UTC().Truncate(time.Second)
+	def.Version, def.CreatedAt, def.UpdatedAt = 1, now, now
+	if cur != nil {
+		var err error
+		if stmts, err = evolveStatements(cur.def, &def); err != nil {
+			return nil, nil, err
+		}
+		if len(stmts) == 0 && sameRules(cur.def, &def) {
+			return cur.def, stmts, nil
+		}
+		def.Version, def.CreatedAt = cur.def.Version+1, cur.def.CreatedAt
+	} else {
+		// 删除后重建的同名实体接着之前的版本号，变更历史不会重复
+		var last int
+		if err := e.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM lowcode_migrations WHERE entity = ?", def.Name).Scan(&last); err != nil {
+			return nil, nil, err
+		}
+		def.Version = last + 1
+		stmts = createStatements(&def)
+	}
+	if dryRun {
+		return &def, stmts, nil
+	}
+
+	raw, err := json.Marshal(struct {
+		Name    string  `json:"name"`
+		Fields  []Field `json:"fields"`
+		Indexes []Index `json:"indexes,omitempty"`
+	}{def.Name, def.Fields, def.Indexes})
+	if err != nil {
+		return nil, nil, err
+	}
+	err = e.migrate(ctx, def.Name, def.Version, stmts, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `INSERT INTO lowcode_entities (name, definition, version, created_at, updated_at) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (name) DO UPDATE SET definition = excluded.definition, version = excluded.version, updated_at = excluded.updated_at`,
+			def.Name, string(raw), def.Version, def.CreatedAt.Format(sqliteTime), def.UpdatedAt.Format(sqliteTime))
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	en := e.compile(&def)
+	e.mu.Lock()
+	e.entities[def.Name] = en
+	e.mu.Unlock()
+	if e.cache != nil {
+		e.cache.Bump(def.Table())
+	}
+	return &def, stmts, nil
+}
+
+// Drop 删除实体的定义和表，表中的数据不可恢复
+func (e *Engine) Drop(ctx context.Context, name string) error {
+	e.define.Lock()
+	defer e.define.Unlock()
+
+	cur := e.entity(name)
+	if cur == nil {
+		return t.NotFound("Entity not found")
+	}
+	stmts := []string{"DROP TABLE IF EXISTS " + cur.def.Table()}
+	err := e.migrate(ctx, name, cur.def.Version+1, stmts, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "DELETE FROM lowcode_entities WHERE name = ?", name)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	delete(e.entities, name)
+	e.mu.Unlock()
+	if e.cache != nil {
+		e.cache.Bump(cur.def.Table())
+	}
+	return nil
+}
+
+// migrate 在一个事务中执行 DDL、更新定义并记录到 lowcode_migrations
+func (e *Engine) migrate(ctx context.Context, name string, version int, stmts []string, save func(tx *sql.Tx) error) error {
+	tx, err := e.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("%s: %w", stmt, err)
+		}
+	}
+	if err := save(tx); err != nil {
+		return err
+	}
+	raw, _ := json.Marshal(stmts)
+	if _, err := tx.ExecContext(ctx, "INSERT INTO lowcode_migrations (entity, version, statements) VALUES (?, ?, ?)", name, version, string(raw)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Migrations 返回实体的变更历史，包括已删除的同名实体
+func (e *Engine) Migrations(ctx context.Context, name string) ([]Migration, error) {
+	rows, err := e.db.QueryContext(ctx, "SELECT version, statements, created_at FROM lowcode_migrations WHERE entity = ? ORDER BY id", name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []Migration{}
+	for rows.Next() {
+		var m Migration
+		var raw string
+		if err := rows.Scan(&m.Version, &raw, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(raw), &m.Statements); err != nil {
+			return nil, err
+		}
+		list = append(list, m)
+	}
+	return list, rows.Err()
+}
+
+// sameRules 表结构以外的部分（校验、过滤、排序、默认值、字段顺序）是否相同
+func sameRules(a, b *Definition) bool {
+	ra, _ := json.Marshal(a.Fields)
+	rb, _ := json.Marshal(b.Fields)
+	return bytes.Equal(ra, rb)
+}
+
+// decode 解析 JSON，数字保留为 json.Number 以区分整数和浮点数
+func decode(raw []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
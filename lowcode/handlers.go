@@ -0,0 +1,266 @@
+package lowcode
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+
+	t "github.com/axuman/go-server/biz"
+	"github.com/gofiber/fiber/v2"
+)
+
+const entityKey = "lowcode.entity"
+
+// Mount 注册所有实体的 q/c/u/bc/bd/restore 接口，例如 GET /lc/product/q，实体在请求时按名称查找
+func (e *Engine) Mount(router fiber.Router, middlewares ...fiber.Handler) {
+	group := router.Group("/lc", middlewares...)
+	group.Get("/:entity/q", e.lookup, cached, e.query)
+	group.Post("/:entity/c", e.lookup, invalidate, e.create)
+	group.Put("/:entity/u", e.lookup, invalidate, e.update)
+	group.Post("/:entity/bc", e.lookup, invalidate, e.batchCreate)
+	group.Delete("/:entity/bd", e.lookup, invalidate, e.batchDelete)
+	group.Post("/:entity/restore", e.lookup, invalidate, e.restore)
+}
+
+func (e *Engine) lookup(c *fiber.Ctx) error {
+	en := e.entity(c.Params("entity"))
+	if en == nil {
+		return t.NotFound("Entity not found")
+	}
+	c.Locals(entityKey, en)
+	return c.Next()
+}
+
+func entityOf(c *fiber.Ctx) *entity {
+	return c.Locals(entityKey).(*entity)
+}
+
+func cached(c *fiber.Ctx) error {
+	return entityOf(c).cached(c)
+}
+
+func invalidate(c *fiber.Ctx) error {
+	return entityOf(c).invalidate(c)
+}
+
+func (e *Engine) repo(en *entity) *t.Repository[t.Record] {
+	return &t.Repository[t.Record]{DB: e.db, Schema: en.schema, Events: true}
+}
+
+func (e *Engine) query(c *fiber.Ctx) error {
+	en := entityOf(c)
+	var q struct {
+		ID      *int64 `query:"id"`
+		PN      int    `query:"pn"`
+		PS      int    `query:"ps"`
+		Sort    string `query:"sort"`
+		Cursor  string `query:"cursor"`
+		Count   bool   `query:"count"`
+		Deleted string `query:"deleted"`
+	}
+	if err := c.QueryParser(&q); err != nil {
+		return t.BadRequest("Cannot parse query parameters").WithDetails(err.Error())
+	}
+	payload := &t.PaginatorWith[t.Record]{ID: q.ID, PN: q.PN, PS: q.PS, Sort: q.Sort, Cursor: q.Cursor, Count: q.Count, Deleted: q.Deleted}
+	payload.SetDefaults()
+
+	values, err := url.ParseQuery(string(c.Request().URI().QueryString()))
+	if err == nil {
+		err = payload.ParseQueryWith(en.schema, values)
+	}
+	if err != nil {
+		return t.AsAppError(err)
+	}
+
+	page, err := e.repo(en).List(c.UserContext(), payload)
+	if err != nil {
+		return t.Wrap(err, "Could not query "+en.def.Name)
+	}
+	return c.JSON(page)
+}
+
+func (e *Engine) create(c *fiber.Ctx) error {
+	en := entityOf(c)
+	rec, err := en.record(c.Body(), "", c.Get(fiber.HeaderAcceptLanguage))
+	if err != nil {
+		return err
+	}
+
+	row, err := e.repo(en).Create(c.UserContext(), &rec)
+	if err != nil {
+		return t.Wrap(err, "Could not create "+en.def.Name)
+	}
+	return c.Status(fiber.StatusCreated).JSON(row)
+}
+
+func (e *Engine) update(c *fiber.Ctx) error {
+	en := entityOf(c)
+	var payload struct {
+		ID *int64          `json:"id"`
+		D  json.RawMessage `json:"D"`
+	}
+	if err := c.BodyParser(&payload); err != nil {
+		return t.BadRequest("Cannot parse JSON").WithDetails(err.Error())
+	}
+	if payload.ID == nil {
+		return t.BadRequest("ID is required for update")
+	}
+	rec, err := en.record(payload.D, "", c.Get(fiber.HeaderAcceptLanguage))
+	if err != nil {
+		return err
+	}
+
+	row, err := e.repo(en).Update(c.UserContext(), *payload.ID, &rec)
+	if err != nil {
+		if errors.Is(err, t.ErrNotFound) {
+			return t.NotFound("Record not found or already deleted")
+		}
+		return t.Wrap(err, "Could not update "+en.def.Name)
+	}
+	return c.JSON(row)
+}
+
+func (e *Engine) batchCreate(c *fiber.Ctx) error {
+	en := entityOf(c)
+	var items []json.RawMessage
+	if err := json.Unmarshal(c.Body(), &items); err != nil {
+		return t.BadRequest("Cannot parse JSON array").WithDetails(err.Error())
+	}
+	if len(items) == 0 {
+		return t.BadRequest("No records provided for batch creation")
+	}
+
+	lang := c.Get(fiber.HeaderAcceptLanguage)
+	recs := make([]t.Record, len(items))
+	var invalid *t.AppError
+	var fields []t.FieldError
+	for i, raw := range items {
+		rec, err := en.record(raw, "["+strconv.Itoa(i)+"].", lang)
+		if err == nil {
+			recs[i] = rec
+			continue
+		}
+		var ae *t.AppError
+		if !errors.As(err, &ae) || ae.Code != t.CodeValidation {
+			return err
+		}
+		if invalid == nil {
+			invalid = ae
+		}
+		fields = append(fields, ae.Details.([]t.FieldError)...)
+	}
+	if invalid != nil {
+		invalid.Details = fields
+		return invalid
+	}
+
+	rows, err := e.repo(en).BatchCreate(c.UserContext(), recs)
+	if err != nil {
+		return t.Wrap(err, "Could not batch create "+en.def.Name)
+	}
+	return c.Status(fiber.StatusCreated).JSON(rows)
+}
+
+func (e *Engine) batchDelete(c *fiber.Ctx) error {
+	en := entityOf(c)
+	var payload struct {
+		IDs []int64 `json:"ids"`
+	}
+	if err := c.BodyParser(&payload); err != nil {
+		return t.BadRequest("Cannot parse JSON").WithDetails(err.Error())
+	}
+	if len(payload.IDs) == 0 {
+		return t.BadRequest("No IDs provided for deletion")
+	}
+
+	affected, err := e.repo(en).SoftDelete(c.UserContext(), payload.IDs)
+	if err != nil {
+		return t.Wrap(err, "Could not delete "+en.def.Name)
+	}
+	return c.JSON(fiber.Map{
+		"deleted": affected,
+	})
+}
+
+func (e *Engine) restore(c *fiber.Ctx) error {
+	en := entityOf(c)
+	var payload struct {
+		IDs []int64 `json:"ids"`
+	}
+	if err := c.BodyParser(&payload); err != nil {
+		return t.BadRequest("Cannot parse JSON").WithDetails(err.Error())
+	}
+	if len(payload.IDs) == 0 {
+		return t.BadRequest("No IDs provided for restore")
+	}
+
+	affected, err := e.repo(en).Restore(c.UserContext(), payload.IDs)
+	if err != nil {
+		return t.Wrap(err, "Could not restore "+en.def.Name)
+	}
+	return c.JSON(fiber.Map{
+		"restored": affected,
+	})
+}
+
+// record 解析一条记录：检查未知字段和类型，填充 default，再按 validate 规则校验，
+// prefix 为错误中字段路径的前缀
+func (en *entity) record(raw []byte, prefix, acceptLanguage string) (t.Record, error) {
+	var body map[string]any
+	if err := decode(raw, &body); err != nil || body == nil {
+		msg := "expects a JSON object"
+		if err != nil {
+			msg = err.Error()
+		}
+		return nil, t.BadRequest("Cannot parse JSON").WithDetails(msg)
+	}
+
+	rec := t.Record{}
+	var fields []t.FieldError
+	for _, key := range slices.Sorted(maps.Keys(body)) {
+		if _, ok := en.def.field(key); !ok {
+			fields = append(fields, t.FieldError{Field: prefix + key, Tag: "unknown", Message: key + " is not a field of " + en.def.Name})
+		}
+	}
+	for _, f := range en.def.Fields {
+		v, ok := body[f.Name]
+		if !ok {
+			v = f.Default
+		}
+		v, err := coerce(f, v)
+		if err != nil {
+			fields = append(fields, t.FieldError{Field: prefix + f.Name, Tag: "type", Param: f.Type, Message: f.Name + " " + err.Error()})
+			continue
+		}
+		rec[f.Name] = v
+	}
+	if len(fields) > 0 {
+		return nil, t.ValidationFailed(fields)
+	}
+
+	// 用同样规则的结构体校验，错误的翻译和格式与内置实体一致
+	sv := reflect.New(en.typ)
+	for i, f := range en.def.Fields {
+		if v := rec[f.Name]; v != nil {
+			p := reflect.New(types[f.Type].goT)
+			p.Elem().Set(reflect.ValueOf(v))
+			sv.Elem().Field(i).Set(p)
+		}
+	}
+	err := t.Validate(sv.Interface(), acceptLanguage)
+	var ae *t.AppError
+	if prefix != "" && errors.As(err, &ae) {
+		list := ae.Details.([]t.FieldError)
+		for i := range list {
+			list[i].Field = prefix + list[i].Field
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
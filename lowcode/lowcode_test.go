@@ -0,0 +1,226 @@
+package lowcode
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/axuman/go-server/biz"
+	svr "github.com/axuman/go-server/svr"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		def  string
+		err  string // 为空表示合法
+	}{
+		{"ok", `{"name": "product", "fields": [{"name": "title", "type": "string", "required": true, "sort": true, "filter": ["eq"]}], "indexes": [{"fields": ["title"], "unique": true}]}`, ""},
+		{"bad name", `{"name": "Product", "fields": [{"name": "title", "type": "string"}]}`, "Entity name"},
+		{"no fields", `{"name": "product", "fields": []}`, "1 to 64 fields"},
+		{"reserved", `{"name": "product", "fields": [{"name": "created_at", "type": "time"}]}`, "reserved"},
+		{"keyword order", `{"name": "product", "fields": [{"name": "order", "type": "int"}]}`, "SQL keyword"},
+		{"keyword group", `{"name": "product", "fields": [{"name": "group", "type": "string"}]}`, "SQL keyword"},
+		{"keyword index", `{"name": "product", "fields": [{"name": "index", "type": "int"}]}`, "SQL keyword"},
+		{"keyword select", `{"name": "product", "fields": [{"name": "select", "type": "bool"}]}`, "SQL keyword"},
+		{"duplicate", `{"name": "product", "fields": [{"name": "a", "type": "int"}, {"name": "a", "type": "int"}]}`, "Duplicate field"},
+		{"unknown type", `{"name": "product", "fields": [{"name": "a", "type": "blob"}]}`, "unknown type"},
+		{"sort not required", `{"name": "product", "fields": [{"name": "a", "type": "int", "sort": true}]}`, "must be required"},
+		{"bad operator", `{"name": "product", "fields": [{"name": "a", "type": "int", "filter": ["near"]}]}`, "unknown filter operator"},
+		{"bad default", `{"name": "product", "fields": [{"name": "a", "type": "int", "default": 1.5}]}`, "Default of field"},
+		{"bad rule", `{"name": "product", "fields": [{"name": "a", "type": "int", "validate": "nosuchrule"}]}`, "invalid validate rule"},
+		{"unknown index field", `{"name": "product", "fields": [{"name": "a", "type": "int"}], "indexes": [{"fields": ["b"]}]}`, "unknown field"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var def Definition
+			if err := decode([]byte(tt.def), &def); err != nil {
+				t.Fatal(err)
+			}
+			err := def.check()
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var ae *biz.AppError
+			if !errors.As(err, &ae) || ae.Status != http.StatusBadRequest || !strings.Contains(ae.Message, tt.err) {
+				t.Fatalf("err = %v, want 400 containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestEvolveStatements(t *testing.T) {
+	const base = `{"name": "product", "fields": [
+		{"name": "title", "type": "string", "required": true, "sort": true},
+		{"name": "price", "type": "float"}
+	], "indexes": [{"fields": ["price"]}]}`
+	tests := []struct {
+		name string
+		def  string
+		want []string
+		err  string
+	}{
+		{"rules only", `{"name": "product", "fields": [
+			{"name": "title", "type": "string", "required": true, "sort": true, "validate": "max=10"},
+			{"name": "price", "type": "float", "filter": ["gte"]}
+		], "indexes": [{"fields": ["price"]}]}`, []string{}, ""},
+		{"add field and unique index", `{"name": "product", "fields": [
+			{"name": "title", "type": "string", "required": true, "sort": true},
+			{"name": "price", "type": "float"},
+			{"name": "sku", "type": "string", "required": true, "default": ""}
+		], "indexes": [{"fields": ["price"]}, {"fields": ["sku"], "unique": true}]}`, []string{
+			"ALTER TABLE lc_product ADD COLUMN sku TEXT NOT NULL DEFAULT ''",
+			"CREATE UNIQUE INDEX lc_product_sku_unique ON lc_product (sku) WHERE deleted_at IS NULL",
+		}, ""},
+		{"drop field and its index", `{"name": "product", "fields": [
+			{"name": "title", "type": "string", "required": true, "sort": true}
+		]}`, []string{
+			"DROP INDEX IF EXISTS lc_product_price",
+			"ALTER TABLE lc_product DROP COLUMN price",
+		}, ""},
+		{"stop sorting", `{"name": "product", "fields": [
+			{"name": "title", "type": "string", "required": true},
+			{"name": "price", "type": "float"}
+		], "indexes": [{"fields": ["price"]}]}`, []string{
+			"DROP INDEX IF EXISTS lc_product_deleted_at_title_id",
+		}, ""},
+		{"add with default", `{"name": "product", "fields": [
+			{"name": "title", "type": "string", "required": true, "sort": true},
+			{"name": "price", "type": "float"},
+			{"name": "stock", "type": "int", "default": 0, "sort": true, "required": true}
+		], "indexes": [{"fields": ["price"]}]}`, []string{
+			"ALTER TABLE lc_product ADD COLUMN stock INTEGER NOT NULL DEFAULT 0",
+			"CREATE INDEX lc_product_deleted_at_stock_id ON lc_product (deleted_at, stock, id)",
+		}, ""},
+		{"required without default", `{"name": "product", "fields": [
+			{"name": "title", "type": "string", "required": true, "sort": true},
+			{"name": "price", "type": "float"},
+			{"name": "sku", "type": "string", "required": true}
+		]}`, nil, "needs a default"},
+		{"change type", `{"name": "product", "fields": [
+			{"name": "title", "type": "string", "required": true, "sort": true},
+			{"name": "price", "type": "int"}
+		]}`, nil, "Cannot change type"},
+		{"change required", `{"name": "product", "fields": [
+			{"name": "title", "type": "string", "required": true, "sort": true},
+			{"name": "price", "type": "float", "required": true, "default": 0}
+		]}`, nil, "Cannot change required"},
+	}
+	var old Definition
+	if err := decode([]byte(base), &old); err != nil {
+		t.Fatal(err)
+	}
+	if err := old.check(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var def Definition
+			if err := decode([]byte(tt.def), &def); err != nil {
+				t.Fatal(err)
+			}
+			if err := def.check(); err != nil {
+				t.Fatal(err)
+			}
+			got, err := evolveStatements(&old, &def)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func newApp(t *testing.T) *fiber.App {
+	t.Helper()
+	db, err := svr.InitDB(svr.DBConfig{Path: filepath.Join(t.TempDir(), "test.db"), MaxOpenConns: 4, MaxIdleConns: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	e, err := New(context.Background(), db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New(fiber.Config{ErrorHandler: func(c *fiber.Ctx, err error) error {
+		ae := biz.AsAppError(err)
+		return c.Status(ae.Status).JSON(ae)
+	}})
+	e.Admin(app.Group("/admin/entities"))
+	e.Mount(app)
+	return app
+}
+
+func do(t *testing.T, app *fiber.App, method, path, contentType, body string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	res, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(res.Body)
+	return res.StatusCode, string(b)
+}
+
+func TestAdminDefinitionFormats(t *testing.T) {
+	app := newApp(t)
+
+	status, body := do(t, app, "POST", "/admin/entities", "application/yaml", `
+name: product
+fields:
+  - name: title
+    type: string
+    required: true
+    sort: true
+    filter: [eq, like]
+  - name: price
+    type: float
+    default: 0
+indexes:
+  - fields: [title]
+    unique: true
+`)
+	if status != http.StatusCreated {
+		t.Fatalf("create from YAML: %d %s", status, body)
+	}
+	status, body = do(t, app, "PUT", "/admin/entities/product", "application/json",
+		`{"fields": [{"name": "title", "type": "string", "required": true, "sort": true}, {"name": "price", "type": "float", "default": 0}, {"name": "stock", "type": "int"}]}`)
+	if status != http.StatusOK || !strings.Contains(body, "ADD COLUMN stock INTEGER") {
+		t.Fatalf("evolve from JSON: %d %s", status, body)
+	}
+	if status, body = do(t, app, "POST", "/lc/product/c", "application/json", `{"title": "pen", "stock": 3}`); status != http.StatusOK && status != http.StatusCreated {
+		t.Fatalf("create record: %d %s", status, body)
+	}
+	if status, body = do(t, app, "GET", "/lc/product/q?sort=title", "", ""); status != http.StatusOK || !strings.Contains(body, `"pen"`) {
+		t.Fatalf("query: %d %s", status, body)
+	}
+
+	for _, tt := range []struct{ contentType, body string }{
+		{"application/yaml", "name: [broken\n"},
+		{"application/json", `{"name": `},
+		{"application/x-yaml", "name: other\nfields:\n  - name: order\n    type: int\n"},
+	} {
+		if status, body := do(t, app, "POST", "/admin/entities", tt.contentType, tt.body); status != http.StatusBadRequest {
+			t.Errorf("%q: %d %s", tt.body, status, body)
+		}
+	}
+}
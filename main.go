@@ -1,47 +1,329 @@
 package main
 
 import (
+	"context"
+	"expvar"
 	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	router "github.com/axuman/go-server/api"
+	t "github.com/axuman/go-server/biz"
+	"github.com/axuman/go-server/cache"
+	"github.com/axuman/go-server/cache/resp"
+	"github.com/axuman/go-server/config"
+	"github.com/axuman/go-server/gateway"
 	G "github.com/axuman/go-server/globals"
+	"github.com/axuman/go-server/ipc"
+	"github.com/axuman/go-server/lowcode"
+	"github.com/axuman/go-server/middleware/crypt"
+	"github.com/axuman/go-server/middleware/ratelimit"
+	"github.com/axuman/go-server/middleware/shield"
+	"github.com/axuman/go-server/middleware/sign"
+	"github.com/axuman/go-server/mq"
+	"github.com/axuman/go-server/outbox"
+	"github.com/axuman/go-server/purge"
+	"github.com/axuman/go-server/sidecar"
 	svr "github.com/axuman/go-server/svr"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 )
 
 var err error
 
+// configPollInterval 检查配置文件是否修改的间隔
+const configPollInterval = 2 * time.Second
+
 func main() {
 
+	// 子命令，配置只从文件和环境变量读取
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		store, err := config.Load(nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := runMigrate(dbConfig(store.Get().DB), os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// 代码生成，不需要配置和数据库
+	if len(os.Args) > 1 && os.Args[1] == "gen" {
+		if err := runGen(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	G.Config, err = config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg := G.Config.Get()
+	applyLogLevel(cfg.Log)
+	if cfg.Cursor.Secret != "" {
+		t.CursorSecret = []byte(cfg.Cursor.Secret)
+	}
+
 	// db
-	G.DmailDB, err = svr.InitDB("./dmail.db")
+	G.DmailDB, err = svr.InitDB(dbConfig(cfg.DB))
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer G.DmailDB.Close()
+	svr.OnShutdown("dmail db", func(ctx context.Context) error {
+		return svr.CloseDB(G.DmailDB)
+	})
+
+	if cfg.Cache.Enabled {
+		G.Cache = cache.New(cache.Config{
+			MaxEntries: cfg.Cache.MaxEntries,
+			MaxBytes:   cfg.Cache.MaxBytes,
+			DefaultTTL: time.Duration(cfg.Cache.ListTTL),
+		})
+		expvar.Publish("cache", expvar.Func(func() any { return G.Cache.Stats() }))
+		svr.OnShutdown("cache", func(ctx context.Context) error {
+			G.Cache.Close()
+			return nil
+		})
+	}
+	if cfg.RESP.Enabled {
+		// 单独的实例，客户端不能读写或挤掉接口缓存
+		rc := cache.New(cache.Config{MaxEntries: cfg.RESP.MaxEntries, MaxBytes: cfg.RESP.MaxBytes})
+		expvar.Publish("resp", expvar.Func(func() any { return rc.Stats() }))
+		rs := resp.New(rc, resp.Config{Network: cfg.RESP.Network, Addr: cfg.RESP.Addr, Password: cfg.RESP.Password})
+		if err := rs.ListenAndServe(); err != nil {
+			log.Fatal(err)
+		}
+		svr.OnShutdown("resp", func(ctx context.Context) error {
+			defer rc.Close()
+			return rs.Close()
+		})
+	}
 
+	if cfg.LowCode.Enabled {
+		if G.LowCode, err = lowcode.New(context.Background(), G.DmailDB, G.Cache); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	app := fiber.New(fiber.Config{
-		ErrorHandler: func(c *fiber.Ctx, err error) error {
-			code := fiber.StatusInternalServerError
-			if e, ok := err.(*fiber.Error); ok {
-				code = e.Code
+	G.MQ, err = mq.Open(mq.Config{
+		Path:              cfg.MQ.Path,
+		VisibilityTimeout: time.Duration(cfg.MQ.VisibilityTimeout),
+		MaxAttempts:       cfg.MQ.MaxAttempts,
+		Retention:         time.Duration(cfg.MQ.Retention),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	svr.OnShutdown("mq", G.MQ.Close)
+
+	G.IPC = ipc.NewRegistry()
+	for _, svc := range cfg.IPC.Services {
+		name, socket, _ := strings.Cut(svc, "=")
+		G.IPC.Register(name, socket)
+	}
+	for _, spec := range cfg.IPC.Routes {
+		if err := G.IPC.AddRoute(spec); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if cfg.IPC.Socket != "" {
+		ipcServer := ipc.NewServer()
+		G.IPC.Expose(ipcServer)
+		if err := ipcServer.Listen(cfg.IPC.Socket); err != nil {
+			log.Fatal(err)
+		}
+		svr.OnShutdown("ipc", ipcServer.Close)
+	}
+	svr.OnShutdown("ipc clients", func(ctx context.Context) error {
+		G.IPC.Close()
+		return nil
+	})
+
+	// 数据变更事件经 outbox 转发到队列、Webhook 和 IPC sidecar，outbox 先于 IPC 关闭
+	sinks := []outbox.Sink{outbox.QueueSink{Queue: G.MQ}}
+	for _, u := range cfg.Outbox.Webhooks {
+		sinks = append(sinks, outbox.WebhookSink{URL: u, Secret: []byte(cfg.Outbox.WebhookSecret)})
+	}
+	for _, spec := range cfg.Outbox.IPC {
+		sink, err := outbox.ParseIPCSink(G.IPC, spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sinks = append(sinks, sink)
+	}
+	relay := outbox.New(G.DmailDB, outbox.Config{
+		PollInterval: time.Duration(cfg.Outbox.PollInterval),
+		BatchSize:    cfg.Outbox.BatchSize,
+		MaxAttempts:  cfg.Outbox.MaxAttempts,
+		Retention:    time.Duration(cfg.Outbox.Retention),
+	}, sinks...)
+	relay.Start()
+	svr.OnShutdown("outbox", relay.Close)
+
+	if cfg.Purge.Retention > 0 {
+		G.Purger = purge.New(G.DmailDB, G.Cache, purge.Config{
+			Retention: time.Duration(cfg.Purge.Retention),
+			Interval:  time.Duration(cfg.Purge.Interval),
+			BatchSize: cfg.Purge.BatchSize,
+		}, purgeTables)
+		G.Purger.Start()
+		svr.OnShutdown("purge", G.Purger.Close)
+		expvar.Publish("purge", expvar.Func(func() any { return G.Purger.Stats() }))
+	}
+
+	if err := router.LoadPolicies(cfg.Resilience.Routes); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.Shield.Enabled {
+		for _, name := range cfg.Shield.Routes {
+			if _, ok := router.Policies[name]; !ok {
+				log.Fatalf("shield.routes: unknown route group %q", name)
 			}
-			log.Printf("Unhandled error: %v - Path: %s", err, c.Path())
-			return c.Status(code).JSON(fiber.Map{
-				"error": err.Error(),
-			})
-		},
+		}
+		G.Shield = shield.New(shield.Config{
+			Secret:       []byte(cfg.Shield.Secret),
+			Difficulty:   cfg.Shield.Difficulty,
+			TTL:          time.Duration(cfg.Shield.TTL),
+			ChallengeTTL: time.Duration(cfg.Shield.ChallengeTTL),
+		})
+		svr.OnShutdown("shield", func(ctx context.Context) error {
+			G.Shield.Close()
+			return nil
+		})
+	}
+	if cfg.Sign.Keys != "" {
+		keys, err := sign.ParseKeys(cfg.Sign.Keys)
+		if err != nil {
+			log.Fatal(err)
+		}
+		G.Signer = sign.New(sign.Config{Keys: keys})
+		svr.OnShutdown("sign", func(ctx context.Context) error {
+			G.Signer.Close()
+			return nil
+		})
+	}
+	G.Crypt = crypt.New(crypt.Config{Required: cfg.Crypt.Required, MaxSessions: cfg.Crypt.MaxSessions})
+	svr.OnShutdown("crypt", func(ctx context.Context) error {
+		G.Crypt.Close()
+		return nil
+	})
+
+	if gwCfg, err := gateway.LoadFile(cfg.Gateway.Config); err == nil {
+		if G.Gateway, err = gateway.New(*gwCfg); err != nil {
+			log.Fatal(err)
+		}
+		svr.OnShutdown("gateway", func(ctx context.Context) error {
+			G.Gateway.Close()
+			return nil
+		})
+	} else if !os.IsNotExist(err) {
+		log.Fatal(err)
+	}
+
+	if scCfg, err := sidecar.LoadFile(cfg.Sidecar.Config); err == nil {
+		var env []string
+		if cfg.IPC.Socket != "" {
+			env = append(env, "GOSERVER_IPC_SOCKET="+cfg.IPC.Socket)
+		}
+		if G.Sidecars, err = sidecar.New(*scCfg, G.IPC, env...); err != nil {
+			log.Fatal(err)
+		}
+		G.Sidecars.Start()
+		svr.OnShutdown("sidecars", G.Sidecars.Stop)
+	} else if !os.IsNotExist(err) {
+		log.Fatal(err)
+	}
+
+	G.RateLimit = ratelimit.New(rateLimitConfig(cfg.RateLimit))
+	svr.OnShutdown("ratelimit", func(ctx context.Context) error {
+		G.RateLimit.Close()
+		return nil
+	})
+	G.Config.OnReload(func(old, cfg *config.Config) {
+		applyLogLevel(cfg.Log)
+		G.RateLimit.Update(rateLimitConfig(cfg.RateLimit))
+	})
+
+	app := fiber.New(fiber.Config{
+		ErrorHandler: router.ErrorHandler,
 	})
 
 	// Middleware
+	app.Use(requestid.New())
+	app.Use(G.RateLimit.Handler())
 	// app.Use(logger.New())
 	// app.Use(recover.New())
 
 	router.BuildRoutes(app)
 
-	if err := app.Listen(":3001"); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go G.Config.Watch(ctx, configPollInterval)
+
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- app.Listen(cfg.Server.Addr)
+	}()
+	svr.SetReady(true)
+
+	select {
+	case err := <-listenErr:
+		svr.Shutdown(context.Background())
 		log.Fatalf("Error starting server: %v", err)
+	case <-ctx.Done():
+	}
+	stop() // 再次收到信号时直接退出
+
+	// 先让 /health 返回 503，等负载均衡摘除后再停止接收连接
+	log.Println("Shutting down, draining in-flight requests...")
+	svr.SetReady(false)
+	time.Sleep(time.Duration(cfg.Server.DrainDelay))
+
+	shutdownTimeout := time.Duration(cfg.Server.ShutdownTimeout)
+	if err := app.ShutdownWithTimeout(shutdownTimeout); err != nil {
+		log.Printf("Error shutting down server: %v", err)
+	}
+	cleanup, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := svr.Shutdown(cleanup); err != nil {
+		log.Printf("Shutdown finished with errors: %v", err)
+		return
+	}
+	log.Println("Shutdown complete")
+}
+
+func dbConfig(c config.DBConfig) svr.DBConfig {
+	return svr.DBConfig{
+		Path:            c.Path,
+		MaxOpenConns:    c.MaxOpenConns,
+		MaxIdleConns:    c.MaxIdleConns,
+		ConnMaxLifetime: time.Duration(c.ConnMaxLifetime),
+		Pragmas:         c.Pragmas,
 	}
 }
+
+// purgeTables 需要清理软删除记录的表：各实体在 BuildRoutes 中登记的表和低代码实体的表
+func purgeTables() []string {
+	tables := purge.Registered()
+	if G.LowCode != nil {
+		tables = append(tables, G.LowCode.Tables()...)
+	}
+	return tables
+}
+
+func rateLimitConfig(c config.RateLimitConfig) ratelimit.Config {
+	return ratelimit.Config{Enabled: c.Enabled, RPS: c.RPS, Burst: c.Burst}
+}
+
+// applyLogLevel 设置 slog 的日志级别，Validate 已保证 level 合法
+func applyLogLevel(c config.LogConfig) {
+	level, _ := c.SlogLevel()
+	slog.SetLogLoggerLevel(level)
+}
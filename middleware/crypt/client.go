@@ -0,0 +1,153 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client 参考实现的 Go 客户端，用于测试和 Go 编写的调用方
+type Client struct {
+	BaseURL string
+	HTTP    *http.Client
+
+	// Header 附加在每个请求上的头，例如 5秒盾 的 cookie
+	Header http.Header
+
+	session  string
+	c2s, s2c cipher.AEAD
+}
+
+func NewClient(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimRight(baseURL, "/"), HTTP: http.DefaultClient, Header: http.Header{}}
+}
+
+// Handshake 与服务端协商会话密钥，path 默认为 /crypt/handshake
+func (cl *Client) Handshake(ctx context.Context, path string) error {
+	if path == "" {
+		path = "/crypt/handshake"
+	}
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	body, _ := json.Marshal(map[string]string{
+		"public_key": base64.RawURLEncoding.EncodeToString(priv.PublicKey().Bytes()),
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cl.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := cl.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("handshake: %s: %s", resp.Status, msg)
+	}
+
+	var out struct {
+		SessionID string `json:"session_id"`
+		PublicKey string `json:"public_key"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return err
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(out.PublicKey)
+	if err != nil {
+		return err
+	}
+	serverPub, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return err
+	}
+	cl.c2s, cl.s2c, err = deriveKeys(priv, serverPub, priv.PublicKey().Bytes(), raw)
+	cl.session = out.SessionID
+	return err
+}
+
+// Do 发送加密请求，in 为请求体（nil 表示无请求体），响应解密后解析到 out（可以为 nil）
+func (cl *Client) Do(ctx context.Context, method, path string, query url.Values, in, out any) (int, error) {
+	if cl.session == "" {
+		return 0, fmt.Errorf("crypt: handshake required")
+	}
+	u, err := url.Parse(cl.BaseURL + path)
+	if err != nil {
+		return 0, err
+	}
+	aad := additionalData(cl.session, method, u.Path)
+
+	if len(query) > 0 {
+		q, err := seal(cl.c2s, []byte(query.Encode()), aad)
+		if err != nil {
+			return 0, err
+		}
+		u.RawQuery = url.Values{QueryParam: {q}}.Encode()
+	}
+	var body io.Reader
+	if in != nil {
+		plain, err := json.Marshal(in)
+		if err != nil {
+			return 0, err
+		}
+		sealed, err := seal(cl.c2s, plain, aad)
+		if err != nil {
+			return 0, err
+		}
+		body = strings.NewReader(sealed)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set(HeaderSession, cl.session)
+	if in != nil {
+		req.Header.Set("Content-Type", MIMECrypt)
+	}
+	resp, err := cl.do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if resp.Header.Get("Content-Type") != MIMECrypt {
+		// 会话失效等错误由服务端以明文返回
+		return resp.StatusCode, fmt.Errorf("crypt: unencrypted response %s: %s", resp.Status, raw)
+	}
+	plain, err := open(cl.s2c, string(raw), aad)
+	if err != nil {
+		return resp.StatusCode, fmt.Errorf("crypt: decrypt response: %w", err)
+	}
+	if out != nil && len(plain) > 0 {
+		if err := json.Unmarshal(plain, out); err != nil {
+			return resp.StatusCode, err
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+func (cl *Client) do(req *http.Request) (*http.Response, error) {
+	for k, vs := range cl.Header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	return cl.HTTP.Do(req)
+}
@@ -0,0 +1,279 @@
+// Package crypt 实现接口加密：客户端先用 X25519 协商会话密钥，之后请求体、
+// 查询参数和响应体都使用 AES-256-GCM 加密，handler 看到的仍然是明文。
+//
+// 协议:
+//
+//	POST /crypt/handshake {"public_key": base64url(客户端 X25519 公钥)}
+//	  -> {"session_id": ..., "public_key": base64url(服务端公钥), "expires_at": ...}
+//
+//	密钥 = HKDF-SHA256(共享密钥, salt=客户端公钥||服务端公钥, info="go-server crypt v1")，
+//	前 32 字节用于客户端到服务端，后 32 字节用于服务端到客户端。
+//
+//	加密请求带 X-Crypt-Session 头，请求体为 base64url(nonce||密文)，
+//	查询参数整体加密后放在 _q 参数中；响应体同样格式，Content-Type 为 application/x-crypt。
+//	AAD 为 "会话ID\n方法\n路径"，密文不能被挪用到其他接口。
+package crypt
+
+import (
+	"container/list"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	t "github.com/axuman/go-server/biz"
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	HeaderSession = "X-Crypt-Session"
+	QueryParam    = "_q"
+	MIMECrypt     = "application/x-crypt"
+
+	CodeSessionInvalid = "crypt_session_invalid"
+	CodePayloadInvalid = "crypt_payload_invalid"
+	CodeRequired       = "crypt_required"
+)
+
+var hkdfInfo = []byte("go-server crypt v1")
+
+type Config struct {
+	SessionTTL  time.Duration // 会话有效期，默认 1 小时
+	MaxSessions int           // 会话数上限，超过后淘汰最久未使用的会话，默认 100000
+	Required    bool          // 为 true 时拒绝未加密的请求
+}
+
+type session struct {
+	id       string
+	c2s, s2c cipher.AEAD
+	expires  time.Time
+	elem     *list.Element
+}
+
+type Crypt struct {
+	cfg      Config
+	mu       sync.Mutex
+	sessions map[string]*session
+	lru      *list.List // 队头是最近使用的会话
+	stop     chan struct{}
+}
+
+func New(cfg Config) *Crypt {
+	if cfg.SessionTTL <= 0 {
+		cfg.SessionTTL = time.Hour
+	}
+	if cfg.MaxSessions <= 0 {
+		cfg.MaxSessions = 100000
+	}
+	c := &Crypt{cfg: cfg, sessions: map[string]*session{}, lru: list.New(), stop: make(chan struct{})}
+	go c.sweep()
+	return c
+}
+
+// Close 停止后台清理
+func (cr *Crypt) Close() {
+	close(cr.stop)
+}
+
+// Handshake 协商会话密钥
+func (cr *Crypt) Handshake(c *fiber.Ctx) error {
+	var body struct {
+		PublicKey string `json:"public_key"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return t.BadRequest("Cannot parse handshake").WithDetails(err.Error())
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(body.PublicKey)
+	if err != nil {
+		return t.BadRequest("public_key must be base64url encoded")
+	}
+	clientPub, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return t.BadRequest("Invalid X25519 public key")
+	}
+
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	c2s, s2c, err := deriveKeys(priv, clientPub, clientPub.Bytes(), priv.PublicKey().Bytes())
+	if err != nil {
+		return t.BadRequest("Invalid X25519 public key")
+	}
+
+	id := make([]byte, 16)
+	rand.Read(id)
+	sid := base64.RawURLEncoding.EncodeToString(id)
+	s := &session{id: sid, c2s: c2s, s2c: s2c, expires: time.Now().Add(cr.cfg.SessionTTL)}
+	cr.add(s)
+
+	return c.JSON(fiber.Map{
+		"session_id": sid,
+		"public_key": base64.RawURLEncoding.EncodeToString(priv.PublicKey().Bytes()),
+		"expires_at": s.expires,
+	})
+}
+
+// Handler 解密请求并加密响应，没有 X-Crypt-Session 头的请求原样放行（Required 时拒绝）
+func (cr *Crypt) Handler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		sid := c.Get(HeaderSession)
+		if sid == "" {
+			if cr.cfg.Required {
+				return t.NewError(fiber.StatusBadRequest, CodeRequired, "Encrypted request required")
+			}
+			return c.Next()
+		}
+
+		s := cr.get(sid)
+		if s == nil || time.Now().After(s.expires) {
+			return t.NewError(fiber.StatusUnauthorized, CodeSessionInvalid, "Crypt session is invalid or expired")
+		}
+		aad := additionalData(sid, c.Method(), c.Path())
+
+		// 解密查询参数和请求体，之后的 QueryParser/BodyParser 看到的是明文
+		if q := c.Query(QueryParam); q != "" {
+			plain, err := open(s.c2s, q, aad)
+			if err != nil {
+				return t.NewError(fiber.StatusBadRequest, CodePayloadInvalid, "Cannot decrypt query")
+			}
+			c.Request().URI().SetQueryStringBytes(plain)
+		}
+		if body := c.Body(); len(body) > 0 {
+			plain, err := open(s.c2s, string(body), aad)
+			if err != nil {
+				return t.NewError(fiber.StatusBadRequest, CodePayloadInvalid, "Cannot decrypt body")
+			}
+			c.Request().SetBodyRaw(plain)
+			c.Request().Header.SetContentType(fiber.MIMEApplicationJSON)
+		}
+
+		// 错误也要加密返回，所以在这里调用 ErrorHandler
+		if err := c.Next(); err != nil {
+			if err := c.App().ErrorHandler(c, err); err != nil {
+				return err
+			}
+		}
+
+		resp := c.Response()
+		sealed, err := seal(s.s2c, resp.Body(), aad)
+		if err != nil {
+			return err
+		}
+		c.Set("X-Crypt-Content-Type", string(resp.Header.ContentType()))
+		c.Set(fiber.HeaderContentType, MIMECrypt)
+		resp.SetBodyString(sealed)
+		return nil
+	}
+}
+
+// add 保存新会话，达到上限时淘汰最久未使用的会话
+func (cr *Crypt) add(s *session) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	for len(cr.sessions) >= cr.cfg.MaxSessions {
+		cr.remove(cr.lru.Back().Value.(*session))
+	}
+	s.elem = cr.lru.PushFront(s)
+	cr.sessions[s.id] = s
+}
+
+func (cr *Crypt) get(sid string) *session {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	s, ok := cr.sessions[sid]
+	if !ok {
+		return nil
+	}
+	cr.lru.MoveToFront(s.elem)
+	return s
+}
+
+func (cr *Crypt) remove(s *session) {
+	cr.lru.Remove(s.elem)
+	delete(cr.sessions, s.id)
+}
+
+// Sessions 当前的会话数
+func (cr *Crypt) Sessions() int {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	return len(cr.sessions)
+}
+
+func (cr *Crypt) sweep() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-cr.stop:
+			return
+		case <-ticker.C:
+		}
+		now := time.Now()
+		cr.mu.Lock()
+		for _, s := range cr.sessions {
+			if now.After(s.expires) {
+				cr.remove(s)
+			}
+		}
+		cr.mu.Unlock()
+	}
+}
+
+// deriveKeys 计算共享密钥并派生两个方向的 AEAD
+func deriveKeys(priv *ecdh.PrivateKey, peer *ecdh.PublicKey, clientPub, serverPub []byte) (c2s, s2c cipher.AEAD, err error) {
+	shared, err := priv.ECDH(peer)
+	if err != nil {
+		return nil, nil, err
+	}
+	salt := append(append([]byte{}, clientPub...), serverPub...)
+	keys := make([]byte, 64)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, hkdfInfo), keys); err != nil {
+		return nil, nil, err
+	}
+	if c2s, err = newAEAD(keys[:32]); err != nil {
+		return nil, nil, err
+	}
+	s2c, err = newAEAD(keys[32:])
+	return c2s, s2c, err
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func additionalData(sid, method, path string) []byte {
+	return []byte(sid + "\n" + method + "\n" + path)
+}
+
+// seal 返回 base64url(nonce||密文)
+func seal(aead cipher.AEAD, plain, aad []byte) (string, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, plain, aad)), nil
+}
+
+func open(aead cipher.AEAD, sealed string, aad []byte) ([]byte, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return aead.Open(nil, raw[:aead.NonceSize()], raw[aead.NonceSize():], aad)
+}
@@ -0,0 +1,156 @@
+package crypt
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/axuman/go-server/biz"
+	"github.com/gofiber/fiber/v2"
+)
+
+// serve 启动一个带加密中间件的测试服务，/echo 返回解密后的查询参数和请求体
+func serve(t *testing.T, cfg Config) (*Crypt, string) {
+	t.Helper()
+	cr := New(cfg)
+	app := fiber.New(fiber.Config{DisableStartupMessage: true, ErrorHandler: func(c *fiber.Ctx, err error) error {
+		ae := biz.AsAppError(err)
+		return c.Status(ae.Status).JSON(fiber.Map{"error": ae})
+	}})
+	app.Post("/crypt/handshake", cr.Handshake)
+	app.Post("/echo", cr.Handler(), func(c *fiber.Ctx) error {
+		var body map[string]any
+		if err := c.BodyParser(&body); err != nil {
+			return err
+		}
+		return c.JSON(fiber.Map{"q": c.Query("q"), "body": body})
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(ln)
+	t.Cleanup(func() { app.Shutdown() })
+	return cr, "http://" + ln.Addr().String()
+}
+
+func TestRoundTrip(t *testing.T) {
+	_, base := serve(t, Config{})
+	ctx := context.Background()
+	cl := NewClient(base)
+	if err := cl.Handshake(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var out struct {
+		Q    string         `json:"q"`
+		Body map[string]any `json:"body"`
+	}
+	status, err := cl.Do(ctx, http.MethodPost, "/echo", url.Values{"q": {"hello"}}, map[string]any{"name": "x"}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != http.StatusOK || out.Q != "hello" || out.Body["name"] != "x" {
+		t.Fatalf("got %d %+v", status, out)
+	}
+}
+
+func TestRejectsTamperedPayload(t *testing.T) {
+	_, base := serve(t, Config{})
+	cl := NewClient(base)
+	if err := cl.Handshake(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := seal(cl.c2s, []byte(`{"name":"x"}`), additionalData(cl.session, http.MethodPost, "/echo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 改动一个字符后 GCM 校验失败
+	tampered := []byte(sealed)
+	i := len(tampered) / 2
+	if tampered[i] == 'A' {
+		tampered[i] = 'B'
+	} else {
+		tampered[i] = 'A'
+	}
+	// 密文挪到其他路径时 AAD 不同
+	moved, err := seal(cl.c2s, []byte(`{"name":"x"}`), additionalData(cl.session, http.MethodPost, "/other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		session string
+		body    string
+		status  int
+		code    string
+	}{
+		{"tampered", cl.session, string(tampered), http.StatusBadRequest, CodePayloadInvalid},
+		{"wrong path", cl.session, moved, http.StatusBadRequest, CodePayloadInvalid},
+		{"not base64", cl.session, "%%%", http.StatusBadRequest, CodePayloadInvalid},
+		{"unknown session", "nope", sealed, http.StatusUnauthorized, CodeSessionInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, base+"/echo", strings.NewReader(tt.body))
+			req.Header.Set(HeaderSession, tt.session)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			raw, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.status || !strings.Contains(string(raw), tt.code) {
+				t.Fatalf("got %d %s", resp.StatusCode, raw)
+			}
+		})
+	}
+}
+
+func TestHandshakeRejectsInvalidKey(t *testing.T) {
+	_, base := serve(t, Config{})
+	for _, body := range []string{`{"public_key":"%%%"}`, `{"public_key":"AAAA"}`, `not json`} {
+		resp, err := http.Post(base+"/crypt/handshake", fiber.MIMEApplicationJSON, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			t.Fatalf("%s: handshake accepted", body)
+		}
+	}
+}
+
+func TestMaxSessionsEvictsLeastRecentlyUsed(t *testing.T) {
+	cr, base := serve(t, Config{MaxSessions: 2})
+	ctx := context.Background()
+	clients := make([]*Client, 3)
+	for i := range clients {
+		clients[i] = NewClient(base)
+		if err := clients[i].Handshake(ctx, ""); err != nil {
+			t.Fatal(err)
+		}
+		if i == 1 {
+			// 使用第一个会话，之后被淘汰的是第二个
+			if _, err := clients[0].Do(ctx, http.MethodPost, "/echo", nil, map[string]any{}, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if n := cr.Sessions(); n != 2 {
+		t.Fatalf("sessions = %d, want 2", n)
+	}
+	for i, want := range []bool{true, false, true} {
+		_, err := clients[i].Do(ctx, http.MethodPost, "/echo", nil, map[string]any{}, nil)
+		if (err == nil) != want {
+			t.Fatalf("client %d: err = %v", i, err)
+		}
+	}
+}
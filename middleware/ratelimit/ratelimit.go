@@ -0,0 +1,113 @@
+// Package ratelimit 按客户端 IP 的令牌桶限流，配置可以在运行中更新。
+package ratelimit
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	t "github.com/axuman/go-server/biz"
+	"github.com/gofiber/fiber/v2"
+)
+
+const CodeRateLimited = "rate_limited"
+
+type Config struct {
+	Enabled bool
+	RPS     float64 // 每秒补充的令牌数
+	Burst   int     // 桶容量
+
+	// Key 返回限流的维度，默认为客户端 IP
+	Key func(c *fiber.Ctx) string
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type Limiter struct {
+	mu      sync.Mutex
+	cfg     Config
+	buckets map[string]*bucket
+	stop    chan struct{}
+}
+
+func New(cfg Config) *Limiter {
+	l := &Limiter{buckets: map[string]*bucket{}, stop: make(chan struct{})}
+	l.Update(cfg)
+	go l.sweep()
+	return l
+}
+
+// Close 停止后台清理
+func (l *Limiter) Close() {
+	close(l.stop)
+}
+
+// Update 替换限流参数，已有的桶保留当前令牌数
+func (l *Limiter) Update(cfg Config) {
+	if cfg.Key == nil {
+		cfg.Key = func(c *fiber.Ctx) string { return c.IP() }
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cfg = cfg
+}
+
+func (l *Limiter) Handler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if wait := l.take(c); wait > 0 {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			return t.NewError(fiber.StatusTooManyRequests, CodeRateLimited, "Too many requests, please slow down")
+		}
+		return c.Next()
+	}
+}
+
+// take 取一个令牌，返回 0 表示放行，否则为需要等待的时间
+func (l *Limiter) take(c *fiber.Ctx) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	cfg := l.cfg
+	if !cfg.Enabled || cfg.RPS <= 0 {
+		return 0
+	}
+
+	now := time.Now()
+	key := cfg.Key(c)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(cfg.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(float64(cfg.Burst), b.tokens+now.Sub(b.last).Seconds()*cfg.RPS)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / cfg.RPS * float64(time.Second))
+}
+
+// sweep 删除已经补满的桶
+func (l *Limiter) sweep() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+		now := time.Now()
+		l.mu.Lock()
+		for k, b := range l.buckets {
+			if l.cfg.RPS <= 0 || b.tokens+now.Sub(b.last).Seconds()*l.cfg.RPS >= float64(l.cfg.Burst) {
+				delete(l.buckets, k)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
@@ -0,0 +1,214 @@
+// Package shield 实现 "5秒盾"：首次访问或可疑的客户端需要在浏览器中完成
+// hashcash 风格的工作量证明，通过后下发绑定 IP 和 UA 的签名 cookie。
+package shield
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	t "github.com/axuman/go-server/biz"
+	"github.com/gofiber/fiber/v2"
+)
+
+const CodeChallengeRequired = "challenge_required"
+
+type Config struct {
+	Secret       []byte        // 签名密钥，为空时随机生成（重启后 cookie 失效）
+	Difficulty   int           // 哈希需要的前导零比特数，默认 18
+	TTL          time.Duration // 通行 cookie 有效期，默认 30 分钟
+	ChallengeTTL time.Duration // 题目有效期，默认 2 分钟
+	CookieName   string        // 默认 __shield
+	VerifyPath   string        // 提交答案的路径，默认 /__shield/verify
+
+	// Suspicious 返回 true 时即使持有有效 cookie 也要重新验证
+	Suspicious func(c *fiber.Ctx) bool
+}
+
+type Shield struct {
+	cfg  Config
+	used sync.Map // 已使用的题目 -> 过期时间，防止同一答案重复换取 cookie
+	stop chan struct{}
+}
+
+func New(cfg Config) *Shield {
+	if len(cfg.Secret) == 0 {
+		cfg.Secret = make([]byte, 32)
+		rand.Read(cfg.Secret)
+	}
+	if cfg.Difficulty <= 0 {
+		cfg.Difficulty = 18
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = 30 * time.Minute
+	}
+	if cfg.ChallengeTTL <= 0 {
+		cfg.ChallengeTTL = 2 * time.Minute
+	}
+	if cfg.CookieName == "" {
+		cfg.CookieName = "__shield"
+	}
+	if cfg.VerifyPath == "" {
+		cfg.VerifyPath = "/__shield/verify"
+	}
+
+	s := &Shield{cfg: cfg, stop: make(chan struct{})}
+	go s.sweep()
+	return s
+}
+
+// Close 停止后台清理
+func (s *Shield) Close() {
+	close(s.stop)
+}
+
+func (s *Shield) VerifyPath() string {
+	return s.cfg.VerifyPath
+}
+
+// Handler 返回中间件，挂在需要保护的路由组上
+func (s *Shield) Handler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		suspicious := s.cfg.Suspicious != nil && s.cfg.Suspicious(c)
+		if !suspicious && s.cleared(c) {
+			return c.Next()
+		}
+
+		token := s.challenge(c)
+		if strings.Contains(c.Get(fiber.HeaderAccept), fiber.MIMETextHTML) {
+			c.Set(fiber.HeaderCacheControl, "no-store")
+			c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+			return c.Status(fiber.StatusServiceUnavailable).SendString(
+				fmt.Sprintf(challengePage, token, s.cfg.Difficulty, s.cfg.VerifyPath))
+		}
+		// API 客户端自行计算后提交到 VerifyPath
+		return t.NewError(fiber.StatusForbidden, CodeChallengeRequired, "Proof-of-work challenge required").WithDetails(fiber.Map{
+			"token":       token,
+			"difficulty":  s.cfg.Difficulty,
+			"verify_path": s.cfg.VerifyPath,
+		})
+	}
+}
+
+// Verify 校验工作量证明，成功后下发通行 cookie
+func (s *Shield) Verify(c *fiber.Ctx) error {
+	var body struct {
+		Token string `json:"token" form:"token"`
+		Nonce string `json:"nonce" form:"nonce"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return t.BadRequest("Cannot parse challenge answer").WithDetails(err.Error())
+	}
+
+	invalid := t.NewError(fiber.StatusForbidden, CodeChallengeRequired, "Invalid or expired challenge answer")
+	exp, ok := s.checkChallenge(c, body.Token)
+	if !ok || leadingZeroBits(sha256.Sum256([]byte(body.Token+":"+body.Nonce))) < s.cfg.Difficulty {
+		return invalid
+	}
+	if _, loaded := s.used.LoadOrStore(body.Token, exp); loaded {
+		return invalid
+	}
+
+	expires := time.Now().Add(s.cfg.TTL)
+	c.Cookie(&fiber.Cookie{
+		Name:     s.cfg.CookieName,
+		Value:    s.sign("clear", strconv.FormatInt(expires.Unix(), 10), c),
+		Path:     "/",
+		Expires:  expires,
+		HTTPOnly: true,
+		Secure:   c.Protocol() == "https",
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+	return c.JSON(fiber.Map{"expires_at": expires})
+}
+
+// cleared 检查通行 cookie: <exp>.<mac>
+func (s *Shield) cleared(c *fiber.Ctx) bool {
+	value := c.Cookies(s.cfg.CookieName)
+	exp, _, ok := strings.Cut(value, ".")
+	if !ok || !hmac.Equal([]byte(value), []byte(s.sign("clear", exp, c))) {
+		return false
+	}
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	return err == nil && time.Now().Unix() < unix
+}
+
+// challenge 生成题目: <exp>-<random>.<mac>，mac 绑定 IP 和 UA
+func (s *Shield) challenge(c *fiber.Ctx) string {
+	random := make([]byte, 12)
+	rand.Read(random)
+	exp := strconv.FormatInt(time.Now().Add(s.cfg.ChallengeTTL).Unix(), 10)
+	return s.sign("challenge", exp+"-"+base64.RawURLEncoding.EncodeToString(random), c)
+}
+
+func (s *Shield) checkChallenge(c *fiber.Ctx, token string) (time.Time, bool) {
+	payload, _, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(token), []byte(s.sign("challenge", payload, c))) {
+		return time.Time{}, false
+	}
+	exp, _, _ := strings.Cut(payload, "-")
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() >= unix {
+		return time.Time{}, false
+	}
+	return time.Unix(unix, 0), true
+}
+
+// sign 返回 payload.mac，mac = HMAC(kind|payload|ip|ua)
+func (s *Shield) sign(kind, payload string, c *fiber.Ctx) string {
+	mac := hmac.New(sha256.New, s.cfg.Secret)
+	for _, part := range []string{kind, payload, c.IP(), c.Get(fiber.HeaderUserAgent)} {
+		binary.Write(mac, binary.BigEndian, uint32(len(part)))
+		mac.Write([]byte(part))
+	}
+	return payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:18])
+}
+
+// sweep 定期清理过期的已用题目
+func (s *Shield) sweep() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+		now := time.Now()
+		s.used.Range(func(k, v any) bool {
+			if now.After(v.(time.Time)) {
+				s.used.Delete(k)
+			}
+			return true
+		})
+	}
+}
+
+func leadingZeroBits(sum [32]byte) int {
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
+
+// Solve 计算题目答案，供 Go 客户端和测试使用
+func Solve(token string, difficulty int) string {
+	for i := 0; ; i++ {
+		nonce := strconv.Itoa(i)
+		if leadingZeroBits(sha256.Sum256([]byte(token+":"+nonce))) >= difficulty {
+			return nonce
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package shield
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/axuman/go-server/biz"
+	"github.com/gofiber/fiber/v2"
+)
+
+const difficulty = 8
+
+// newApp 用 X-Forwarded-For 模拟客户端 IP，/sign 直接用 s.sign 伪造题目和 cookie
+func newApp(t *testing.T) (*Shield, *fiber.App) {
+	t.Helper()
+	s := New(Config{Secret: []byte("0123456789abcdef"), Difficulty: difficulty})
+	app := fiber.New(fiber.Config{
+		ProxyHeader: fiber.HeaderXForwardedFor,
+		ErrorHandler: func(c *fiber.Ctx, err error) error {
+			ae := biz.AsAppError(err)
+			return c.Status(ae.Status).JSON(ae)
+		},
+	})
+	app.Post(s.VerifyPath(), s.Verify)
+	app.Get("/sign", func(c *fiber.Ctx) error {
+		return c.SendString(s.sign(c.Query("kind"), c.Query("payload"), c))
+	})
+	app.Get("/", s.Handler(), func(c *fiber.Ctx) error { return c.SendString("ok") })
+	return s, app
+}
+
+type client struct {
+	ip, ua string
+	cookie string
+}
+
+func (cl *client) do(t *testing.T, app *fiber.App, method, path, body string) (*http.Response, string) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(fiber.HeaderXForwardedFor, cl.ip)
+	req.Header.Set(fiber.HeaderUserAgent, cl.ua)
+	if body != "" {
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+	if cl.cookie != "" {
+		req.Header.Set(fiber.HeaderCookie, "__shield="+cl.cookie)
+	}
+	res, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(res.Body)
+	return res, string(b)
+}
+
+// challenge 请求受保护的路由，返回 403 中的题目
+func (cl *client) challenge(t *testing.T, app *fiber.App) string {
+	t.Helper()
+	res, body := cl.do(t, app, "GET", "/", "")
+	var e struct {
+		Code    string `json:"code"`
+		Details struct {
+			Token      string `json:"token"`
+			Difficulty int    `json:"difficulty"`
+		} `json:"details"`
+	}
+	json.Unmarshal([]byte(body), &e)
+	if res.StatusCode != http.StatusForbidden || e.Code != CodeChallengeRequired || e.Details.Difficulty != difficulty {
+		t.Fatalf("challenge: %d %s", res.StatusCode, body)
+	}
+	return e.Details.Token
+}
+
+func (cl *client) verify(t *testing.T, app *fiber.App, token, nonce string) int {
+	t.Helper()
+	res, _ := cl.do(t, app, "POST", "/__shield/verify", `{"token":"`+token+`","nonce":"`+nonce+`"}`)
+	for _, ck := range res.Cookies() {
+		if ck.Name == "__shield" {
+			cl.cookie = ck.Value
+		}
+	}
+	return res.StatusCode
+}
+
+func (cl *client) sign(t *testing.T, app *fiber.App, kind, payload string) string {
+	t.Helper()
+	_, body := cl.do(t, app, "GET", "/sign?"+url.Values{"kind": {kind}, "payload": {payload}}.Encode(), "")
+	return body
+}
+
+func TestChallengeSolveVerify(t *testing.T) {
+	_, app := newApp(t)
+	cl := &client{ip: "10.0.0.1", ua: "test/1.0"}
+
+	token := cl.challenge(t, app)
+	nonce := Solve(token, difficulty)
+	if status := cl.verify(t, app, token, nonce); status != http.StatusOK || cl.cookie == "" {
+		t.Fatalf("verify = %d, cookie = %q", status, cl.cookie)
+	}
+	if res, body := cl.do(t, app, "GET", "/", ""); res.StatusCode != http.StatusOK || body != "ok" {
+		t.Fatalf("cleared request: %d %s", res.StatusCode, body)
+	}
+
+	// 同一答案不能再换 cookie
+	if status := cl.verify(t, app, token, nonce); status != http.StatusForbidden {
+		t.Fatalf("reused answer = %d", status)
+	}
+
+	// 浏览器拿到的是题目页面
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(fiber.HeaderAccept, "text/html")
+	res, err := app.Test(req, -1)
+	if err != nil || res.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("html challenge: %v %v", res, err)
+	}
+}
+
+func TestCookieBoundToIPAndUA(t *testing.T) {
+	_, app := newApp(t)
+	cl := &client{ip: "10.0.0.1", ua: "test/1.0"}
+	token := cl.challenge(t, app)
+	if status := cl.verify(t, app, token, Solve(token, difficulty)); status != http.StatusOK {
+		t.Fatalf("verify = %d", status)
+	}
+
+	tests := []struct {
+		name string
+		cl   client
+	}{
+		{"ip changed", client{ip: "10.0.0.2", ua: cl.ua, cookie: cl.cookie}},
+		{"ua changed", client{ip: cl.ip, ua: "other/2.0", cookie: cl.cookie}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if res, _ := tt.cl.do(t, app, "GET", "/", ""); res.StatusCode != http.StatusForbidden {
+				t.Fatalf("status = %d", res.StatusCode)
+			}
+		})
+	}
+
+	// 题目同样绑定 IP，换 IP 提交答案无效
+	cl.cookie = ""
+	token = cl.challenge(t, app)
+	other := &client{ip: "10.0.0.2", ua: cl.ua}
+	if status := other.verify(t, app, token, Solve(token, difficulty)); status != http.StatusForbidden {
+		t.Fatalf("verify from another ip = %d", status)
+	}
+}
+
+func TestExpiredCookie(t *testing.T) {
+	_, app := newApp(t)
+	cl := &client{ip: "10.0.0.1", ua: "test/1.0"}
+	past := strconv.FormatInt(time.Now().Add(-time.Second).Unix(), 10)
+	cl.cookie = cl.sign(t, app, "clear", past)
+	if res, _ := cl.do(t, app, "GET", "/", ""); res.StatusCode != http.StatusForbidden {
+		t.Fatalf("expired cookie: status = %d", res.StatusCode)
+	}
+
+	future := strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10)
+	cl.cookie = cl.sign(t, app, "clear", future)
+	if res, _ := cl.do(t, app, "GET", "/", ""); res.StatusCode != http.StatusOK {
+		t.Fatalf("valid cookie: status = %d", res.StatusCode)
+	}
+	// 题目不能当 cookie 用
+	cl.cookie = cl.sign(t, app, "challenge", future)
+	if res, _ := cl.do(t, app, "GET", "/", ""); res.StatusCode != http.StatusForbidden {
+		t.Fatalf("challenge as cookie: status = %d", res.StatusCode)
+	}
+}
+
+func TestRejectedAnswers(t *testing.T) {
+	_, app := newApp(t)
+	cl := &client{ip: "10.0.0.1", ua: "test/1.0"}
+
+	expired := cl.sign(t, app, "challenge", strconv.FormatInt(time.Now().Add(-time.Second).Unix(), 10)+"-abc")
+	valid := cl.challenge(t, app)
+	payload, _, _ := strings.Cut(valid, ".")
+
+	// 找一个前导零不够的 nonce
+	var weak string
+	for i := 0; weak == ""; i++ {
+		if leadingZeroBits(sha256.Sum256([]byte(valid+":"+strconv.Itoa(i)))) < difficulty {
+			weak = strconv.Itoa(i)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		nonce string
+	}{
+		{"expired token", expired, Solve(expired, difficulty)},
+		{"forged mac", payload + ".AAAAAAAAAAAAAAAAAAAAAAAA", Solve(payload+".AAAAAAAAAAAAAAAAAAAAAAAA", difficulty)},
+		{"no mac", payload, Solve(payload, difficulty)},
+		{"insufficient bits", valid, weak},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := cl.verify(t, app, tt.token, tt.nonce); status != http.StatusForbidden || cl.cookie != "" {
+				t.Fatalf("status = %d, cookie = %q", status, cl.cookie)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+// Package sign 校验请求签名，防止请求被篡改和重放。
+//
+// 客户端需要带上 X-App-Key、X-Timestamp（Unix 秒）、X-Nonce 和 X-Signature，
+// 签名为 hex(HMAC-SHA256(secret, 规范串))，规范串由以下各行用 \n 连接:
+//
+//	METHOD
+//	PATH
+//	按 key、value 排序后编码的查询参数
+//	hex(SHA256(请求体))
+//	TIMESTAMP
+//	NONCE
+package sign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	t "github.com/axuman/go-server/biz"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	HeaderAppKey    = "X-App-Key"
+	HeaderTimestamp = "X-Timestamp"
+	HeaderNonce     = "X-Nonce"
+	HeaderSignature = "X-Signature"
+
+	CodeSignatureInvalid = "signature_invalid"
+	CodeSignatureExpired = "signature_expired"
+	CodeNonceReused      = "nonce_reused"
+)
+
+// Key 一个应用密钥，轮换时同一个 app 可以同时配置新旧两个，旧密钥设置 NotAfter
+type Key struct {
+	Secret   []byte
+	NotAfter time.Time // 零值表示不过期
+}
+
+// NonceStore 记录窗口期内出现过的 nonce
+type NonceStore interface {
+	// Add 在 key 不存在时写入并返回 true，已存在时返回 false
+	Add(key string, ttl time.Duration) bool
+}
+
+type Config struct {
+	Keys   map[string][]Key // app key -> 密钥
+	Window time.Duration    // 允许的时间偏差，默认 5 分钟
+	Store  NonceStore       // 默认使用进程内存储
+}
+
+type Signer struct {
+	cfg   Config
+	owned *MemoryStore // New 创建的默认存储，由 Close 关闭
+}
+
+func New(cfg Config) *Signer {
+	if cfg.Window <= 0 {
+		cfg.Window = 5 * time.Minute
+	}
+	var owned *MemoryStore
+	if cfg.Store == nil {
+		owned = NewMemoryStore()
+		cfg.Store = owned
+	}
+	return &Signer{cfg: cfg, owned: owned}
+}
+
+// Close 关闭默认的 MemoryStore，调用方传入的 Store 由调用方自己关闭
+func (s *Signer) Close() {
+	if s.owned != nil {
+		s.owned.Close()
+	}
+}
+
+// Handler 返回校验签名的中间件
+func (s *Signer) Handler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		appKey := c.Get(HeaderAppKey)
+		ts := c.Get(HeaderTimestamp)
+		nonce := c.Get(HeaderNonce)
+		sig, err := hex.DecodeString(c.Get(HeaderSignature))
+		invalid := t.NewError(fiber.StatusUnauthorized, CodeSignatureInvalid, "Invalid request signature")
+		if appKey == "" || ts == "" || nonce == "" || len(nonce) > 64 || err != nil {
+			return invalid
+		}
+
+		unix, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return invalid
+		}
+		now := time.Now()
+		if skew := now.Sub(time.Unix(unix, 0)); skew > s.cfg.Window || skew < -s.cfg.Window {
+			return t.NewError(fiber.StatusUnauthorized, CodeSignatureExpired, "Request timestamp is outside the allowed window")
+		}
+
+		canonical := Canonical(c.Method(), c.Path(), string(c.Request().URI().QueryString()), c.Body(), ts, nonce)
+		if !s.verify(appKey, canonical, sig, now) {
+			return invalid
+		}
+		// 签名通过后才记录 nonce，避免伪造请求占用别人的 nonce
+		if !s.cfg.Store.Add(appKey+":"+nonce, 2*s.cfg.Window) {
+			return t.NewError(fiber.StatusUnauthorized, CodeNonceReused, "Nonce has already been used")
+		}
+
+		c.Locals("app_key", appKey)
+		return c.Next()
+	}
+}
+
+func (s *Signer) verify(appKey string, canonical, sig []byte, now time.Time) bool {
+	for _, k := range s.cfg.Keys[appKey] {
+		if !k.NotAfter.IsZero() && now.After(k.NotAfter) {
+			continue
+		}
+		if hmac.Equal(sig, mac(k.Secret, canonical)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Canonical 生成待签名的规范串
+func Canonical(method, path, rawQuery string, body []byte, timestamp, nonce string) []byte {
+	sum := sha256.Sum256(body)
+	return []byte(strings.Join([]string{
+		strings.ToUpper(method),
+		path,
+		canonicalQuery(rawQuery),
+		hex.EncodeToString(sum[:]),
+		timestamp,
+		nonce,
+	}, "\n"))
+}
+
+// Sign 计算签名，供客户端使用
+func Sign(secret []byte, method, path, rawQuery string, body []byte, timestamp, nonce string) string {
+	return hex.EncodeToString(mac(secret, Canonical(method, path, rawQuery, body, timestamp, nonce)))
+}
+
+func mac(secret, msg []byte) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write(msg)
+	return h.Sum(nil)
+}
+
+func canonicalQuery(rawQuery string) string {
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return rawQuery
+	}
+	for _, v := range values {
+		slices.Sort(v)
+	}
+	return values.Encode() // Encode 会按 key 排序
+}
+
+// MemoryStore 进程内的 NonceStore
+type MemoryStore struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+	stop chan struct{}
+}
+
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{seen: map[string]time.Time{}, stop: make(chan struct{})}
+	go s.sweep()
+	return s
+}
+
+// Close 停止后台清理
+func (s *MemoryStore) Close() {
+	close(s.stop)
+}
+
+func (s *MemoryStore) Add(key string, ttl time.Duration) bool {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if exp, ok := s.seen[key]; ok && now.Before(exp) {
+		return false
+	}
+	s.seen[key] = now.Add(ttl)
+	return true
+}
+
+func (s *MemoryStore) sweep() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+		now := time.Now()
+		s.mu.Lock()
+		for k, exp := range s.seen {
+			if now.After(exp) {
+				delete(s.seen, k)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// ParseKeys 解析 "app1:secret1,app1:secret2:2026-12-31,app2:secret3" 格式的密钥列表，
+// 可选的第三段是过期时间，轮换时给旧密钥加上，日期表示到当天结束（UTC），也可以写 RFC3339 时间
+func ParseKeys(spec string) (map[string][]Key, error) {
+	keys := map[string][]Key{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		app, rest, _ := strings.Cut(part, ":")
+		secret, notAfter := splitExpiry(rest)
+		if app == "" || secret == "" {
+			return nil, fmt.Errorf("sign key %q must be app:secret[:expiry]", part)
+		}
+		keys[app] = append(keys[app], Key{Secret: []byte(secret), NotAfter: notAfter})
+	}
+	return keys, nil
+}
+
+// splitExpiry 从 "secret:过期时间" 中拆出过期时间，没有能解析的过期时间时整段都是密钥
+func splitExpiry(s string) (string, time.Time) {
+	for i := 0; i < len(s); i++ {
+		if s[i] != ':' {
+			continue
+		}
+		if tm, err := time.Parse(time.RFC3339, s[i+1:]); err == nil {
+			return s[:i], tm
+		}
+		if tm, err := time.Parse(time.DateOnly, s[i+1:]); err == nil {
+			return s[:i], tm.AddDate(0, 0, 1)
+		}
+	}
+	return s, time.Time{}
+}
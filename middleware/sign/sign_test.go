@@ -0,0 +1,97 @@
+package sign
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/axuman/go-server/biz"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestParseKeys(t *testing.T) {
+	day := time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want map[string][]Key
+		err  bool
+	}{
+		{"", map[string][]Key{}, false},
+		{"a:s1, a:s2 ,b:s3", map[string][]Key{"a": {{Secret: []byte("s1")}, {Secret: []byte("s2")}}, "b": {{Secret: []byte("s3")}}}, false},
+		{"a:old:2026-12-31", map[string][]Key{"a": {{Secret: []byte("old"), NotAfter: day.AddDate(0, 0, 1)}}}, false},
+		{"a:old:2026-12-31T08:00:00Z", map[string][]Key{"a": {{Secret: []byte("old"), NotAfter: day.Add(8 * time.Hour)}}}, false},
+		{"a:with:colon", map[string][]Key{"a": {{Secret: []byte("with:colon")}}}, false},
+		{"a:", nil, true},
+		{":s", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseKeys(tt.spec)
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for app, keys := range tt.want {
+				if len(got[app]) != len(keys) {
+					t.Fatalf("%s: got %v, want %v", app, got[app], keys)
+				}
+				for i, k := range keys {
+					if string(got[app][i].Secret) != string(k.Secret) || !got[app][i].NotAfter.Equal(k.NotAfter) {
+						t.Fatalf("%s[%d]: got %+v, want %+v", app, i, got[app][i], k)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	keys, err := ParseKeys("app:current,app:expired:2000-01-01,app:rotating:2999-01-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New(fiber.Config{ErrorHandler: func(c *fiber.Ctx, err error) error {
+		ae := biz.AsAppError(err)
+		return c.Status(ae.Status).SendString(ae.Code)
+	}})
+	app.Use(New(Config{Keys: keys}).Handler())
+	app.Post("/x", func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	tests := []struct {
+		name   string
+		secret string
+		ts     string
+		nonce  string
+		status int
+	}{
+		{"current key", "current", now, "n1", fiber.StatusOK},
+		{"key still in rotation", "rotating", now, "n2", fiber.StatusOK},
+		{"expired key", "expired", now, "n3", fiber.StatusUnauthorized},
+		{"unknown secret", "other", now, "n4", fiber.StatusUnauthorized},
+		{"stale timestamp", "current", old, "n5", fiber.StatusUnauthorized},
+		{"replayed nonce", "current", now, "n1", fiber.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"a":1}`
+			req := httptest.NewRequest("POST", "/x?b=2&a=1", strings.NewReader(body))
+			req.Header.Set(HeaderAppKey, "app")
+			req.Header.Set(HeaderTimestamp, tt.ts)
+			req.Header.Set(HeaderNonce, tt.nonce)
+			req.Header.Set(HeaderSignature, Sign([]byte(tt.secret), "POST", "/x", "a=1&b=2", []byte(body), tt.ts, tt.nonce))
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
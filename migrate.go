@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	svr "github.com/axuman/go-server/svr"
+)
+
+const migrateUsage = `usage: go-server migrate <command>
+
+commands:
+  up          apply all pending migrations
+  down [n]    revert the last n applied migrations (default 1)
+  status      list migrations and whether they are applied
+  redo        revert and re-apply the last applied migration`
+
+// runMigrate 处理 `go-server migrate ...` 子命令
+func runMigrate(cfg svr.DBConfig, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing migrate command\n%s", migrateUsage)
+	}
+
+	db, err := svr.OpenDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	m, err := svr.NewMigrator(db, nil)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		n, err := m.Up(ctx)
+		if err != nil {
+			return err
+		}
+		log.Printf("%d migration(s) applied", n)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps <= 0 {
+				return fmt.Errorf("invalid step count %q", args[1])
+			}
+		}
+		n, err := m.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		log.Printf("%d migration(s) reverted", n)
+	case "redo":
+		return m.Redo(ctx)
+	case "status":
+		list, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range list {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if s.Modified {
+				state += " (modified)"
+			}
+			if s.Missing {
+				state += " (missing file)"
+			}
+			fmt.Fprintf(os.Stdout, "%04d  %-30s %s\n", s.Version, s.Name, state)
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %q\n%s", args[0], migrateUsage)
+	}
+	return nil
+}
@@ -1,6 +1,6 @@
 package models
 
 type Mall struct {
-	Name     *string `json:"name" validate:"required"`
-	Location *string `json:"location" validate:"required"`
+	Name     *string `json:"name" db:"name" validate:"required" filter:"eq,ne,in,nin,like,prefix" sort:"true"`
+	Location *string `json:"location" db:"location" validate:"required" filter:"eq,ne,in,like,prefix"`
 }
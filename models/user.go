@@ -1,9 +1,7 @@
 // models/user.go
 package models
 
-
-
 type User struct {
-    Name *string `json:"name"`
-    Age  *int    `json:"age"`
-}
\ No newline at end of file
+	Name *string `json:"name" db:"name" validate:"required,max=64" filter:"eq,ne,in,nin,like,prefix" sort:"true"`
+	Age  *int    `json:"age" db:"age" validate:"required,gte=0,lte=150" filter:"eq,ne,gt,gte,lt,lte,in,nin" sort:"true"`
+}
@@ -0,0 +1,190 @@
+package mq
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Handler 处理一条消息，返回 error 时按退避重试
+type Handler func(ctx context.Context, msg *Message) error
+
+// DeadLetter 返回 topic 对应的死信 topic
+func DeadLetter(topic string) string {
+	return topic + ".dlq"
+}
+
+// Subscribe 以消费组 group 订阅 topic，启动 concurrency 个 worker。
+// 消费组第一次订阅之后发布的消息都会投递给它，即使消费者暂时不在线。
+func (q *Queue) Subscribe(topic, group string, concurrency int, h Handler) error {
+	if topic == "" || group == "" {
+		return fmt.Errorf("mq: topic and group are required")
+	}
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	if _, err := q.db.Exec("INSERT OR IGNORE INTO mq_groups (topic, grp) VALUES (?, ?)", topic, group); err != nil {
+		return err
+	}
+
+	wake := make(chan struct{}, 1)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	q.subsMu.Lock()
+	q.subs[topic] = append(q.subs[topic], wake)
+	q.subsMu.Unlock()
+	for i := 0; i < concurrency; i++ {
+		q.workers.Add(1)
+		go q.work(topic, group, h, wake)
+	}
+	return nil
+}
+
+func (q *Queue) work(topic, group string, h Handler, wake chan struct{}) {
+	defer q.workers.Done()
+	ticker := time.NewTicker(q.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.stop:
+			return
+		default:
+		}
+
+		msg, err := q.claim(topic, group)
+		if err != nil {
+			log.Printf("mq: claim %s/%s: %v", topic, group, err)
+		}
+		if msg == nil {
+			select {
+			case <-q.stop:
+				return
+			case <-wake:
+			case <-ticker.C:
+			}
+			continue
+		}
+		q.handle(group, h, msg)
+	}
+}
+
+// claim 取一条可见的消息，并把它隐藏到可见性超时之后
+func (q *Queue) claim(topic, group string) (*Message, error) {
+	now := time.Now()
+	msg := &Message{Topic: topic}
+	var headers string
+	err := q.db.QueryRow(`
+		UPDATE mq_deliveries SET attempts = attempts + 1, visible_at = ?
+		WHERE rowid = (
+			SELECT d.rowid FROM mq_deliveries d JOIN mq_messages m ON m.id = d.message_id
+			WHERE d.grp = ? AND m.topic = ? AND d.visible_at <= ?
+			ORDER BY d.visible_at, d.message_id LIMIT 1
+		)
+		RETURNING message_id, attempts`,
+		now.Add(q.cfg.VisibilityTimeout).UnixMilli(), group, topic, now.UnixMilli(),
+	).Scan(&msg.ID, &msg.Attempts)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	err = q.db.QueryRow("SELECT body, headers, created_at FROM mq_messages WHERE id = ?", msg.ID).
+		Scan(&msg.Body, &headers, &msg.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	json.Unmarshal([]byte(headers), &msg.Headers)
+	return msg, nil
+}
+
+func (q *Queue) handle(group string, h Handler, msg *Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), q.cfg.VisibilityTimeout)
+	defer cancel()
+	err := safeCall(ctx, h, msg)
+	if err == nil {
+		if _, err := q.db.Exec("DELETE FROM mq_deliveries WHERE grp = ? AND message_id = ?", group, msg.ID); err != nil {
+			log.Printf("mq: ack %s #%d: %v", msg.Topic, msg.ID, err)
+		}
+		return
+	}
+
+	if msg.Attempts >= q.cfg.MaxAttempts {
+		q.deadLetter(group, msg, err)
+		return
+	}
+	retryAt := time.Now().Add(q.cfg.Retry.Backoff(msg.Attempts - 1))
+	if _, dbErr := q.db.Exec("UPDATE mq_deliveries SET visible_at = ?, last_error = ? WHERE grp = ? AND message_id = ?",
+		retryAt.UnixMilli(), err.Error(), group, msg.ID); dbErr != nil {
+		log.Printf("mq: nack %s #%d: %v", msg.Topic, msg.ID, dbErr)
+	}
+}
+
+// deadLetter 把消息转入死信 topic 并删除原投递，两步在同一个事务中
+func (q *Queue) deadLetter(group string, msg *Message, cause error) {
+	log.Printf("mq: %s #%d failed %d times in group %s, moving to %s: %v",
+		msg.Topic, msg.ID, msg.Attempts, group, DeadLetter(msg.Topic), cause)
+	headers := map[string]string{
+		"original_topic": msg.Topic,
+		"original_id":    fmt.Sprint(msg.ID),
+		"group":          group,
+		"error":          cause.Error(),
+	}
+	if _, err := q.insert(context.Background(), []outgoing{{DeadLetter(msg.Topic), msg.Body, headers}}); err != nil {
+		log.Printf("mq: dead letter %s #%d: %v", msg.Topic, msg.ID, err)
+		return
+	}
+	if _, err := q.db.Exec("DELETE FROM mq_deliveries WHERE grp = ? AND message_id = ?", group, msg.ID); err != nil {
+		log.Printf("mq: ack %s #%d: %v", msg.Topic, msg.ID, err)
+	}
+}
+
+func safeCall(ctx context.Context, h Handler, msg *Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return h(ctx, msg)
+}
+
+// GroupStats 一个消费组的积压情况
+type GroupStats struct {
+	Topic    string `json:"topic"`
+	Group    string `json:"group"`
+	Pending  int64  `json:"pending"`  // 可以立即投递
+	Inflight int64  `json:"inflight"` // 暂不可见：已取走未确认，或失败后等待重试
+	Retrying int64  `json:"retrying"` // 至少失败过一次，和前两项有重叠
+}
+
+func (q *Queue) Stats(ctx context.Context) ([]GroupStats, error) {
+	now := time.Now().UnixMilli()
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT g.topic, g.grp,
+			COUNT(d.message_id) - COALESCE(SUM(d.visible_at > ?), 0),
+			COALESCE(SUM(d.visible_at > ?), 0),
+			COALESCE(SUM(d.last_error IS NOT NULL), 0)
+		FROM mq_groups g
+		LEFT JOIN mq_messages m ON m.topic = g.topic
+		LEFT JOIN mq_deliveries d ON d.grp = g.grp AND d.message_id = m.id
+		GROUP BY g.topic, g.grp ORDER BY g.topic, g.grp`, now, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []GroupStats{}
+	for rows.Next() {
+		var s GroupStats
+		if err := rows.Scan(&s.Topic, &s.Group, &s.Pending, &s.Inflight, &s.Retrying); err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,297 @@
+// Package mq 基于独立 SQLite 文件的进程内消息队列。
+//
+// 每个消费组独立收到 topic 上的每条消息（至少一次），组内多个 worker 竞争消费。
+// 消息被取走后在可见性超时内对其他 worker 不可见，处理失败按指数退避重试，
+// 超过最大次数后转入 <topic>.dlq 死信 topic。
+package mq
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/axuman/go-server/resilience"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var ErrClosed = errors.New("mq: queue is closed")
+
+const schema = `
+CREATE TABLE IF NOT EXISTS mq_messages (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	topic      TEXT NOT NULL,
+	body       BLOB NOT NULL,
+	headers    TEXT NOT NULL DEFAULT '{}',
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS mq_groups (
+	topic      TEXT NOT NULL,
+	grp        TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (topic, grp)
+);
+CREATE TABLE IF NOT EXISTS mq_deliveries (
+	message_id INTEGER NOT NULL,
+	grp        TEXT NOT NULL,
+	attempts   INTEGER NOT NULL DEFAULT 0,
+	visible_at INTEGER NOT NULL, -- Unix 毫秒
+	last_error TEXT,
+	PRIMARY KEY (grp, message_id)
+);
+CREATE INDEX IF NOT EXISTS mq_deliveries_visible ON mq_deliveries (grp, visible_at);
+`
+
+type Config struct {
+	Path              string        // SQLite 文件，默认 ./mq.db
+	VisibilityTimeout time.Duration // 取走的消息多久没有确认就重新投递，默认 30 秒
+	MaxAttempts       int           // 超过后转入死信，默认 5
+	Retry             resilience.Retry
+	PollInterval      time.Duration // 没有新消息通知时的轮询间隔，默认 1 秒
+	Retention         time.Duration // 所有组都确认后的消息保留多久，默认 24 小时
+	BufferSize        int           // Emit 的缓冲区大小，默认 1024
+}
+
+// Message 一条消息，Attempts 为包括本次在内的投递次数
+type Message struct {
+	ID        int64
+	Topic     string
+	Body      []byte
+	Headers   map[string]string
+	Attempts  int
+	CreatedAt time.Time
+}
+
+// Decode 把 JSON 消息体解析到 v
+func (m *Message) Decode(v any) error {
+	return json.Unmarshal(m.Body, v)
+}
+
+type outgoing struct {
+	topic   string
+	body    []byte
+	headers map[string]string
+}
+
+type Queue struct {
+	cfg Config
+	db  *sql.DB
+
+	emits  chan outgoing
+	stop   chan struct{}
+	closed bool
+	mu     sync.RWMutex // 保护 closed，Emit 持有读锁直到写入 emits，Close 之后不会再写入已关闭的通道
+
+	// subs 单独加锁：writeLoop 不能等 mu，否则 Emit 阻塞在满的缓冲区上时
+	// 等待中的 Close 会让 writeLoop 也拿不到读锁，缓冲区永远不会被取走
+	subsMu sync.Mutex
+	subs   map[string][]chan struct{} // topic -> 各订阅的唤醒通道
+
+	writer  sync.WaitGroup
+	workers sync.WaitGroup
+}
+
+// Open 打开（必要时创建）队列文件，启动异步写入和清理
+func Open(cfg Config) (*Queue, error) {
+	if cfg.Path == "" {
+		cfg.Path = "./mq.db"
+	}
+	if cfg.VisibilityTimeout <= 0 {
+		cfg.VisibilityTimeout = 30 * time.Second
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.Retry.BaseDelay <= 0 {
+		cfg.Retry.BaseDelay = time.Second
+	}
+	if cfg.Retry.MaxDelay <= 0 {
+		cfg.Retry.MaxDelay = 5 * time.Minute
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = 24 * time.Hour
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 1024
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+cfg.Path+"?_journal_mode=WAL&_busy_timeout=10000&_txlock=immediate&_synchronous=NORMAL")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(4)
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("mq: create schema: %w", err)
+	}
+
+	q := &Queue{
+		cfg:   cfg,
+		db:    db,
+		emits: make(chan outgoing, cfg.BufferSize),
+		stop:  make(chan struct{}),
+		subs:  map[string][]chan struct{}{},
+	}
+	q.writer.Add(1)
+	go q.writeLoop()
+	go q.cleanLoop()
+	return q, nil
+}
+
+// Publish 同步写入一条消息，v 为 []byte 时原样写入，否则编码为 JSON
+func (q *Queue) Publish(ctx context.Context, topic string, v any, headers map[string]string) (int64, error) {
+	body, err := encode(v)
+	if err != nil {
+		return 0, err
+	}
+	ids, err := q.insert(ctx, []outgoing{{topic, body, headers}})
+	if err != nil {
+		return 0, err
+	}
+	return ids[0], nil
+}
+
+// Emit 异步发布，写入缓冲区后立即返回，适合在请求处理中发事件。
+// 缓冲区满时会阻塞直到有空位；进程退出前 Close 会写完缓冲区。
+func (q *Queue) Emit(topic string, v any) error {
+	body, err := encode(v)
+	if err != nil {
+		return err
+	}
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrClosed
+	}
+	q.emits <- outgoing{topic: topic, body: body}
+	return nil
+}
+
+func encode(v any) ([]byte, error) {
+	if b, ok := v.([]byte); ok {
+		return b, nil
+	}
+	return json.Marshal(v)
+}
+
+// writeLoop 把 Emit 的消息批量写入
+func (q *Queue) writeLoop() {
+	defer q.writer.Done()
+	for first := range q.emits {
+		batch := []outgoing{first}
+	drain:
+		for len(batch) < 256 {
+			select {
+			case m, ok := <-q.emits:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, m)
+			default:
+				break drain
+			}
+		}
+		if _, err := q.insert(context.Background(), batch); err != nil {
+			log.Printf("mq: dropped %d emitted messages: %v", len(batch), err)
+		}
+	}
+}
+
+// insert 在一个事务中写入消息，并为订阅了该 topic 的每个消费组生成投递记录
+func (q *Queue) insert(ctx context.Context, batch []outgoing) ([]int64, error) {
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UnixMilli()
+	ids := make([]int64, len(batch))
+	for i, m := range batch {
+		headers, _ := json.Marshal(m.headers)
+		if m.headers == nil {
+			headers = []byte("{}")
+		}
+		if err := tx.QueryRowContext(ctx,
+			"INSERT INTO mq_messages (topic, body, headers) VALUES (?, ?, ?) RETURNING id",
+			m.topic, m.body, string(headers),
+		).Scan(&ids[i]); err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO mq_deliveries (message_id, grp, visible_at) SELECT ?, grp, ? FROM mq_groups WHERE topic = ?",
+			ids[i], now, m.topic,
+		); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	q.subsMu.Lock()
+	for _, m := range batch {
+		for _, wake := range q.subs[m.topic] {
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+		}
+	}
+	q.subsMu.Unlock()
+	return ids, nil
+}
+
+// cleanLoop 删除所有消费组都已确认且超过保留期的消息
+func (q *Queue) cleanLoop() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.stop:
+			return
+		case <-ticker.C:
+		}
+		cutoff := time.Now().Add(-q.cfg.Retention).UTC().Format("2006-01-02 15:04:05")
+		if _, err := q.db.Exec(`DELETE FROM mq_messages WHERE created_at < ?
+			AND NOT EXISTS (SELECT 1 FROM mq_deliveries WHERE message_id = mq_messages.id)`, cutoff); err != nil {
+			log.Printf("mq: clean: %v", err)
+		}
+	}
+}
+
+// Close 停止接收 Emit，写完缓冲区，等待正在处理的消息完成（最多到 ctx 结束）后关闭文件
+func (q *Queue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil
+	}
+	q.closed = true
+	close(q.emits)
+	close(q.stop)
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.writer.Wait()
+		q.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Printf("mq: close: %v, unfinished messages will be redelivered", ctx.Err())
+	}
+	if _, err := q.db.Exec("PRAGMA wal_checkpoint(TRUNCATE);"); err != nil {
+		log.Printf("mq: checkpoint: %v", err)
+	}
+	return q.db.Close()
+}
@@ -0,0 +1,207 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/axuman/go-server/resilience"
+)
+
+func open(t *testing.T, cfg Config) *Queue {
+	t.Helper()
+	cfg.Path = filepath.Join(t.TempDir(), "mq.db")
+	if cfg.PollInterval == 0 {
+		cfg.PollInterval = 10 * time.Millisecond
+	}
+	q, err := Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { q.Close(context.Background()) })
+	return q
+}
+
+func TestEachGroupReceivesEveryMessage(t *testing.T) {
+	q := open(t, Config{})
+	var mu sync.Mutex
+	got := map[string][]string{}
+	done := make(chan struct{}, 4)
+	for _, group := range []string{"a", "b"} {
+		err := q.Subscribe("orders", group, 2, func(ctx context.Context, msg *Message) error {
+			var v string
+			if err := msg.Decode(&v); err != nil {
+				return err
+			}
+			mu.Lock()
+			got[group] = append(got[group], v)
+			mu.Unlock()
+			done <- struct{}{}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := q.Publish(context.Background(), "orders", "x", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Emit("orders", "y"); err != nil {
+		t.Fatal(err)
+	}
+	for range 4 {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out, got %v", got)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, group := range []string{"a", "b"} {
+		if len(got[group]) != 2 {
+			t.Fatalf("group %s got %v", group, got[group])
+		}
+	}
+}
+
+func TestFailingMessageMovesToDeadLetter(t *testing.T) {
+	q := open(t, Config{MaxAttempts: 3, Retry: resilience.Retry{BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}})
+	var attempts atomic.Int32
+	err := q.Subscribe("jobs", "w", 1, func(ctx context.Context, msg *Message) error {
+		attempts.Add(1)
+		return errors.New("boom")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := make(chan *Message, 1)
+	if err := q.Subscribe(DeadLetter("jobs"), "ops", 1, func(ctx context.Context, msg *Message) error {
+		dead <- msg
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Publish(context.Background(), "jobs", "x", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case msg := <-dead:
+		if msg.Headers["original_topic"] != "jobs" || msg.Headers["error"] != "boom" {
+			t.Fatalf("headers = %v", msg.Headers)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not dead-lettered")
+	}
+	if n := attempts.Load(); n != 3 {
+		t.Fatalf("attempts = %d, want 3", n)
+	}
+}
+
+// Emit 在缓冲区满时阻塞，此时 Close 不能和 writeLoop 互相等待
+func TestCloseWithFullBufferDoesNotDeadlock(t *testing.T) {
+	q := open(t, Config{BufferSize: 1})
+	if err := q.Subscribe("events", "g", 1, func(ctx context.Context, msg *Message) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	// 占住写锁，让 writeLoop 停在 insert 中，之后的 Emit 会填满缓冲区并阻塞
+	tx, err := q.db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("INSERT INTO mq_groups (topic, grp) VALUES ('lock', 'lock')"); err != nil {
+		t.Fatal(err)
+	}
+	emitted := make(chan error, 3)
+	for range 3 {
+		go func() { emitted <- q.Emit("events", "x") }()
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	closed := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		closed <- q.Close(ctx)
+	}()
+	// Close 已经在等锁时 writeLoop 才写完并唤醒订阅者
+	time.Sleep(50 * time.Millisecond)
+	tx.Rollback()
+
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Close deadlocked")
+	}
+	for range 3 {
+		if err := <-emitted; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.Emit("events", "x"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Emit after Close = %v", err)
+	}
+}
+
+// 重试中的消息被取走后算在 inflight 里，而不是 pending
+func TestStatsCountsRetriedMessageInflight(t *testing.T) {
+	q := open(t, Config{MaxAttempts: 5, Retry: resilience.Retry{BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}})
+	claimed := make(chan struct{})
+	unblock := make(chan struct{})
+	release := sync.OnceFunc(func() { close(unblock) })
+	t.Cleanup(release) // 失败时也要放行，Close 才不会一直等待
+	err := q.Subscribe("jobs", "w", 1, func(ctx context.Context, msg *Message) error {
+		if msg.Attempts == 1 {
+			return errors.New("boom")
+		}
+		close(claimed)
+		<-unblock
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Publish(context.Background(), "jobs", "x", nil); err != nil {
+		t.Fatal(err)
+	}
+	stats := func() GroupStats {
+		t.Helper()
+		list, err := q.Stats(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range list {
+			if s.Topic == "jobs" && s.Group == "w" {
+				return s
+			}
+		}
+		t.Fatalf("stats = %+v", list)
+		return GroupStats{}
+	}
+
+	select {
+	case <-claimed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not retried")
+	}
+	if s := stats(); s.Pending != 0 || s.Inflight != 1 || s.Retrying != 1 {
+		t.Fatalf("while retrying: %+v", s)
+	}
+	release()
+	deadline := time.Now().Add(5 * time.Second)
+	for s := stats(); s.Pending+s.Inflight+s.Retrying != 0; s = stats() {
+		if time.Now().After(deadline) {
+			t.Fatalf("after ack: %+v", s)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,177 @@
+// Package outbox 把 Repository 在事务中写入 outbox 表的事件异步转发给各个 Sink。
+//
+// 投递至少一次：同一聚合的事件按写入顺序转发，失败时按指数退避重试，
+// 消费方应按事件 id 去重。重试 MaxAttempts 次仍失败的事件标记为 dead（dead_at），
+// 不再转发，同一聚合之后的事件继续转发。
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	t "github.com/axuman/go-server/biz"
+	"github.com/axuman/go-server/resilience"
+)
+
+const sqliteTime = "2006-01-02 15:04:05"
+
+// Sink 事件的接收方，例如消息队列、Webhook 或 IPC sidecar
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, e *t.Event) error
+}
+
+type Config struct {
+	PollInterval time.Duration // 默认 500 毫秒
+	BatchSize    int           // 默认 100
+	Retry        resilience.Retry
+	MaxAttempts  int           // 超过后标记为 dead，默认 20
+	Retention    time.Duration // 已转发和 dead 事件的保留时间，默认 7 天
+}
+
+type Relay struct {
+	db    *sql.DB
+	cfg   Config
+	sinks []Sink
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+func New(db *sql.DB, cfg Config, sinks ...Sink) *Relay {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 500 * time.Millisecond
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.Retry.BaseDelay <= 0 {
+		cfg.Retry.BaseDelay = time.Second
+	}
+	if cfg.Retry.MaxDelay <= 0 {
+		cfg.Retry.MaxDelay = 5 * time.Minute
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 20
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = 7 * 24 * time.Hour
+	}
+	return &Relay{db: db, cfg: cfg, sinks: sinks, stop: make(chan struct{}), done: make(chan struct{})}
+}
+
+// Start 启动转发循环
+func (r *Relay) Start() {
+	go r.loop()
+}
+
+// Close 停止转发，未转发的事件保留在表中，下次启动时继续
+func (r *Relay) Close(ctx context.Context) error {
+	close(r.stop)
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Relay) loop() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+	lastClean := time.Time{}
+	for {
+		n, err := r.dispatch(context.Background())
+		if err != nil {
+			log.Printf("outbox: dispatch: %v", err)
+		}
+		if time.Since(lastClean) > 10*time.Minute {
+			r.clean()
+			lastClean = time.Now()
+		}
+		if n == r.cfg.BatchSize {
+			select {
+			case <-r.stop:
+				return
+			default:
+				continue
+			}
+		}
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatch 转发一批到期的事件，返回取到的事件数。
+// 同一聚合前面还有未转发（且不是 dead）的事件时跳过，保证顺序。
+func (r *Relay) dispatch(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, event, aggregate, aggregate_id, payload, created_at, attempts FROM outbox o
+		WHERE dispatched_at IS NULL AND dead_at IS NULL AND next_attempt_at <= ?
+		AND NOT EXISTS (
+			SELECT 1 FROM outbox p WHERE p.aggregate = o.aggregate AND p.aggregate_id = o.aggregate_id
+			AND p.id < o.id AND p.dispatched_at IS NULL AND p.dead_at IS NULL
+		)
+		ORDER BY id LIMIT ?`, now.Format(sqliteTime), r.cfg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	var events []t.Event
+	for rows.Next() {
+		var e t.Event
+		var payload string
+		if err := rows.Scan(&e.ID, &e.Type, &e.Aggregate, &e.AggregateID, &payload, &e.CreatedAt, &e.Attempts); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		e.Payload = []byte(payload)
+		events = append(events, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for i := range events {
+		e := &events[i]
+		if err := r.send(ctx, e); err != nil && e.Attempts+1 >= r.cfg.MaxAttempts {
+			log.Printf("outbox: event #%d %s failed %d times, marking it dead: %v", e.ID, e.Type, e.Attempts+1, err)
+			_, err = r.db.ExecContext(ctx, "UPDATE outbox SET attempts = attempts + 1, last_error = ?, dead_at = CURRENT_TIMESTAMP WHERE id = ?",
+				err.Error(), e.ID)
+		} else if err != nil {
+			retryAt := now.Add(r.cfg.Retry.Backoff(e.Attempts))
+			log.Printf("outbox: event #%d %s attempt %d failed, retry at %s: %v", e.ID, e.Type, e.Attempts+1, retryAt.Format(time.RFC3339), err)
+			_, err = r.db.ExecContext(ctx, "UPDATE outbox SET attempts = attempts + 1, last_error = ?, next_attempt_at = ? WHERE id = ?",
+				err.Error(), retryAt.Format(sqliteTime), e.ID)
+		} else {
+			_, err = r.db.ExecContext(ctx, "UPDATE outbox SET attempts = attempts + 1, last_error = NULL, dispatched_at = CURRENT_TIMESTAMP WHERE id = ?", e.ID)
+		}
+		if err != nil {
+			return len(events), err
+		}
+	}
+	return len(events), nil
+}
+
+func (r *Relay) send(ctx context.Context, e *t.Event) error {
+	for _, s := range r.sinks {
+		if err := s.Send(ctx, e); err != nil {
+			return fmt.Errorf("%s: %w", s.Name(), err)
+		}
+	}
+	return nil
+}
+
+func (r *Relay) clean() {
+	cutoff := time.Now().Add(-r.cfg.Retention).UTC().Format(sqliteTime)
+	if _, err := r.db.Exec("DELETE FROM outbox WHERE dispatched_at < ? OR dead_at < ?", cutoff, cutoff); err != nil {
+		log.Printf("outbox: clean: %v", err)
+	}
+}
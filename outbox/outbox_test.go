@@ -0,0 +1,144 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/axuman/go-server/biz"
+	"github.com/axuman/go-server/ipc"
+	"github.com/axuman/go-server/resilience"
+	svr "github.com/axuman/go-server/svr"
+)
+
+func openDB(tb testing.TB) *sql.DB {
+	tb.Helper()
+	db, err := svr.InitDB(svr.DBConfig{Path: filepath.Join(tb.TempDir(), "test.db"), MaxOpenConns: 4, MaxIdleConns: 4})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+	return db
+}
+
+// recordSink 记录收到的事件 id，fail 中的事件总是失败
+type recordSink struct {
+	mu   sync.Mutex
+	got  []int64
+	fail map[int64]bool
+}
+
+func (s *recordSink) Name() string { return "record" }
+
+func (s *recordSink) Send(ctx context.Context, e *biz.Event) error {
+	if s.fail[e.ID] {
+		return errors.New("boom")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.got = append(s.got, e.ID)
+	return nil
+}
+
+func insert(tb testing.TB, db *sql.DB, aggregate string, aggregateID int64) int64 {
+	tb.Helper()
+	var id int64
+	err := db.QueryRow("INSERT INTO outbox (event, aggregate, aggregate_id, payload) VALUES (?, ?, ?, '{}') RETURNING id",
+		aggregate+".updated", aggregate, aggregateID).Scan(&id)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return id
+}
+
+func TestDispatchMarksEventDeadAfterMaxAttempts(t *testing.T) {
+	db := openDB(t)
+	first := insert(t, db, "malls", 1)
+	second := insert(t, db, "malls", 1)
+	other := insert(t, db, "users", 1)
+
+	sink := &recordSink{fail: map[int64]bool{first: true}}
+	r := New(db, Config{MaxAttempts: 3, Retry: resilience.Retry{BaseDelay: time.Nanosecond, MaxDelay: time.Nanosecond}}, sink)
+	ctx := context.Background()
+
+	// 第一个事件失败前，同一聚合的第二个事件一直被挡住
+	for range 2 {
+		if _, err := r.dispatch(ctx); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(1100 * time.Millisecond) // next_attempt_at 精度为秒
+	}
+	if len(sink.got) != 1 || sink.got[0] != other {
+		t.Fatalf("before dead: got %v", sink.got)
+	}
+	if _, err := r.dispatch(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.dispatch(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.got) != 2 || sink.got[1] != second {
+		t.Fatalf("after dead: got %v", sink.got)
+	}
+
+	var attempts int
+	var dead sql.NullString
+	var lastError string
+	if err := db.QueryRow("SELECT attempts, dead_at, last_error FROM outbox WHERE id = ?", first).Scan(&attempts, &dead, &lastError); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 3 || !dead.Valid || lastError != "record: boom" {
+		t.Fatalf("attempts = %d, dead_at = %v, last_error = %q", attempts, dead, lastError)
+	}
+}
+
+func TestIPCSink(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "sidecar.sock")
+	server := ipc.NewServer()
+	got := make(chan biz.Event, 1)
+	server.Handle("onEvent", func(ctx context.Context, req json.RawMessage) (any, error) {
+		var e biz.Event
+		if err := json.Unmarshal(req, &e); err != nil {
+			return nil, err
+		}
+		if e.Aggregate == "fail" {
+			return nil, errors.New("rejected")
+		}
+		got <- e
+		return nil, nil
+	})
+	if err := server.Listen(socket); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close(context.Background())
+
+	registry := ipc.NewRegistry()
+	defer registry.Close()
+	registry.Register("js", socket)
+	sink, err := ParseIPCSink(registry, "js.onEvent")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := sink.Send(ctx, &biz.Event{ID: 7, Type: "malls.created", Aggregate: "malls", AggregateID: 1, Payload: []byte(`{"a":1}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if e := <-got; e.ID != 7 || e.Type != "malls.created" || string(e.Payload) != `{"a":1}` {
+		t.Fatalf("got %+v", e)
+	}
+	if err := sink.Send(ctx, &biz.Event{ID: 8, Aggregate: "fail"}); err == nil {
+		t.Fatal("expected the sidecar error")
+	}
+
+	for _, spec := range []string{"js", ".onEvent", "js."} {
+		if _, err := ParseIPCSink(registry, spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	t "github.com/axuman/go-server/biz"
+	"github.com/axuman/go-server/ipc"
+	"github.com/axuman/go-server/mq"
+)
+
+// QueueSink 把事件发布到同名 topic，例如 mall.created
+type QueueSink struct {
+	Queue *mq.Queue
+}
+
+func (s QueueSink) Name() string {
+	return "mq"
+}
+
+func (s QueueSink) Send(ctx context.Context, e *t.Event) error {
+	_, err := s.Queue.Publish(ctx, e.Type, []byte(e.Payload), map[string]string{
+		"event_id":     strconv.FormatInt(e.ID, 10),
+		"aggregate":    e.Aggregate,
+		"aggregate_id": strconv.FormatInt(e.AggregateID, 10),
+	})
+	return err
+}
+
+// WebhookSink 把事件 POST 到 URL，2xx 视为成功。
+// 配置了 Secret 时带 X-Signature: hex(HMAC-SHA256(secret, 请求体))
+type WebhookSink struct {
+	URL    string
+	Secret []byte
+	Client *http.Client // 默认 10 秒超时
+}
+
+const (
+	HeaderEventID   = "X-Event-ID"
+	HeaderEventType = "X-Event-Type"
+	HeaderSignature = "X-Signature"
+)
+
+var defaultClient = &http.Client{Timeout: 10 * time.Second}
+
+func (s WebhookSink) Name() string {
+	return "webhook " + s.URL
+}
+
+func (s WebhookSink) Send(ctx context.Context, e *t.Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEventID, strconv.FormatInt(e.ID, 10))
+	req.Header.Set(HeaderEventType, e.Type)
+	if len(s.Secret) > 0 {
+		mac := hmac.New(sha256.New, s.Secret)
+		mac.Write(body)
+		req.Header.Set(HeaderSignature, hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	client := s.Client
+	if client == nil {
+		client = defaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// IPCSink 通过 IPC 调用 sidecar 的方法，参数为事件 JSON，返回 error 视为失败
+type IPCSink struct {
+	Registry *ipc.Registry
+	Service  string
+	Method   string
+}
+
+// ParseIPCSink 解析 "service.method" 格式的配置，例如 js.onEvent
+func ParseIPCSink(r *ipc.Registry, spec string) (IPCSink, error) {
+	service, method, ok := strings.Cut(spec, ".")
+	if !ok || service == "" || method == "" {
+		return IPCSink{}, fmt.Errorf("outbox ipc sink %q must be service.method", spec)
+	}
+	return IPCSink{Registry: r, Service: service, Method: method}, nil
+}
+
+func (s IPCSink) Name() string {
+	return "ipc " + s.Service + "." + s.Method
+}
+
+func (s IPCSink) Send(ctx context.Context, e *t.Event) error {
+	return s.Registry.Call(ctx, s.Service, s.Method, e, nil)
+}
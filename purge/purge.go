@@ -0,0 +1,216 @@
+// Package purge 定期硬删除软删除超过保留期的记录。
+//
+// 每批只删除 BatchSize 行，批次之间暂停一下让出写锁，避免长时间阻塞其他写请求；
+// 删除之后在 auto_vacuum = INCREMENTAL 的数据库上执行 incremental_vacuum 归还空闲页。
+package purge
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/axuman/go-server/cache"
+)
+
+const sqliteTime = "2006-01-02 15:04:05"
+
+// autoVacuumIncremental PRAGMA auto_vacuum 的返回值
+const autoVacuumIncremental = 2
+
+// registry 由各实体的 BuildRoutes 通过 Register 登记的表
+var (
+	registryMu sync.Mutex
+	registry   []string
+)
+
+// Register 登记需要清理软删除记录的表，重复登记会被忽略
+func Register(tables ...string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for _, table := range tables {
+		if !slices.Contains(registry, table) {
+			registry = append(registry, table)
+		}
+	}
+}
+
+// Registered 返回已登记的表
+func Registered() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	return slices.Clone(registry)
+}
+
+type Config struct {
+	Retention time.Duration // 软删除超过这个时间的记录会被硬删除
+	Interval  time.Duration // 默认 1 小时
+	BatchSize int           // 每批删除的行数，默认 500
+	Pause     time.Duration // 批次之间的间隔，默认 50 毫秒
+}
+
+// Stats 最近一次清理的结果
+type Stats struct {
+	LastRun  time.Time        `json:"last_run"`
+	Duration string           `json:"duration"`
+	Purged   map[string]int64 `json:"purged"` // 表名 -> 删除的行数
+	Vacuumed bool             `json:"vacuumed"`
+	Error    string           `json:"error,omitempty"`
+}
+
+type Purger struct {
+	db     *sql.DB
+	cache  *cache.Cache
+	cfg    Config
+	tables func() []string
+
+	run   sync.Mutex // 定时任务和手动触发不同时执行
+	mu    sync.Mutex
+	stats Stats
+	warn  sync.Once
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New tables 在每次清理时调用，返回需要清理的表，表必须有 id 和 deleted_at 列；
+// 表名同时是接口缓存的命名空间，有记录被删除时使 c 中对应的缓存失效，c 可以为 nil
+func New(db *sql.DB, c *cache.Cache, cfg Config, tables func() []string) *Purger {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Hour
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+	if cfg.Pause <= 0 {
+		cfg.Pause = 50 * time.Millisecond
+	}
+	return &Purger{db: db, cache: c, cfg: cfg, tables: tables, stop: make(chan struct{}), done: make(chan struct{})}
+}
+
+// Start 启动定时清理
+func (p *Purger) Start() {
+	go p.loop()
+}
+
+// Close 停止定时清理，正在进行的清理在当前批次结束后停止
+func (p *Purger) Close(ctx context.Context) error {
+	close(p.stop)
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Purger) loop() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-p.stop
+		cancel()
+	}()
+
+	for {
+		if _, err := p.Run(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("purge: %v", err)
+		}
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run 立即执行一次清理，返回各表删除的行数
+func (p *Purger) Run(ctx context.Context) (Stats, error) {
+	p.run.Lock()
+	defer p.run.Unlock()
+
+	start := time.Now()
+	stats := Stats{LastRun: start, Purged: map[string]int64{}}
+	cutoff := start.Add(-p.cfg.Retention).UTC().Format(sqliteTime)
+	var total int64
+	var err error
+	for _, table := range p.tables() {
+		var n int64
+		n, err = p.purge(ctx, table, cutoff)
+		stats.Purged[table] = n
+		total += n
+		if n > 0 && p.cache != nil {
+			p.cache.Bump(table)
+		}
+		if err != nil {
+			break
+		}
+	}
+	if total > 0 && err == nil {
+		stats.Vacuumed, err = p.vacuum(ctx)
+	}
+	stats.Duration = time.Since(start).String()
+	if err != nil {
+		stats.Error = err.Error()
+	}
+	if total > 0 {
+		log.Printf("purge: deleted %d rows in %s", total, stats.Duration)
+	}
+
+	p.mu.Lock()
+	p.stats = stats
+	p.mu.Unlock()
+	return stats, err
+}
+
+// Stats 返回最近一次清理的结果
+func (p *Purger) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats
+}
+
+// purge 分批删除一张表中过期的软删除记录
+func (p *Purger) purge(ctx context.Context, table, cutoff string) (int64, error) {
+	query := "DELETE FROM " + table + " WHERE id IN (SELECT id FROM " + table +
+		" WHERE deleted_at IS NOT NULL AND deleted_at < ? ORDER BY id LIMIT ?)"
+	var total int64
+	for {
+		res, err := p.db.ExecContext(ctx, query, cutoff, p.cfg.BatchSize)
+		if err != nil {
+			return total, err
+		}
+		n, _ := res.RowsAffected()
+		total += n
+		if n < int64(p.cfg.BatchSize) {
+			return total, nil
+		}
+		select {
+		case <-ctx.Done():
+			return total, ctx.Err()
+		case <-time.After(p.cfg.Pause):
+		}
+	}
+}
+
+// vacuum 归还空闲页，数据库不是 INCREMENTAL 模式时只提示一次
+func (p *Purger) vacuum(ctx context.Context) (bool, error) {
+	var mode int
+	if err := p.db.QueryRowContext(ctx, "PRAGMA auto_vacuum").Scan(&mode); err != nil {
+		return false, err
+	}
+	if mode != autoVacuumIncremental {
+		p.warn.Do(func() {
+			log.Printf("purge: auto_vacuum is not INCREMENTAL, free pages are kept; run PRAGMA auto_vacuum = INCREMENTAL and VACUUM once to enable it")
+		})
+		return false, nil
+	}
+	_, err := p.db.ExecContext(ctx, "PRAGMA incremental_vacuum")
+	return err == nil, err
+}
@@ -0,0 +1,132 @@
+package purge
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/axuman/go-server/cache"
+	svr "github.com/axuman/go-server/svr"
+)
+
+func migratedDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := svr.InitDB(svr.DBConfig{Path: filepath.Join(t.TempDir(), "test.db"), MaxOpenConns: 4, MaxIdleConns: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// insertDeleted 插入 n 个软删除超过两小时的用户
+func insertDeleted(t *testing.T, db *sql.DB, n int) {
+	t.Helper()
+	old := time.Now().Add(-2 * time.Hour).UTC().Format(sqliteTime)
+	for i := range n {
+		if _, err := db.Exec("INSERT INTO users (name, age, deleted_at) VALUES (?, 1, ?)", "u"+strconv.Itoa(i), old); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRunPurgesAndInvalidatesCache(t *testing.T) {
+	db := migratedDB(t)
+	old := time.Now().Add(-2 * time.Hour).UTC().Format(sqliteTime)
+	for _, stmt := range []string{
+		"INSERT INTO users (name, age, deleted_at) VALUES ('a', 1, '" + old + "')",
+		"INSERT INTO users (name, age, deleted_at) VALUES ('b', 1, '" + old + "')",
+		"INSERT INTO users (name, age, deleted_at) VALUES ('c', 1, CURRENT_TIMESTAMP)",
+		"INSERT INTO users (name, age) VALUES ('d', 1)",
+		"INSERT INTO malls (name, location, deleted_at) VALUES ('m', 'x', CURRENT_TIMESTAMP)",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := cache.New(cache.Config{})
+	p := New(db, c, Config{Retention: time.Hour, BatchSize: 1, Pause: time.Millisecond}, func() []string {
+		return []string{"users", "malls"}
+	})
+	stats, err := p.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Purged["users"] != 2 || stats.Purged["malls"] != 0 {
+		t.Fatalf("purged = %v", stats.Purged)
+	}
+	var left int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&left); err != nil || left != 2 {
+		t.Fatalf("users left = %d, %v", left, err)
+	}
+	// 只有删除了记录的表的缓存失效
+	if c.Version("users") != 1 || c.Version("malls") != 0 {
+		t.Fatalf("versions: users = %d, malls = %d", c.Version("users"), c.Version("malls"))
+	}
+}
+
+func TestRunLoopsOverBatches(t *testing.T) {
+	db := migratedDB(t)
+	insertDeleted(t, db, 25)
+	c := cache.New(cache.Config{})
+	p := New(db, c, Config{Retention: time.Hour, BatchSize: 10, Pause: time.Millisecond}, func() []string {
+		return []string{"users"}
+	})
+	stats, err := p.Run(context.Background())
+	if err != nil || stats.Purged["users"] != 25 {
+		t.Fatalf("purged = %v, %v", stats.Purged, err)
+	}
+	var left int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&left); err != nil || left != 0 {
+		t.Fatalf("users left = %d, %v", left, err)
+	}
+	// 一次清理只 Bump 一次，没有删除记录的清理不 Bump
+	if _, err := p.Run(context.Background()); err != nil || c.Version("users") != 1 {
+		t.Fatalf("version = %d, %v", c.Version("users"), err)
+	}
+	if st := p.Stats(); st.Purged["users"] != 0 || st.Error != "" {
+		t.Fatalf("stats = %+v", st)
+	}
+}
+
+// 批次之间的暂停中 ctx 结束时停止，已删除的部分照样使缓存失效
+func TestRunStopsWhenCanceled(t *testing.T) {
+	db := migratedDB(t)
+	insertDeleted(t, db, 3)
+	c := cache.New(cache.Config{})
+	p := New(db, c, Config{Retention: time.Hour, BatchSize: 1, Pause: time.Hour}, func() []string {
+		return []string{"users", "malls"}
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	stats, err := p.Run(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) || stats.Error == "" {
+		t.Fatalf("err = %v, stats = %+v", err, stats)
+	}
+	if _, ok := stats.Purged["malls"]; stats.Purged["users"] != 1 || ok {
+		t.Fatalf("purged = %v", stats.Purged)
+	}
+	if c.Version("users") != 1 {
+		t.Fatalf("version = %d", c.Version("users"))
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("a", "b")
+	Register("a")
+	got := Registered()
+	if !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("registered = %v", got)
+	}
+	// 返回的是副本
+	got[0] = "x"
+	if Registered()[0] != "a" {
+		t.Fatal("Registered returned the registry itself")
+	}
+}
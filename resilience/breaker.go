@@ -0,0 +1,121 @@
+package resilience
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	t "github.com/axuman/go-server/biz"
+)
+
+const CodeCircuitOpen = "circuit_open"
+
+// 熔断器状态
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half_open"
+)
+
+type BreakerConfig struct {
+	FailureThreshold int           // 连续失败多少次后打开，0 表示不启用
+	OpenFor          time.Duration // 打开多久后进入半开，默认 30 秒
+	HalfOpenMax      int           // 半开时允许同时通过的探测请求数，默认 1
+}
+
+// Breaker 熔断器，nil 表示不启用，所有请求都放行
+type Breaker struct {
+	name     string
+	cfg      BreakerConfig
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probes   int
+}
+
+func NewBreaker(name string, cfg BreakerConfig) *Breaker {
+	if cfg.FailureThreshold <= 0 {
+		return nil
+	}
+	if cfg.OpenFor <= 0 {
+		cfg.OpenFor = 30 * time.Second
+	}
+	if cfg.HalfOpenMax <= 0 {
+		cfg.HalfOpenMax = 1
+	}
+	b := &Breaker{name: name, cfg: cfg, state: StateClosed}
+	metrics(name).Set("state", stateVar{b})
+	return b
+}
+
+// Allow 判断请求能否通过，打开状态或半开探测名额已满时返回 503
+func (b *Breaker) Allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateOpen && time.Since(b.openedAt) >= b.cfg.OpenFor {
+		b.setState(StateHalfOpen)
+	}
+	switch {
+	case b.state == StateOpen, b.state == StateHalfOpen && b.probes >= b.cfg.HalfOpenMax:
+		metrics(b.name).Add("rejected", 1)
+		return t.NewError(http.StatusServiceUnavailable, CodeCircuitOpen, "Service temporarily unavailable, please retry later")
+	case b.state == StateHalfOpen:
+		b.probes++
+	}
+	return nil
+}
+
+// Record 记录一次请求结果，必须与成功的 Allow 成对调用
+func (b *Breaker) Record(success bool) {
+	if b == nil {
+		return
+	}
+	if !success {
+		metrics(b.name).Add("failures", 1)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case StateHalfOpen:
+		b.probes--
+		if success {
+			b.setState(StateClosed)
+		} else {
+			b.setState(StateOpen)
+		}
+	case StateClosed:
+		if success {
+			b.failures = 0
+		} else if b.failures++; b.failures >= b.cfg.FailureThreshold {
+			b.setState(StateOpen)
+		}
+	}
+}
+
+func (b *Breaker) State() string {
+	if b == nil {
+		return StateClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *Breaker) setState(state string) {
+	if b.state == state {
+		return
+	}
+	log.Printf("resilience: breaker %s %s -> %s", b.name, b.state, state)
+	b.state = state
+	b.failures = 0
+	b.probes = 0
+	if state == StateOpen {
+		b.openedAt = time.Now()
+		metrics(b.name).Add("opened", 1)
+	}
+}
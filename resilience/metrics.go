@@ -0,0 +1,38 @@
+package resilience
+
+import (
+	"expvar"
+	"strconv"
+	"sync"
+)
+
+// root 在 /admin/metrics 中显示为 "resilience": {"<name>": {"requests": ..., "state": ...}}
+var (
+	root   = expvar.NewMap("resilience")
+	rootMu sync.Mutex
+)
+
+func metrics(name string) *expvar.Map {
+	if m, ok := root.Get(name).(*expvar.Map); ok {
+		return m
+	}
+	rootMu.Lock()
+	defer rootMu.Unlock()
+	if m, ok := root.Get(name).(*expvar.Map); ok {
+		return m
+	}
+	m := new(expvar.Map).Init()
+	root.Set(name, m)
+	return m
+}
+
+// Count 给指标 name.key 加一，供网关等调用方记录重试次数
+func Count(name, key string) {
+	metrics(name).Add(key, 1)
+}
+
+type stateVar struct{ b *Breaker }
+
+func (v stateVar) String() string {
+	return strconv.Quote(v.b.State())
+}
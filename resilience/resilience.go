@@ -0,0 +1,103 @@
+// Package resilience 提供超时、重试和熔断策略，状态通过 expvar 暴露在 /admin/metrics。
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	t "github.com/axuman/go-server/biz"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Policy 一组路由的容错策略，本地路由不重试，上游调用的重试见 gateway 的路由配置
+type Policy struct {
+	Timeout time.Duration // 请求截止时间，通过 c.UserContext() 传给数据库和上游调用，0 表示不限制
+	Breaker BreakerConfig
+}
+
+// Override 按 "timeout=10s failure_threshold=50 open_for=30s half_open_max=2" 这样的选项修改策略
+func (p Policy) Override(opts ...string) (Policy, error) {
+	for _, opt := range opts {
+		key, value, ok := strings.Cut(opt, "=")
+		var d time.Duration
+		var n int
+		var err error
+		switch key {
+		case "timeout", "open_for":
+			d, err = time.ParseDuration(value)
+			ok = ok && err == nil && d >= 0
+			if key == "timeout" {
+				p.Timeout = d
+			} else {
+				p.Breaker.OpenFor = d
+			}
+		case "failure_threshold", "half_open_max":
+			n, err = strconv.Atoi(value)
+			ok = ok && err == nil && n >= 0
+			if key == "failure_threshold" {
+				p.Breaker.FailureThreshold = n
+			} else {
+				p.Breaker.HalfOpenMax = n
+			}
+		default:
+			ok = false
+		}
+		if !ok {
+			return p, fmt.Errorf("invalid policy option %q", opt)
+		}
+	}
+	return p, nil
+}
+
+// Handler 返回应用超时和熔断的中间件，name 用于区分熔断器和指标
+//
+// handler 必须使用 c.UserContext() 调用数据库，截止时间才能生效。
+func Handler(name string, p Policy) fiber.Handler {
+	b := NewBreaker(name, p.Breaker)
+	m := metrics(name)
+	return func(c *fiber.Ctx) error {
+		if err := b.Allow(); err != nil {
+			return err
+		}
+		m.Add("requests", 1)
+
+		if p.Timeout > 0 {
+			ctx, cancel := context.WithTimeout(c.UserContext(), p.Timeout)
+			defer cancel()
+			c.SetUserContext(ctx)
+		}
+
+		err := c.Next()
+		if errors.Is(err, context.DeadlineExceeded) {
+			m.Add("timeouts", 1)
+		}
+		b.Record(Status(c, err) < http.StatusInternalServerError)
+		return err
+	}
+}
+
+// Status 返回请求最终的状态码，err 不为空时按 ErrorHandler 的规则推算
+func Status(c *fiber.Ctx, err error) int {
+	if err == nil {
+		return c.Response().StatusCode()
+	}
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return fe.Code
+	}
+	return t.AsAppError(err).Status
+}
+
+// Idempotent 判断方法是否可以安全重试
+func Idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
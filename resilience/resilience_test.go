@@ -0,0 +1,167 @@
+package resilience
+
+import (
+	"context"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/axuman/go-server/biz"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestBreakerStates(t *testing.T) {
+	b := NewBreaker("test.breaker", BreakerConfig{FailureThreshold: 2, OpenFor: 20 * time.Millisecond})
+	pass := func() {
+		t.Helper()
+		if err := b.Allow(); err != nil {
+			t.Fatalf("state %s: Allow = %v", b.State(), err)
+		}
+	}
+	reject := func() {
+		t.Helper()
+		if err := b.Allow(); biz.AsAppError(err).Code != CodeCircuitOpen {
+			t.Fatalf("state %s: Allow = %v", b.State(), err)
+		}
+	}
+	want := func(state string) {
+		t.Helper()
+		if got := b.State(); got != state {
+			t.Fatalf("state = %s, want %s", got, state)
+		}
+	}
+
+	// 成功会清零连续失败次数
+	pass()
+	b.Record(false)
+	pass()
+	b.Record(true)
+	pass()
+	b.Record(false)
+	want(StateClosed)
+	pass()
+	b.Record(false)
+	want(StateOpen)
+	reject()
+
+	// 半开时只放行一个探测请求，探测失败重新打开
+	time.Sleep(30 * time.Millisecond)
+	pass()
+	want(StateHalfOpen)
+	reject()
+	b.Record(false)
+	want(StateOpen)
+	reject()
+
+	// 探测成功后关闭
+	time.Sleep(30 * time.Millisecond)
+	pass()
+	b.Record(true)
+	want(StateClosed)
+	pass()
+	b.Record(true)
+
+	if NewBreaker("test.disabled", BreakerConfig{}) != nil {
+		t.Fatal("FailureThreshold 0 should disable the breaker")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	r := Retry{BaseDelay: 10 * time.Millisecond, MaxDelay: 100 * time.Millisecond}
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{0, 10 * time.Millisecond},
+		{1, 20 * time.Millisecond},
+		{3, 80 * time.Millisecond},
+		{4, 100 * time.Millisecond},
+		{62, 100 * time.Millisecond}, // 移位溢出时取上限
+	}
+	for _, tt := range tests {
+		seen := map[time.Duration]bool{}
+		for range 200 {
+			d := r.Backoff(tt.attempt)
+			if d <= 0 || d > tt.max {
+				t.Fatalf("Backoff(%d) = %v, want (0, %v]", tt.attempt, d, tt.max)
+			}
+			seen[d] = true
+		}
+		// full jitter：等待时间是随机的
+		if len(seen) < 10 {
+			t.Fatalf("Backoff(%d) returned only %d distinct values", tt.attempt, len(seen))
+		}
+	}
+
+	if d := (Retry{}).Backoff(100); d <= 0 || d > 2*time.Second {
+		t.Fatalf("default Backoff = %v", d)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := (Retry{BaseDelay: time.Hour, MaxDelay: time.Hour}).Wait(ctx, 0); err != context.Canceled {
+		t.Fatalf("Wait = %v", err)
+	}
+}
+
+// counter 读取指标 name.key，测试多次运行时指标会累加，只比较差值
+func counter(name, key string) int64 {
+	if v, ok := metrics(name).Get(key).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func TestHandlerTimeout(t *testing.T) {
+	const name = "test.handler"
+	requests, timeouts, rejected := counter(name, "requests"), counter(name, "timeouts"), counter(name, "rejected")
+	app := fiber.New(fiber.Config{ErrorHandler: func(c *fiber.Ctx, err error) error {
+		ae := biz.AsAppError(err)
+		return c.Status(ae.Status).JSON(ae)
+	}})
+	app.Use(Handler(name, Policy{
+		Timeout: 20 * time.Millisecond,
+		Breaker: BreakerConfig{FailureThreshold: 1, OpenFor: time.Hour},
+	}))
+	app.Get("/slow", func(c *fiber.Ctx) error {
+		<-c.UserContext().Done()
+		return c.UserContext().Err()
+	})
+
+	res, err := app.Test(httptest.NewRequest("GET", "/slow", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d", res.StatusCode)
+	}
+	if counter(name, "requests")-requests != 1 || counter(name, "timeouts")-timeouts != 1 {
+		t.Fatalf("metrics = %s", metrics(name))
+	}
+	// 超时计为失败，熔断器打开后直接返回 503
+	if res, _ = app.Test(httptest.NewRequest("GET", "/slow", nil), -1); res.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("status after timeout = %d", res.StatusCode)
+	}
+	if counter(name, "rejected")-rejected != 1 {
+		t.Fatalf("metrics = %s", metrics(name))
+	}
+}
+
+func TestOverride(t *testing.T) {
+	base := Policy{Timeout: 5 * time.Second, Breaker: BreakerConfig{FailureThreshold: 20, OpenFor: 10 * time.Second}}
+	p, err := base.Override("timeout=1s", "failure_threshold=0", "open_for=1m", "half_open_max=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Policy{Timeout: time.Second, Breaker: BreakerConfig{FailureThreshold: 0, OpenFor: time.Minute, HalfOpenMax: 3}}
+	if p != want {
+		t.Fatalf("got %+v, want %+v", p, want)
+	}
+	for _, opt := range []string{"timeout", "timeout=x", "timeout=-1s", "failure_threshold=-1", "retries=2"} {
+		if _, err := base.Override(opt); err == nil {
+			t.Errorf("%q: expected an error", opt)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package resilience
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// Retry 指数退避重试，等待时间为 [0, min(MaxDelay, BaseDelay*2^n)) 之间的随机值（full jitter）
+type Retry struct {
+	Max       int           // 最多重试次数，0 表示不重试
+	BaseDelay time.Duration // 默认 50 毫秒
+	MaxDelay  time.Duration // 默认 2 秒
+}
+
+// Backoff 返回第 attempt 次重试（从 0 开始）前的等待时间
+func (r Retry) Backoff(attempt int) time.Duration {
+	base, ceil := r.BaseDelay, r.MaxDelay
+	if base <= 0 {
+		base = 50 * time.Millisecond
+	}
+	if ceil <= 0 {
+		ceil = 2 * time.Second
+	}
+	d := ceil
+	if attempt < 30 && base<<attempt < ceil {
+		d = base << attempt
+	}
+	return rand.N(d) + 1
+}
+
+// Wait 等待退避时间，ctx 先结束时返回 ctx 的错误
+func (r Retry) Wait(ctx context.Context, attempt int) error {
+	timer := time.NewTimer(r.Backoff(attempt))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
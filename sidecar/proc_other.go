@@ -0,0 +1,16 @@
+//go:build !unix
+
+package sidecar
+
+import "os/exec"
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// terminate 没有 SIGTERM，直接结束进程
+func terminate(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
+
+func kill(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
@@ -0,0 +1,21 @@
+//go:build unix
+
+package sidecar
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup 让子进程自成一组，停止时连同它启动的子进程一起发信号
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func terminate(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+}
+
+func kill(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
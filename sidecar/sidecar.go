@@ -0,0 +1,365 @@
+// Package sidecar 启动并守护 Rust、JS 等辅助进程：按策略重启、把输出写进日志、
+// 等 IPC socket 就绪后再注册到 ipc.Registry，优雅关闭时先 SIGTERM 再 SIGKILL。
+//
+// 子进程会收到以下环境变量:
+//
+//	GOSERVER_SIDECAR_NAME    名称
+//	GOSERVER_SIDECAR_SOCKET  应该监听的 IPC socket
+//	GOSERVER_IPC_SOCKET      本服务的 IPC socket（配置了 ipc.socket 时）
+package sidecar
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/axuman/go-server/gateway"
+	"github.com/axuman/go-server/ipc"
+)
+
+// 重启策略
+const (
+	RestartAlways    = "always"
+	RestartOnFailure = "on-failure"
+	RestartNever     = "never"
+)
+
+// 进程状态
+const (
+	StateStarting = "starting"
+	StateReady    = "ready"
+	StateBackoff  = "backoff"
+	StateExited   = "exited"
+	StateStopped  = "stopped"
+)
+
+// stableAfter 运行超过这个时间后退出，重启间隔从 Backoff.Initial 重新开始
+var stableAfter = time.Minute
+
+// waitDelay 进程退出后等待输出管道关闭的时间
+const waitDelay = 2 * time.Second
+
+type Duration = gateway.Duration
+
+type ProcessConfig struct {
+	Name         string            `json:"name"`
+	Command      []string          `json:"command"` // 程序和参数
+	Dir          string            `json:"dir"`     // 工作目录，默认为当前目录
+	Env          map[string]string `json:"env"`     // 追加到当前环境变量之后
+	Socket       string            `json:"socket"`  // IPC socket，为空时启动后即视为就绪，不注册到 Registry
+	Restart      string            `json:"restart"` // always（默认）、on-failure、never
+	Backoff      BackoffConfig     `json:"backoff"`
+	ReadyTimeout Duration          `json:"ready_timeout"` // 等待 socket 就绪，默认 30 秒，超时后重启
+	StopTimeout  Duration          `json:"stop_timeout"`  // SIGTERM 之后等待退出的时间，默认 10 秒
+}
+
+type BackoffConfig struct {
+	Initial Duration `json:"initial"` // 默认 1 秒
+	Max     Duration `json:"max"`     // 默认 1 分钟
+}
+
+type Config struct {
+	Sidecars []ProcessConfig `json:"sidecars"`
+}
+
+// LoadFile 读取 JSON 格式的配置
+func LoadFile(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+type Supervisor struct {
+	registry *ipc.Registry
+	env      []string
+	procs    []*process
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// New 校验配置，env 为额外传给所有子进程的环境变量（KEY=VALUE）
+func New(cfg Config, registry *ipc.Registry, env ...string) (*Supervisor, error) {
+	s := &Supervisor{registry: registry, env: env}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	seen := map[string]bool{}
+	for _, pc := range cfg.Sidecars {
+		if pc.Name == "" || seen[pc.Name] {
+			return nil, fmt.Errorf("sidecar name %q is empty or duplicated", pc.Name)
+		}
+		seen[pc.Name] = true
+		if len(pc.Command) == 0 {
+			return nil, fmt.Errorf("sidecar %s has no command", pc.Name)
+		}
+		switch pc.Restart {
+		case "":
+			pc.Restart = RestartAlways
+		case RestartAlways, RestartOnFailure, RestartNever:
+		default:
+			return nil, fmt.Errorf("sidecar %s: unknown restart policy %q", pc.Name, pc.Restart)
+		}
+		if pc.Backoff.Initial <= 0 {
+			pc.Backoff.Initial = Duration(time.Second)
+		}
+		if pc.Backoff.Max < pc.Backoff.Initial {
+			pc.Backoff.Max = max(pc.Backoff.Initial, Duration(time.Minute))
+		}
+		if pc.ReadyTimeout <= 0 {
+			pc.ReadyTimeout = Duration(30 * time.Second)
+		}
+		if pc.StopTimeout <= 0 {
+			pc.StopTimeout = Duration(10 * time.Second)
+		}
+		s.procs = append(s.procs, &process{cfg: pc, s: s, state: StateStarting})
+	}
+	return s, nil
+}
+
+// Start 在后台启动所有进程
+func (s *Supervisor) Start() {
+	for _, p := range s.procs {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			p.run()
+		}()
+	}
+}
+
+// Stop 停止所有进程并等待退出，ctx 到期时返回
+func (s *Supervisor) Stop(ctx context.Context) error {
+	s.cancel()
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type process struct {
+	cfg ProcessConfig
+	s   *Supervisor
+
+	mu        sync.Mutex
+	state     string
+	pid       int
+	restarts  int
+	startedAt time.Time
+	lastExit  string
+}
+
+func (p *process) set(fn func(p *process)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fn(p)
+}
+
+func (p *process) run() {
+	backoff := time.Duration(p.cfg.Backoff.Initial)
+	for {
+		started := time.Now()
+		err := p.runOnce()
+		if p.cfg.Socket != "" && p.s.registry != nil {
+			p.s.registry.Deregister(p.cfg.Name)
+		}
+
+		exit := "exit status 0"
+		if err != nil {
+			exit = err.Error()
+		}
+		if p.s.ctx.Err() != nil {
+			p.set(func(p *process) { p.state, p.pid, p.lastExit = StateStopped, 0, exit })
+			log.Printf("sidecar %s: stopped (%s)", p.cfg.Name, exit)
+			return
+		}
+		log.Printf("sidecar %s: exited: %s", p.cfg.Name, exit)
+		if p.cfg.Restart == RestartNever || (p.cfg.Restart == RestartOnFailure && err == nil) {
+			p.set(func(p *process) { p.state, p.pid, p.lastExit = StateExited, 0, exit })
+			return
+		}
+
+		if time.Since(started) > stableAfter {
+			backoff = time.Duration(p.cfg.Backoff.Initial)
+		}
+		p.set(func(p *process) { p.state, p.pid, p.lastExit = StateBackoff, 0, exit })
+		log.Printf("sidecar %s: restarting in %s", p.cfg.Name, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-p.s.ctx.Done():
+			p.set(func(p *process) { p.state = StateStopped })
+			return
+		}
+		backoff = min(backoff*2, time.Duration(p.cfg.Backoff.Max))
+		p.set(func(p *process) { p.restarts++ })
+	}
+}
+
+// runOnce 启动一次进程并等待它退出
+func (p *process) runOnce() error {
+	cmd := exec.Command(p.cfg.Command[0], p.cfg.Command[1:]...)
+	cmd.Dir = p.cfg.Dir
+	cmd.Env = append(os.Environ(), p.s.env...)
+	cmd.Env = append(cmd.Env, "GOSERVER_SIDECAR_NAME="+p.cfg.Name, "GOSERVER_SIDECAR_SOCKET="+p.cfg.Socket)
+	for k, v := range p.cfg.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	setProcessGroup(cmd)
+
+	// 输出经 io.Pipe 转给 copyLog，子进程退出后最多再等 waitDelay，
+	// 以免它启动的后台进程继续占着管道让 Wait 一直阻塞
+	stdout, stdoutW := io.Pipe()
+	stderr, stderrW := io.Pipe()
+	cmd.Stdout, cmd.Stderr = stdoutW, stderrW
+	cmd.WaitDelay = waitDelay
+	var output sync.WaitGroup
+	output.Add(2)
+	go p.copyLog(&output, "stdout", stdout)
+	go p.copyLog(&output, "stderr", stderr)
+	defer func() {
+		stdoutW.Close()
+		stderrW.Close()
+		output.Wait()
+	}()
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	p.set(func(p *process) { p.state, p.pid, p.startedAt = StateStarting, cmd.Process.Pid, time.Now() })
+	log.Printf("sidecar %s: started pid %d", p.cfg.Name, cmd.Process.Pid)
+
+	exited := make(chan struct{})
+	go p.waitReady(exited, cmd)
+	go func() {
+		select {
+		case <-exited:
+		case <-p.s.ctx.Done():
+			stop(cmd, time.Duration(p.cfg.StopTimeout), exited)
+		}
+	}()
+
+	err := cmd.Wait()
+	close(exited)
+	if errors.Is(err, exec.ErrWaitDelay) {
+		// 进程本身正常退出，只是还有别的进程持有它的输出
+		log.Printf("sidecar %s: output still open %s after exit, closed", p.cfg.Name, waitDelay)
+		err = nil
+	}
+	return err
+}
+
+// copyLog 把子进程的输出逐行写进日志
+func (p *process) copyLog(wg *sync.WaitGroup, stream string, r io.Reader) {
+	defer wg.Done()
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		log.Printf("sidecar %s [%s] %s", p.cfg.Name, stream, sc.Text())
+	}
+	if err := sc.Err(); err != nil {
+		log.Printf("sidecar %s [%s] %v, discarding the rest", p.cfg.Name, stream, err)
+		io.Copy(io.Discard, r) // 继续读，以免子进程写满管道后阻塞
+	}
+}
+
+// waitReady 等待 socket 可以调用后注册到 Registry，超时则杀掉进程让它重启
+func (p *process) waitReady(exited chan struct{}, cmd *exec.Cmd) {
+	if p.cfg.Socket == "" {
+		p.set(func(p *process) { p.state = StateReady })
+		return
+	}
+	deadline := time.Now().Add(time.Duration(p.cfg.ReadyTimeout))
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-exited:
+			return
+		case <-p.s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if ping(p.cfg.Socket) {
+			if p.s.registry != nil {
+				p.s.registry.Register(p.cfg.Name, p.cfg.Socket)
+			}
+			p.set(func(p *process) { p.state = StateReady })
+			log.Printf("sidecar %s: ready on %s", p.cfg.Name, p.cfg.Socket)
+			return
+		}
+		if time.Now().After(deadline) {
+			log.Printf("sidecar %s: socket %s not ready after %s, killing", p.cfg.Name, p.cfg.Socket, time.Duration(p.cfg.ReadyTimeout))
+			stop(cmd, time.Duration(p.cfg.StopTimeout), exited)
+			return
+		}
+	}
+}
+
+// ping 调用 ipc.ping，没有实现这个方法也算就绪
+func ping(socket string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c, err := ipc.Dial(ctx, socket)
+	if err != nil {
+		return false
+	}
+	defer c.Close()
+	err = c.Call(ctx, "ipc.ping", nil, nil)
+	var e *ipc.Error
+	return err == nil || errors.As(err, &e) && e.Code == ipc.CodeMethodNotFound
+}
+
+// stop 先发 SIGTERM，timeout 后还没退出就 SIGKILL
+func stop(cmd *exec.Cmd, timeout time.Duration, exited chan struct{}) {
+	terminate(cmd)
+	select {
+	case <-exited:
+	case <-time.After(timeout):
+		kill(cmd)
+	}
+}
+
+// Status 管理接口返回的进程状态
+type Status struct {
+	Name      string     `json:"name"`
+	State     string     `json:"state"`
+	PID       int        `json:"pid,omitempty"`
+	Socket    string     `json:"socket,omitempty"`
+	Restarts  int        `json:"restarts"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	LastExit  string     `json:"last_exit,omitempty"`
+}
+
+func (s *Supervisor) Status() []Status {
+	list := make([]Status, len(s.procs))
+	for i, p := range s.procs {
+		p.mu.Lock()
+		st := Status{Name: p.cfg.Name, State: p.state, PID: p.pid, Socket: p.cfg.Socket, Restarts: p.restarts, LastExit: p.lastExit}
+		if !p.startedAt.IsZero() {
+			started := p.startedAt
+			st.StartedAt = &started
+		}
+		p.mu.Unlock()
+		list[i] = st
+	}
+	return list
+}
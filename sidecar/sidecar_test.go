@@ -0,0 +1,292 @@
+//go:build unix
+
+package sidecar
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestHelperProcess 是被 Supervisor 启动的子进程，只在设置了 GOSERVER_SIDECAR_HELPER 时运行
+//
+// 每次启动都往 HELPER_LOG 追加一行 "start <纳秒时间戳>"，参数决定之后的行为:
+//
+//	exit <code>      立即以 code 退出
+//	sleep <duration> 睡眠后以 1 退出
+//	ignore-term      忽略 SIGTERM，写一行 ready 后一直睡眠
+//	grandchild       启动一个脱离进程组、继承输出的 sleep，写一行 pid 后以 0 退出
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("GOSERVER_SIDECAR_HELPER") != "1" {
+		return
+	}
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+	args = args[1:]
+	note := func(format string, a ...any) {
+		f, err := os.OpenFile(os.Getenv("HELPER_LOG"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			os.Exit(2)
+		}
+		fmt.Fprintf(f, format+"\n", a...)
+		f.Close()
+	}
+	note("start %d", time.Now().UnixNano())
+	fmt.Println("hello from", args[0])
+
+	switch args[0] {
+	case "exit":
+		code, _ := strconv.Atoi(args[1])
+		os.Exit(code)
+	case "sleep":
+		d, _ := time.ParseDuration(args[1])
+		time.Sleep(d)
+		os.Exit(1)
+	case "ignore-term":
+		signal.Ignore(syscall.SIGTERM)
+		note("ready")
+		time.Sleep(time.Hour)
+	case "grandchild":
+		cmd := exec.Command("sleep", "30")
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+		if err := cmd.Start(); err != nil {
+			os.Exit(2)
+		}
+		note("pid %d", cmd.Process.Pid)
+		os.Exit(0)
+	}
+	os.Exit(2)
+}
+
+// helper 返回启动 TestHelperProcess 的配置，输出记录在返回的文件里
+func helper(t *testing.T, name string, args ...string) (ProcessConfig, string) {
+	log := filepath.Join(t.TempDir(), name+".log")
+	return ProcessConfig{
+		Name:    name,
+		Command: append([]string{os.Args[0], "-test.run=^TestHelperProcess$", "--"}, args...),
+		Env:     map[string]string{"GOSERVER_SIDECAR_HELPER": "1", "HELPER_LOG": log},
+		Backoff: BackoffConfig{Initial: Duration(10 * time.Millisecond)},
+	}, log
+}
+
+func start(t *testing.T, procs ...ProcessConfig) *Supervisor {
+	t.Helper()
+	s, err := New(Config{Sidecars: procs}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Start()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.Stop(ctx); err != nil {
+			t.Errorf("Stop: %v", err)
+		}
+	})
+	return s
+}
+
+// lines 返回日志文件中以 prefix 开头的行去掉前缀后的内容
+func lines(path, prefix string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var list []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if rest, ok := strings.CutPrefix(sc.Text(), prefix); ok {
+			list = append(list, strings.TrimSpace(rest))
+		}
+	}
+	return list
+}
+
+// starts 返回每次启动的时间
+func starts(path string) []time.Time {
+	var list []time.Time
+	for _, s := range lines(path, "start") {
+		n, _ := strconv.ParseInt(s, 10, 64)
+		list = append(list, time.Unix(0, n))
+	}
+	return list
+}
+
+func waitFor(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func status(s *Supervisor, name string) Status {
+	for _, st := range s.Status() {
+		if st.Name == name {
+			return st
+		}
+	}
+	return Status{}
+}
+
+func TestRestartBackoff(t *testing.T) {
+	pc, log := helper(t, "crash", "exit", "1")
+	pc.Backoff = BackoffConfig{Initial: Duration(50 * time.Millisecond), Max: Duration(200 * time.Millisecond)}
+	s := start(t, pc)
+	waitFor(t, 5*time.Second, "5 starts", func() bool { return len(starts(log)) >= 5 })
+
+	// 间隔按 50ms、100ms、200ms 翻倍，之后停在 Max
+	at := starts(log)
+	for i, want := range []time.Duration{50, 100, 200, 200} {
+		gap := at[i+1].Sub(at[i])
+		if gap < want*time.Millisecond || gap > want*time.Millisecond+150*time.Millisecond {
+			t.Errorf("gap %d = %s, want about %dms", i, gap, want)
+		}
+	}
+	if st := status(s, "crash"); st.Restarts < 4 || st.LastExit != "exit status 1" {
+		t.Fatalf("status = %+v", st)
+	}
+}
+
+func TestBackoffResetsAfterStableRun(t *testing.T) {
+	old := stableAfter
+	stableAfter = 100 * time.Millisecond
+	t.Cleanup(func() { stableAfter = old })
+
+	// 每次运行 150ms，超过 stableAfter，间隔一直是 Initial；不重置的话第 4 次要等 800ms
+	pc, log := helper(t, "stable", "sleep", "150ms")
+	pc.Backoff = BackoffConfig{Initial: Duration(100 * time.Millisecond), Max: Duration(10 * time.Second)}
+	start(t, pc)
+	waitFor(t, 5*time.Second, "5 starts", func() bool { return len(starts(log)) >= 5 })
+
+	at := starts(log)
+	for i := range 4 {
+		if gap := at[i+1].Sub(at[i]); gap > 450*time.Millisecond {
+			t.Errorf("gap %d = %s, backoff was not reset", i, gap)
+		}
+	}
+}
+
+func TestRestartPolicies(t *testing.T) {
+	tests := []struct {
+		restart  string
+		code     string
+		restarts bool
+		lastExit string
+	}{
+		{RestartAlways, "0", true, "exit status 0"},
+		{RestartOnFailure, "0", false, "exit status 0"},
+		{RestartOnFailure, "3", true, "exit status 3"},
+		{RestartNever, "3", false, "exit status 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.restart+"/"+tt.code, func(t *testing.T) {
+			pc, log := helper(t, "p", "exit", tt.code)
+			pc.Restart = tt.restart
+			s := start(t, pc)
+			if tt.restarts {
+				waitFor(t, 5*time.Second, "a restart", func() bool { return status(s, "p").Restarts >= 1 })
+			} else {
+				waitFor(t, 5*time.Second, "exit", func() bool { return status(s, "p").State == StateExited })
+				// 多等几个重启间隔，确认没有再启动
+				time.Sleep(100 * time.Millisecond)
+				if n := len(starts(log)); n != 1 {
+					t.Fatalf("started %d times", n)
+				}
+			}
+			if st := status(s, "p"); st.LastExit != tt.lastExit {
+				t.Fatalf("status = %+v", st)
+			}
+		})
+	}
+}
+
+func TestReadyTimeoutKills(t *testing.T) {
+	// unix socket 路径有长度限制，不用 t.TempDir
+	dir, err := os.MkdirTemp("", "sc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	pc, _ := helper(t, "slow", "sleep", "1h")
+	pc.Socket = filepath.Join(dir, "slow.sock") // 从不监听
+	pc.Restart = RestartNever
+	pc.ReadyTimeout = Duration(200 * time.Millisecond)
+	began := time.Now()
+	s := start(t, pc)
+	waitFor(t, 5*time.Second, "exit", func() bool { return status(s, "slow").State == StateExited })
+
+	if elapsed := time.Since(began); elapsed < 200*time.Millisecond {
+		t.Fatalf("killed after %s", elapsed)
+	}
+	if st := status(s, "slow"); st.LastExit != "signal: terminated" {
+		t.Fatalf("status = %+v", st)
+	}
+}
+
+func TestStopEscalatesToKill(t *testing.T) {
+	term, _ := helper(t, "term", "sleep", "1h")
+	stubborn, log := helper(t, "stubborn", "ignore-term")
+	stubborn.StopTimeout = Duration(300 * time.Millisecond)
+	s, err := New(Config{Sidecars: []ProcessConfig{term, stubborn}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Start()
+	waitFor(t, 5*time.Second, "SIGTERM ignored", func() bool { return len(lines(log, "ready")) > 0 })
+	waitFor(t, 5*time.Second, "term started", func() bool { return status(s, "term").PID != 0 })
+
+	began := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(began); elapsed < 300*time.Millisecond {
+		t.Fatalf("Stop returned after %s, before StopTimeout", elapsed)
+	}
+	tests := []struct{ name, lastExit string }{
+		{"term", "signal: terminated"},
+		{"stubborn", "signal: killed"},
+	}
+	for _, tt := range tests {
+		if st := status(s, tt.name); st.State != StateStopped || st.PID != 0 || st.LastExit != tt.lastExit {
+			t.Errorf("%s: status = %+v", tt.name, st)
+		}
+	}
+}
+
+// 子进程退出后，它启动的后台进程还占着输出管道，也不能让 Supervisor 卡住
+func TestExitWithBackgroundChild(t *testing.T) {
+	pc, log := helper(t, "daemon", "grandchild")
+	pc.Restart = RestartNever
+	s := start(t, pc)
+	t.Cleanup(func() {
+		for _, line := range lines(log, "pid") {
+			if pid, err := strconv.Atoi(line); err == nil {
+				syscall.Kill(pid, syscall.SIGKILL)
+			}
+		}
+	})
+	waitFor(t, waitDelay+3*time.Second, "exit", func() bool { return status(s, "daemon").State == StateExited })
+	if st := status(s, "daemon"); st.LastExit != "exit status 0" {
+		t.Fatalf("status = %+v", st)
+	}
+}
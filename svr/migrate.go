@@ -0,0 +1,288 @@
+package svr
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// 迁移文件命名: 0001_create_users.up.sql / 0001_create_users.down.sql
+//
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+var ErrChecksumMismatch = errors.New("migration checksum mismatch")
+
+// Migration 一个版本的迁移，Checksum 只针对 up 脚本
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// MigrationStatus 迁移在数据库中的状态
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	Modified  bool // 已应用但文件内容被改动
+	Missing   bool // 数据库中已应用但找不到对应文件
+}
+
+type Migrator struct {
+	DB         *sql.DB
+	Migrations []Migration
+}
+
+// Migrate 应用所有内置的未执行迁移
+func Migrate(ctx context.Context, db *sql.DB) error {
+	m, err := NewMigrator(db, migrationFS)
+	if err != nil {
+		return err
+	}
+	n, err := m.Up(ctx)
+	if err != nil {
+		return err
+	}
+	log.Printf("Migrations applied: %d", n)
+	return nil
+}
+
+// NewMigrator 从 fsys 中加载迁移，fsys 为 nil 时使用内置迁移
+func NewMigrator(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	if fsys == nil {
+		fsys = migrationFS
+	}
+	files, err := fs.Glob(fsys, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, file := range files {
+		match := migrationName.FindStringSubmatch(path.Base(file))
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", file)
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version %q: %w", file, err)
+		}
+		body, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = mig
+		} else if mig.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, mig.Name, match[2])
+		}
+		if match[3] == "up" {
+			mig.Up = string(body)
+			sum := sha256.Sum256(body)
+			mig.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	m := &Migrator{DB: db}
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", mig.Version, mig.Name)
+		}
+		m.Migrations = append(m.Migrations, *mig)
+	}
+	sort.Slice(m.Migrations, func(i, j int) bool { return m.Migrations[i].Version < m.Migrations[j].Version })
+	return m, nil
+}
+
+type appliedMigration struct {
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	_, err := m.DB.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`)
+	return err
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int64]appliedMigration, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	rows, err := m.DB.QueryContext(ctx, "SELECT version, name, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int64]appliedMigration{}
+	for rows.Next() {
+		var version int64
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.Name, &a.Checksum, &a.AppliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = a
+	}
+	return applied, rows.Err()
+}
+
+// verify 校验已应用迁移的 checksum，防止已上线的迁移被修改
+func (m *Migrator) verify(applied map[int64]appliedMigration) error {
+	for _, mig := range m.Migrations {
+		a, ok := applied[mig.Version]
+		if ok && a.Checksum != mig.Checksum {
+			return fmt.Errorf("%w: %d_%s", ErrChecksumMismatch, mig.Version, mig.Name)
+		}
+	}
+	return nil
+}
+
+// Up 按版本顺序应用所有未执行的迁移，每个迁移一个事务
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if err := m.verify(applied); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, mig := range m.Migrations {
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+		err := m.inTx(ctx, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, mig.Up); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx,
+				"INSERT INTO schema_migrations (version, name, checksum) VALUES (?, ?, ?)",
+				mig.Version, mig.Name, mig.Checksum)
+			return err
+		})
+		if err != nil {
+			return n, fmt.Errorf("migration %d_%s up: %w", mig.Version, mig.Name, err)
+		}
+		log.Printf("Applied migration %d_%s", mig.Version, mig.Name)
+		n++
+	}
+	return n, nil
+}
+
+// Down 回滚最近应用的 steps 个迁移
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if err := m.verify(applied); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for i := len(m.Migrations) - 1; i >= 0 && n < steps; i-- {
+		mig := m.Migrations[i]
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+		if mig.Down == "" {
+			return n, fmt.Errorf("migration %d_%s has no down script", mig.Version, mig.Name)
+		}
+		err := m.inTx(ctx, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, mig.Down); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", mig.Version)
+			return err
+		})
+		if err != nil {
+			return n, fmt.Errorf("migration %d_%s down: %w", mig.Version, mig.Name, err)
+		}
+		log.Printf("Reverted migration %d_%s", mig.Version, mig.Name)
+		n++
+	}
+	return n, nil
+}
+
+// Redo 回滚并重新应用最近一个迁移
+func (m *Migrator) Redo(ctx context.Context) error {
+	n, err := m.Down(ctx, 1)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("no applied migration to redo")
+	}
+	_, err = m.Up(ctx)
+	return err
+}
+
+// Status 返回所有迁移（含数据库中存在但文件缺失的）的状态
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	known := map[int64]bool{}
+	var list []MigrationStatus
+	for _, mig := range m.Migrations {
+		known[mig.Version] = true
+		s := MigrationStatus{Version: mig.Version, Name: mig.Name}
+		if a, ok := applied[mig.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = a.AppliedAt
+			s.Modified = a.Checksum != mig.Checksum
+		}
+		list = append(list, s)
+	}
+	for version, a := range applied {
+		if !known[version] {
+			list = append(list, MigrationStatus{Version: version, Name: a.Name, Applied: true, AppliedAt: a.AppliedAt, Missing: true})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
+
+func (m *Migrator) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,202 @@
+package svr
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := OpenDB(DBConfig{Path: filepath.Join(t.TempDir(), "test.db"), MaxOpenConns: 1, MaxIdleConns: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func file(s string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(s)}
+}
+
+func tables(t *testing.T, db *sql.DB) string {
+	t.Helper()
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' AND name != 'schema_migrations' ORDER BY name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		names = append(names, name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestNewMigratorRejectsBadFiles(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+		err  string
+	}{
+		{"bad name", fstest.MapFS{"migrations/create_a.up.sql": file("")}, "invalid migration file name"},
+		{"no up", fstest.MapFS{"migrations/0001_a.down.sql": file("")}, "has no up script"},
+		{"conflicting names", fstest.MapFS{
+			"migrations/0001_a.up.sql": file(""),
+			"migrations/0001_b.up.sql": file(""),
+		}, "conflicting names"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewMigrator(nil, tt.fsys); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("err = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestMigratorUpDownRedo(t *testing.T) {
+	db := openTestDB(t)
+	fsys := fstest.MapFS{
+		"migrations/0001_create_a.up.sql":   file("CREATE TABLE a (id INTEGER);"),
+		"migrations/0001_create_a.down.sql": file("DROP TABLE a;"),
+		"migrations/0002_create_b.up.sql":   file("CREATE TABLE b (id INTEGER);"),
+		"migrations/0002_create_b.down.sql": file("DROP TABLE b;"),
+	}
+	m, err := NewMigrator(db, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	steps := []struct {
+		name   string
+		run    func() (int, error)
+		n      int
+		tables string
+	}{
+		{"up", func() (int, error) { return m.Up(ctx) }, 2, "a,b"},
+		{"up again", func() (int, error) { return m.Up(ctx) }, 0, "a,b"},
+		{"down 1", func() (int, error) { return m.Down(ctx, 1) }, 1, "a"},
+		{"redo", func() (int, error) { return 0, m.Redo(ctx) }, 0, "a,b"},
+		{"down all", func() (int, error) { return m.Down(ctx, 10) }, 2, ""},
+		{"down nothing", func() (int, error) { return m.Down(ctx, 1) }, 0, ""},
+	}
+	for _, s := range steps {
+		n, err := s.run()
+		if err != nil {
+			t.Fatalf("%s: %v", s.name, err)
+		}
+		if n != s.n || tables(t, db) != s.tables {
+			t.Fatalf("%s: n = %d, tables = %q, want %d, %q", s.name, n, tables(t, db), s.n, s.tables)
+		}
+	}
+	if err := m.Redo(ctx); err == nil {
+		t.Fatal("Redo without applied migrations should fail")
+	}
+}
+
+func TestMigratorChecksumMismatch(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	fsys := fstest.MapFS{
+		"migrations/0001_create_a.up.sql":   file("CREATE TABLE a (id INTEGER);"),
+		"migrations/0001_create_a.down.sql": file("DROP TABLE a;"),
+	}
+	m, err := NewMigrator(db, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 已应用的迁移被改动，down 脚本不参与校验
+	fsys["migrations/0001_create_a.up.sql"] = file("CREATE TABLE a (id INTEGER, name TEXT);")
+	fsys["migrations/0001_create_a.down.sql"] = file("DROP TABLE IF EXISTS a;")
+	fsys["migrations/0002_create_b.up.sql"] = file("CREATE TABLE b (id INTEGER);")
+	if m, err = NewMigrator(db, fsys); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Up = %v", err)
+	}
+	if _, err := m.Down(ctx, 1); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Down = %v", err)
+	}
+	if got := tables(t, db); got != "a" {
+		t.Fatalf("tables = %q", got)
+	}
+
+	delete(fsys, "migrations/0001_create_a.up.sql")
+	delete(fsys, "migrations/0001_create_a.down.sql")
+	fsys["migrations/0003_create_c.up.sql"] = file("CREATE TABLE c (id INTEGER);")
+	if m, err = NewMigrator(db, fsys); err != nil {
+		t.Fatal(err)
+	}
+	list, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 || !list[0].Missing || !list[0].Applied || list[1].Applied || list[2].Version != 3 {
+		t.Fatalf("status = %+v", list)
+	}
+}
+
+func TestMigratorRollsBackFailedMigration(t *testing.T) {
+	db := openTestDB(t)
+	m, err := NewMigrator(db, fstest.MapFS{
+		"migrations/0001_create_a.up.sql": file("CREATE TABLE a (id INTEGER);"),
+		"migrations/0002_broken.up.sql":   file("CREATE TABLE b (id INTEGER); INSERT INTO nope VALUES (1);"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := m.Up(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "2_broken up") || n != 1 {
+		t.Fatalf("n = %d, err = %v", n, err)
+	}
+	if got := tables(t, db); got != "a" {
+		t.Fatalf("tables = %q", got)
+	}
+	list, err := m.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !list[0].Applied || list[1].Applied {
+		t.Fatalf("status = %+v", list)
+	}
+}
+
+// 内置迁移的 down 脚本能完整回滚并重新应用
+func TestBuiltinMigrationsRoundTrip(t *testing.T) {
+	db := openTestDB(t)
+	m, err := NewMigrator(db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want := tables(t, db)
+	if n, err := m.Down(ctx, len(m.Migrations)); err != nil || n != len(m.Migrations) {
+		t.Fatalf("Down = %d, %v", n, err)
+	}
+	if got := tables(t, db); got != "" {
+		t.Fatalf("tables after down = %q", got)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := tables(t, db); got != want {
+		t.Fatalf("tables = %q, want %q", got, want)
+	}
+}
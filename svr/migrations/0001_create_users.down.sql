@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS user_deleted_at_age_name_id_1747242058824;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,11 @@
+-- 旧版本启动时会直接建表，这里用 IF NOT EXISTS 兼容已有数据库
+CREATE TABLE IF NOT EXISTS users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL COLLATE NOCASE,
+	age INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT NULL,
+	deleted_at DATETIME DEFAULT NULL
+);
+
+CREATE INDEX IF NOT EXISTS user_deleted_at_age_name_id_1747242058824 ON users (deleted_at, age, name, id);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS mall_deleted_at_name_id;
+DROP TABLE IF EXISTS malls;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS malls (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL COLLATE NOCASE,
+	location TEXT NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	deleted_at DATETIME DEFAULT NULL
+);
+
+CREATE INDEX IF NOT EXISTS mall_deleted_at_name_id ON malls (deleted_at, name, id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS outbox_aggregate_aggregate_id_id;
+DROP INDEX IF EXISTS outbox_dispatched_at_next_attempt_at_id;
+DROP TABLE IF EXISTS outbox;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS outbox (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	event TEXT NOT NULL,
+	aggregate TEXT NOT NULL,
+	aggregate_id INTEGER NOT NULL,
+	payload TEXT NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	last_error TEXT,
+	dispatched_at DATETIME DEFAULT NULL
+);
+
+CREATE INDEX IF NOT EXISTS outbox_dispatched_at_next_attempt_at_id ON outbox (dispatched_at, next_attempt_at, id);
+CREATE INDEX IF NOT EXISTS outbox_aggregate_aggregate_id_id ON outbox (aggregate, aggregate_id, id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS lowcode_migrations_entity_id;
+DROP TABLE IF EXISTS lowcode_migrations;
+DROP TABLE IF EXISTS lowcode_entities;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS lowcode_entities (
+	name TEXT PRIMARY KEY,
+	definition TEXT NOT NULL,
+	version INTEGER NOT NULL DEFAULT 1,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS lowcode_migrations (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	entity TEXT NOT NULL,
+	version INTEGER NOT NULL,
+	statements TEXT NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS lowcode_migrations_entity_id ON lowcode_migrations (entity, id);
@@ -0,0 +1,2 @@
+-- 重试次数用完的事件标记为 dead，不再转发，也不再阻塞同一聚合之后的事件
+ALTER TABLE outbox ADD COLUMN dead_at DATETIME DEFAULT NULL;
@@ -0,0 +1,69 @@
+package svr
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	ready     atomic.Bool
+	hooksMu   sync.Mutex
+	hooks     []hook
+	shutdowns sync.Once
+)
+
+type hook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Ready 服务是否可以接收流量，/health 据此返回 200 或 503
+func Ready() bool {
+	return ready.Load()
+}
+
+func SetReady(v bool) {
+	ready.Store(v)
+}
+
+// OnShutdown 注册退出时执行的清理函数，例如后台 worker 的 flush，按注册的逆序执行
+func OnShutdown(name string, fn func(ctx context.Context) error) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	hooks = append(hooks, hook{name, fn})
+}
+
+// Shutdown 先把服务标记为未就绪，再依次执行所有清理函数，只会执行一次
+func Shutdown(ctx context.Context) (err error) {
+	shutdowns.Do(func() {
+		ready.Store(false)
+		hooksMu.Lock()
+		list := hooks
+		hooksMu.Unlock()
+
+		var errs []error
+		for i := len(list) - 1; i >= 0; i-- {
+			h := list[i]
+			if e := h.fn(ctx); e != nil {
+				log.Printf("shutdown %s: %v", h.name, e)
+				errs = append(errs, fmt.Errorf("%s: %w", h.name, e))
+			}
+		}
+		err = errors.Join(errs...)
+	})
+	return err
+}
+
+// CloseDB 把 WAL 合并回主库并截断后关闭连接
+func CloseDB(DB *sql.DB) error {
+	if _, err := DB.Exec("PRAGMA wal_checkpoint(TRUNCATE);"); err != nil {
+		DB.Close()
+		return err
+	}
+	return DB.Close()
+}
@@ -0,0 +1,103 @@
+package svr
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// resetShutdown 清空注册的清理函数，让每个测试都能重新执行 Shutdown
+func resetShutdown(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		hooksMu.Lock()
+		hooks = nil
+		hooksMu.Unlock()
+		shutdowns = sync.Once{}
+		ready.Store(false)
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestShutdownRunsHooksInReverse(t *testing.T) {
+	resetShutdown(t)
+	SetReady(true)
+
+	boom := errors.New("boom")
+	var order []string
+	for _, name := range []string{"db", "mq", "outbox"} {
+		OnShutdown(name, func(ctx context.Context) error {
+			// 清理函数执行时 /health 已经返回 503
+			if Ready() {
+				t.Errorf("%s: still ready", name)
+			}
+			order = append(order, name)
+			if name == "mq" {
+				return boom
+			}
+			return nil
+		})
+	}
+
+	err := Shutdown(context.Background())
+	// 出错的清理函数不影响后面的继续执行
+	if want := []string{"outbox", "mq", "db"}; !slices.Equal(order, want) {
+		t.Fatalf("order = %v, want %v", order, want)
+	}
+	if !errors.Is(err, boom) || !strings.HasPrefix(err.Error(), "mq: ") {
+		t.Fatalf("err = %v", err)
+	}
+	if Ready() {
+		t.Fatal("ready after shutdown")
+	}
+}
+
+func TestShutdownRunsOnce(t *testing.T) {
+	resetShutdown(t)
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	OnShutdown("slow", func(ctx context.Context) error {
+		calls.Add(1)
+		<-release
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	var returned atomic.Int32
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Shutdown(context.Background())
+			returned.Add(1)
+		}()
+	}
+	// 清理函数没结束前，所有调用方都在等待
+	for calls.Load() == 0 {
+		runtime.Gosched()
+	}
+	if n := returned.Load(); n != 0 {
+		t.Fatalf("%d callers returned before the hooks finished", n)
+	}
+	close(release)
+	wg.Wait()
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("hook ran %d times", n)
+	}
+
+	// 之后注册的清理函数也不会再执行
+	OnShutdown("late", func(ctx context.Context) error {
+		calls.Add(1)
+		return nil
+	})
+	if err := Shutdown(context.Background()); err != nil || calls.Load() != 1 {
+		t.Fatalf("second Shutdown = %v, calls = %d", err, calls.Load())
+	}
+}
@@ -2,133 +2,125 @@
 package svr
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"log"
 	"os"
+	"sync/atomic"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3" // SQLite driver
+	"github.com/mattn/go-sqlite3" // SQLite driver
 )
 
-func InitDB( dataSourceName string)  (DB *sql.DB, err error) {
-	// Ensure the directory for the SQLite file exists (if it's in a subdirectory)
-	// For this example, we'll assume it's in the current directory.
-
-	// Check if the database file exists. If not, os.Create will make it.
-	// sql.Open will also create it if it doesn't exist, but this is explicit.
-	if _, err := os.Stat(dataSourceName); os.IsNotExist(err) {
-		log.Printf("Database file %s does not exist, will be created.", dataSourceName)
-	}
+// DBConfig 数据库路径、连接池和 PRAGMA 设置，由配置中心提供
+type DBConfig struct {
+	Path            string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	Pragmas         []string // 为空时使用 DefaultPragmas
+}
 
-	DB, err = sql.Open("sqlite3", dataSourceName)
+// InitDB 打开数据库并执行所有未应用的迁移，不再在启动时重建表
+func InitDB(cfg DBConfig) (DB *sql.DB, err error) {
+	DB, err = OpenDB(cfg)
 	if err != nil {
-		log.Fatalf("Error opening database: %v", err)
+		return nil, err
 	}
 
-	// Recommended for SQLite to improve concurrency and prevent "database is locked" errors
-	// WAL mode allows one writer and multiple readers to operate concurrently.
-	_, err = DB.Exec("PRAGMA journal_mode=WAL;")
-	if err != nil {
-		log.Fatalf("Failed to set WAL mode: %v", err)
+	if err = Migrate(context.Background(), DB); err != nil {
+		DB.Close()
+		return nil, err
 	}
 
-	// SQLite typically performs best with a single writer.
-	// Setting MaxOpenConns to 1 serializes write access through the pool.
-	// Reads can still be concurrent if WAL mode is enabled.
-	DB.SetMaxOpenConns(32)
-	DB.SetMaxIdleConns(8) // Usually same as MaxOpenConns for SQLite
-	DB.SetConnMaxLifetime(time.Minute * 5)
-
-	// Execute PRAGMA statements
-	// Note: The order can matter for some PRAGMAs.
-	// `page_size` should ideally be set on an empty database or before any tables are created.
-	// If the database already exists with data and a different page_size, this PRAGMA might be ignored
-	// or require a VACUUM to take effect.
-
-	pragmas := []string{
-		"PRAGMA journal_mode = WAL;",   // Already set via DSN for go-sqlite3, but can be here too
-		"PRAGMA synchronous = NORMAL;", // Or OFF, if you dare (and understand the risks)
-		"PRAGMA busy_timeout = 40000;", // Already set via DSN
-		"PRAGMA cache_size = -200001;", // Approx 200MB (negative value is KiB for cache_size)
-		"PRAGMA temp_store = MEMORY;",
-		"PRAGMA default_transaction_mode = IMMEDIATE;", // Go's sql package might override this per transaction
-		"PRAGMA logging_mode = OFF;",
-
-		// Optional
-		"PRAGMA foreign_keys = OFF;",        // Be careful with this; usually ON is safer for data integrity
-		"PRAGMA mmap_size = 268435456;",     // 256MB, test carefully for stability and performance
-		"PRAGMA wal_autocheckpoint = 4000;", // In pages, default is 1000. So 4000 * page_size
-		"PRAGMA page_size = 8192;",          // CRITICAL: Must be set on an EMPTY database or before any data.
-		// If the DB exists, this will likely be ignored or error unless the DB is vacuumed.
-		// It's safer to set this when the DB is first created.
-		// For an existing DB, you'd typically need to:
-		// 1. PRAGMA page_size=8192;
-		// 2. VACUUM;
-		// This can be a long operation.
-	}
+	return DB, nil
+}
 
-	// Special handling for page_size if the database is new or you intend to VACUUM
-	// For a *new* database, set page_size *before* createTable.
-	// If the database `dataSourceName` does not exist yet, `sql.Open` followed by an Exec
-	// will create it. `page_size` should be one of the first PRAGMAs.
-	// We'll try to set it. If the DB exists and has a different page_size, this PRAGMA
-	// will be a no-op unless the DB is empty or vacuumed.
-	// if _, err := DB.Exec("PRAGMA page_size = 8192;"); err != nil {
-	// 	// This might error if the database is not empty and has a different page size
-	// 	log.Printf("Warning/Error setting page_size: %v. This is OK if DB already exists with a different page size and is not empty.", err)
-	// } else {
-	// 	log.Println("Attempted to set PRAGMA page_size = 8192.")
-	// }
-
-	log.Println("Executing PRAGMA settings...")
-	for _, pragma := range pragmas {
-		_, err = DB.Exec(pragma)
-		if err != nil {
-			// Log as a warning for most pragmas, but could be fatal for critical ones
-			log.Printf("Warning/Error executing PRAGMA '%s': %v", pragma, err)
-		} else {
-			log.Printf("Successfully executed PRAGMA '%s'", pragma)
-		}
-	}
+// OpenDB 打开数据库连接并应用 PRAGMA 设置，不执行迁移
+//
+// busy_timeout、synchronous、cache_size 等 PRAGMA 只对执行它的连接有效，
+// 所以通过 ConnectHook 在连接池新建每个连接时执行，而不是在 *sql.DB 上 Exec 一次。
+func OpenDB(cfg DBConfig) (DB *sql.DB, err error) {
+	dataSourceName := cfg.Path
 
-	if err = DB.Ping(); err != nil {
-		log.Fatalf("Error pinging database: %v", err)
+	// Check if the database file exists. sql.Open will create it on the first connection.
+	if _, err := os.Stat(dataSourceName); os.IsNotExist(err) {
+		log.Printf("Database file %s does not exist, will be created.", dataSourceName)
 	}
 
-	log.Println("Database connection established and WAL mode enabled.")
-
-	// 1. 删除旧表（如果存在）
-	_, err = DB.Exec("DROP TABLE IF EXISTS users")
-	if err != nil {
-		log.Fatalf("Error dropping users table: %v", err)
+	pragmas := cfg.Pragmas
+	if len(pragmas) == 0 {
+		pragmas = DefaultPragmas
 	}
+	// auto_vacuum 必须在切换到 WAL 和建表之前设置，只对新库生效，已有的库需要执行一次 VACUUM；
+	// purge 硬删除之后用 incremental_vacuum 归还空闲页。
+	// WAL 让一个写连接和多个读连接可以并发，减少 "database is locked"。
+	pragmas = append([]string{"PRAGMA auto_vacuum = INCREMENTAL;", "PRAGMA journal_mode = WAL;"}, pragmas...)
 
-	// 2. 创建新表
-	createUserTableSQL := `
-		CREATE TABLE users (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			name TEXT NOT NULL COLLATE NOCASE,
-			age INTEGER NOT NULL,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT NULL,
-			deleted_at DATETIME DEFAULT NULL
-		)
-	 `
-	_, err = DB.Exec(createUserTableSQL)
+	DB, err = sql.Open(registerDriver(pragmas), dataSourceName)
 	if err != nil {
-		log.Fatalf("Error creating user table: %v", err)
+		return nil, err
 	}
 
-	// 3. 创建索引（单独执行）
-	_, err = DB.Exec(`
-		 CREATE INDEX user_deleted_at_age_name_id_1747242058824 ON users (deleted_at, age, name, id)
-	 `)
-	if err != nil {
-		log.Fatalf("Error creating index: %v", err)
+	// SQLite typically performs best with a single writer.
+	// Reads can still be concurrent if WAL mode is enabled.
+	DB.SetMaxOpenConns(cfg.MaxOpenConns)
+	DB.SetMaxIdleConns(cfg.MaxIdleConns) // Usually same as MaxOpenConns for SQLite
+	DB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	// Ping 建立第一个连接，PRAGMA 写错时在这里报错
+	if err = DB.Ping(); err != nil {
+		DB.Close()
+		return nil, fmt.Errorf("open %s: %w", dataSourceName, err)
 	}
 
-	log.Println("users table checked/created successfully.")
+	log.Printf("Database connection established, %d PRAGMA settings applied to every connection.", len(pragmas))
 
+	return DB, nil
+}
+
+var driverSeq atomic.Int64
+
+// registerDriver 注册一个在每个新连接上执行 pragmas 的驱动，返回驱动名
+func registerDriver(pragmas []string) string {
+	name := fmt.Sprintf("sqlite3_svr_%d", driverSeq.Add(1))
+	sql.Register(name, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			for _, pragma := range pragmas {
+				if _, err := conn.Exec(pragma, nil); err != nil {
+					return fmt.Errorf("%s: %w", pragma, err)
+				}
+			}
+			return nil
+		},
+	})
+	return name
+}
 
-	return DB,nil
+// DefaultPragmas 配置中没有设置 db.pragmas 时使用
+//
+// Note: The order can matter for some PRAGMAs.
+// `page_size` should ideally be set on an empty database or before any tables are created.
+// If the database already exists with data and a different page_size, this PRAGMA might be ignored
+// or require a VACUUM to take effect.
+var DefaultPragmas = []string{
+	"PRAGMA synchronous = NORMAL;", // Or OFF, if you dare (and understand the risks)
+	"PRAGMA busy_timeout = 40000;",
+	"PRAGMA cache_size = -200001;", // Approx 200MB (negative value is KiB for cache_size)
+	"PRAGMA temp_store = MEMORY;",
+	"PRAGMA default_transaction_mode = IMMEDIATE;", // Go's sql package might override this per transaction
+	"PRAGMA logging_mode = OFF;",
+
+	// Optional
+	"PRAGMA foreign_keys = OFF;",        // Be careful with this; usually ON is safer for data integrity
+	"PRAGMA mmap_size = 268435456;",     // 256MB, test carefully for stability and performance
+	"PRAGMA wal_autocheckpoint = 4000;", // In pages, default is 1000. So 4000 * page_size
+	"PRAGMA page_size = 8192;",          // CRITICAL: Must be set on an EMPTY database or before any data.
+	// If the DB exists, this will likely be ignored or error unless the DB is vacuumed.
+	// It's safer to set this when the DB is first created.
+	// For an existing DB, you'd typically need to:
+	// 1. PRAGMA page_size=8192;
+	// 2. VACUUM;
+	// This can be a long operation.
 }
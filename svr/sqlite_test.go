@@ -0,0 +1,60 @@
+package svr
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenDBAppliesPragmasToEveryConnection(t *testing.T) {
+	db, err := OpenDB(DBConfig{
+		Path:         filepath.Join(t.TempDir(), "test.db"),
+		MaxOpenConns: 4,
+		MaxIdleConns: 4,
+		Pragmas:      []string{"PRAGMA busy_timeout = 1234;", "PRAGMA cache_size = -4321;"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	for i := range 4 {
+		// 同时持有多个连接，确保每次拿到的都是新建的连接
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		tests := []struct {
+			pragma string
+			want   string
+		}{
+			{"busy_timeout", "1234"},
+			{"cache_size", "-4321"},
+			{"journal_mode", "wal"},
+			{"auto_vacuum", "2"},
+		}
+		for _, tt := range tests {
+			var got string
+			if err := conn.QueryRowContext(ctx, "PRAGMA "+tt.pragma).Scan(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("conn %d: %s = %s, want %s", i, tt.pragma, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestOpenDBRejectsInvalidPragma(t *testing.T) {
+	_, err := OpenDB(DBConfig{
+		Path:         filepath.Join(t.TempDir(), "test.db"),
+		MaxOpenConns: 1,
+		Pragmas:      []string{"PRAGMA journal_mode = WAL; SELEC 1"},
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}